@@ -0,0 +1,149 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BitwardenGeneratedSecretSpec defines the password to generate, the Secrets Manager secret holding it, and the
+// Kubernetes secret it is synced to.
+type BitwardenGeneratedSecretSpec struct {
+	// The name of the Kubernetes secret the password is synced to, in the namespace of the
+	// BitwardenGeneratedSecret
+	// +kubebuilder:validation:Required
+	SecretName string `json:"secretName"`
+	// The key of the Kubernetes secret holding the password
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=password
+	SecretKey string `json:"secretKey,omitempty"`
+	// The organization ID the secret is created in
+	// +kubebuilder:validation:Required
+	OrganizationId string `json:"organizationId"`
+	// The ID of the Secrets Manager project the secret is created in. The machine account needs write access
+	// to it.
+	// +kubebuilder:validation:Required
+	ProjectId string `json:"projectId"`
+	// The name of the secret in Secrets Manager. A secret with this name that already exists in the project
+	// is used instead of generating a new one.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	BwSecretName string `json:"bwSecretName"`
+	// The secret key reference for the authorization token used to connect to Secrets Manager
+	// +kubebuilder:validation:Required
+	AuthToken AuthToken `json:"authToken"`
+	// The options of the password generator. They only apply when the password is generated, so changing
+	// them later does not change the password.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default={}
+	Password PasswordOptions `json:"password,omitempty"`
+}
+
+// PasswordOptions are the options of the Bitwarden password generator
+type PasswordOptions struct {
+	// The length of the password, which must be at least the sum of the minimums
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=4
+	// +kubebuilder:validation:Maximum=128
+	// +kubebuilder:default=32
+	Length int64 `json:"length,omitempty"`
+	// Include lowercase characters (a-z)
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=true
+	Lowercase bool `json:"lowercase"`
+	// Include uppercase characters (A-Z)
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=true
+	Uppercase bool `json:"uppercase"`
+	// Include numbers (0-9)
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=true
+	Numbers bool `json:"numbers"`
+	// Include special characters (! @ # $ % ^ & *)
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	Special bool `json:"special"`
+	// Leave out the ambiguous characters I, O, l, 0 and 1
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=false
+	AvoidAmbiguous bool `json:"avoidAmbiguous,omitempty"`
+	// The minimum number of lowercase characters, if lowercase characters are included
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=9
+	MinLowercase *int64 `json:"minLowercase,omitempty"`
+	// The minimum number of uppercase characters, if uppercase characters are included
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=9
+	MinUppercase *int64 `json:"minUppercase,omitempty"`
+	// The minimum number of numbers, if numbers are included
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=9
+	MinNumber *int64 `json:"minNumber,omitempty"`
+	// The minimum number of special characters, if special characters are included
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=9
+	MinSpecial *int64 `json:"minSpecial,omitempty"`
+}
+
+// BitwardenGeneratedSecretStatus defines the observed state of BitwardenGeneratedSecret
+type BitwardenGeneratedSecretStatus struct {
+	// BwSecretId is the ID of the secret in Secrets Manager holding the password. Once set, the password is
+	// never generated again.
+	// +kubebuilder:validation:Optional
+	BwSecretId string `json:"bwSecretId,omitempty"`
+	// GeneratedTime is when the password was generated, or when an existing secret was found instead
+	// +kubebuilder:validation:Optional
+	GeneratedTime metav1.Time `json:"generatedTime,omitempty"`
+	// LastSuccessfulSyncTime is when the password was last synced to the Kubernetes secret
+	// +kubebuilder:validation:Optional
+	LastSuccessfulSyncTime metav1.Time `json:"lastSuccessfulSyncTime,omitempty"`
+	Conditions             []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// BitwardenGeneratedSecret is the Schema for the bitwardengeneratedsecrets API
+type BitwardenGeneratedSecret struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BitwardenGeneratedSecretSpec   `json:"spec,omitempty"`
+	Status BitwardenGeneratedSecretStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BitwardenGeneratedSecretList contains a list of BitwardenGeneratedSecret
+type BitwardenGeneratedSecretList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BitwardenGeneratedSecret `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BitwardenGeneratedSecret{}, &BitwardenGeneratedSecretList{})
+}
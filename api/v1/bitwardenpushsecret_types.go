@@ -0,0 +1,135 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BitwardenPushSecretSpec defines the Kubernetes secret whose data is pushed to Secrets Manager, and where to.
+type BitwardenPushSecretSpec struct {
+	// The name of the Kubernetes secret, in the namespace of the BitwardenPushSecret, whose data is pushed
+	// +kubebuilder:validation:Required
+	SecretName string `json:"secretName"`
+	// The organization ID the secrets are created in
+	// +kubebuilder:validation:Required
+	OrganizationId string `json:"organizationId"`
+	// The ID of the Secrets Manager project the secrets are created in. The machine account needs write
+	// access to it.
+	// +kubebuilder:validation:Required
+	ProjectId string `json:"projectId"`
+	// The secret key reference for the authorization token used to connect to Secrets Manager
+	// +kubebuilder:validation:Required
+	AuthToken AuthToken `json:"authToken"`
+	// The mapping of keys of the Kubernetes secret to the names of the secrets in Secrets Manager. When set,
+	// only the mapped keys are pushed. When empty, every key is pushed to a secret named after it.
+	// +kubebuilder:validation:Optional
+	Map []PushSecretMap `json:"map,omitempty"`
+	// ConflictPolicy decides what happens to a secret in Secrets Manager that was edited since it was last
+	// pushed. Skip, the default, leaves it as it is and reports the conflict in the Conflicted condition.
+	// Overwrite replaces the edit with the data of the Kubernetes secret.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Skip;Overwrite
+	// +kubebuilder:default=Skip
+	ConflictPolicy PushConflictPolicy `json:"conflictPolicy,omitempty"`
+	// DeletionPolicy decides what happens to the pushed secrets in Secrets Manager when the BitwardenPushSecret
+	// is deleted or a key is no longer pushed. Retain, the default, keeps them. Delete deletes them.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Retain;Delete
+	// +kubebuilder:default=Retain
+	DeletionPolicy PushDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// PushConflictPolicy decides how secrets edited in Secrets Manager since they were last pushed are handled
+type PushConflictPolicy string
+
+const (
+	PushConflictSkip      PushConflictPolicy = "Skip"
+	PushConflictOverwrite PushConflictPolicy = "Overwrite"
+)
+
+// PushDeletionPolicy decides whether pushed secrets are deleted from Secrets Manager with their source
+type PushDeletionPolicy string
+
+const (
+	PushDeletionRetain PushDeletionPolicy = "Retain"
+	PushDeletionDelete PushDeletionPolicy = "Delete"
+)
+
+type PushSecretMap struct {
+	// The key of the Kubernetes secret
+	// +kubebuilder:validation:Required
+	SecretKeyName string `json:"secretKeyName"`
+	// The name of the secret in Secrets Manager
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	BwSecretName string `json:"bwSecretName"`
+}
+
+// BitwardenPushSecretStatus defines the observed state of BitwardenPushSecret
+type BitwardenPushSecretStatus struct {
+	// LastSuccessfulPushTime is when the data of the Kubernetes secret was last found pushed
+	LastSuccessfulPushTime metav1.Time `json:"lastSuccessfulPushTime,omitempty"`
+	// PushedSecrets are the secrets in Secrets Manager that hold the data of the Kubernetes secret
+	// +kubebuilder:validation:Optional
+	PushedSecrets []PushedSecret `json:"pushedSecrets,omitempty"`
+	Conditions    []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// PushedSecret is a secret in Secrets Manager created from a key of the Kubernetes secret
+type PushedSecret struct {
+	// The key of the Kubernetes secret
+	SecretKeyName string `json:"secretKeyName"`
+	// The ID of the secret in Secrets Manager
+	BwSecretId string `json:"bwSecretId"`
+	// The revision date of the secret in Secrets Manager after it was last pushed, which tells whether it
+	// was edited since
+	RevisionDate string `json:"revisionDate"`
+	// Conflicted is true while the secret was edited in Secrets Manager and is not overwritten
+	// +kubebuilder:validation:Optional
+	Conflicted bool `json:"conflicted,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// BitwardenPushSecret is the Schema for the bitwardenpushsecrets API
+type BitwardenPushSecret struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BitwardenPushSecretSpec   `json:"spec,omitempty"`
+	Status BitwardenPushSecretStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BitwardenPushSecretList contains a list of BitwardenPushSecret
+type BitwardenPushSecretList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BitwardenPushSecret `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BitwardenPushSecret{}, &BitwardenPushSecretList{})
+}
@@ -22,6 +22,7 @@ Trademark Guidelines
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -46,6 +47,7 @@ type BitwardenSecretSpec struct {
 	// +kubebuilder:Required
 	AuthToken AuthToken `json:"authToken"`
 	// OnlyMappedSecrets, when true, restricts the Kubernetes Secret to only include secrets specified in SecretMap.
+	// When true, only the mapped secrets are fetched from Secrets Manager.
 	// When false or unset, all secrets accessible by the machine account are included, with SecretMap applied for renaming.
 	// Defaults to true.
 	// +kubebuilder:validation:Optional
@@ -59,6 +61,42 @@ type BitwardenSecretSpec struct {
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:default=false
 	UseSecretNames bool `json:"useSecretNames,omitempty"`
+	// SecretType is the type of the created Kubernetes secret. It is only applied when the secret is created.
+	// Defaults to Opaque.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=Opaque
+	SecretType corev1.SecretType `json:"secretType,omitempty"`
+	// Versioning, when set, writes every change of the data to a new immutable secret named
+	// <secretName>-<hash of the data> instead of updating the secret named secretName in place.
+	// The name of the current version is published in status.currentSecretName and in the
+	// k8s.bitwarden.com/current-secret annotation of the BitwardenSecret.
+	// +kubebuilder:validation:Optional
+	Versioning *SecretVersioning `json:"versioning,omitempty"`
+	// Delivery selects how the data reaches pods. Secret, the default, writes it to the Kubernetes secret
+	// named secretName. Inject keeps it out of Kubernetes secrets and only delivers it to pods annotated with
+	// k8s.bitwarden.com/inject, through an init container writing it to an in-memory volume. secretName is
+	// not used with Inject.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Secret;Inject
+	// +kubebuilder:default=Secret
+	Delivery DeliveryMode `json:"delivery,omitempty"`
+}
+
+// DeliveryMode selects how the data of a BitwardenSecret reaches pods
+type DeliveryMode string
+
+const (
+	DeliverySecret DeliveryMode = "Secret"
+	DeliveryInject DeliveryMode = "Inject"
+)
+
+type SecretVersioning struct {
+	// RevisionHistoryLimit is the number of previous versions kept for rollback besides the current one.
+	// Older versions are deleted. Defaults to 3.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=3
+	RevisionHistoryLimit int32 `json:"revisionHistoryLimit"`
 }
 
 type AuthToken struct {
@@ -88,9 +126,85 @@ type BitwardenSecretStatus struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	LastSuccessfulSyncTime metav1.Time `json:"lastSuccessfulSyncTime,omitempty"`
 
+	// LastCheckedTime is when the operator last confirmed that the Kubernetes secret is up to date with
+	// Secrets Manager. The secret itself is only written, and its sync-time annotation only updated,
+	// when its data changes.
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +kubebuilder:validation:Optional
+	LastCheckedTime *metav1.Time `json:"lastCheckedTime,omitempty"`
+
 	// Conditions store the status conditions of the BitwardenSecret instances
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// MissingSecrets lists the mapped Secrets Manager secrets that could not be fetched during the last sync
+	// when onlyMappedSecrets is enabled
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +kubebuilder:validation:Optional
+	MissingSecrets []MissingSecret `json:"missingSecrets,omitempty"`
+
+	// Backoff records how the operator retries after failed syncs. It is cleared by the next successful sync.
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +kubebuilder:validation:Optional
+	Backoff *SyncBackoff `json:"backoff,omitempty"`
+
+	// CurrentSecretName is the name of the immutable secret holding the current data when versioning is enabled
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +kubebuilder:validation:Optional
+	CurrentSecretName string `json:"currentSecretName,omitempty"`
+
+	// Consumers lists the workloads and pods in the namespace that reference the Kubernetes secret, when
+	// consumer tracking is enabled. At most 100 consumers are listed.
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +kubebuilder:validation:Optional
+	Consumers []SecretConsumer `json:"consumers,omitempty"`
+}
+
+// SyncBackoff describes the retry state of a BitwardenSecret whose last sync failed
+type SyncBackoff struct {
+	// ErrorClass of the last failure. Transient failures are retried with exponential backoff, Auth failures
+	// wait for the auth token secret to change and Permanent failures wait for the BitwardenSecret to change.
+	// +kubebuilder:validation:Enum=Transient;Auth;Permanent
+	ErrorClass string `json:"errorClass"`
+
+	// ConsecutiveFailures counts the failed syncs since the last successful one
+	ConsecutiveFailures int32 `json:"consecutiveFailures"`
+
+	// NextRetryTime is when a transient failure is retried next
+	// +kubebuilder:validation:Optional
+	NextRetryTime *metav1.Time `json:"nextRetryTime,omitempty"`
+
+	// ObservedGeneration is the generation of the BitwardenSecret that failed to sync
+	// +kubebuilder:validation:Optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// AuthTokenResourceVersion is the resource version of the auth token secret an auth failure occurred with
+	// +kubebuilder:validation:Optional
+	AuthTokenResourceVersion string `json:"authTokenResourceVersion,omitempty"`
+}
+
+// MissingSecret describes a mapped Secrets Manager secret that could not be fetched
+type MissingSecret struct {
+	// The ID of the secret in Secrets Manager
+	BwSecretId string `json:"bwSecretId"`
+	// Why the secret could not be fetched
+	Reason string `json:"reason"`
+}
+
+// SecretConsumer describes a workload or pod referencing the Kubernetes secret of a BitwardenSecret
+type SecretConsumer struct {
+	// Kind of the consumer. Pods are grouped by the kind of their controller, such as ReplicaSet or Job, and
+	// are listed as Pod when they have none.
+	Kind string `json:"kind"`
+	// Name of the consumer
+	Name string `json:"name"`
+	// Pods is the number of running pods grouped into the consumer. It is not set for the pod templates of
+	// Deployments, StatefulSets and DaemonSets.
+	// +kubebuilder:validation:Optional
+	Pods int32 `json:"pods,omitempty"`
+	// MissingKeys lists the keys the consumer references that the Kubernetes secret does not contain
+	// +kubebuilder:validation:Optional
+	MissingKeys []string `json:"missingKeys,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,81 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BitwardenSecretPolicySpec defines the restrictions applied to BitwardenSecrets in the selected namespaces.
+// The restrictions on organizations and projects also apply to BitwardenPushSecrets and BitwardenGeneratedSecrets,
+// and those on the created Kubernetes secret to BitwardenGeneratedSecrets.
+// Every list that is left empty places no restriction on the corresponding field. When several policies
+// select the same namespace, a BitwardenSecret must satisfy all of them.
+type BitwardenSecretPolicySpec struct {
+	// NamespaceSelector selects the namespaces the policy applies to. An empty selector selects all namespaces.
+	// +kubebuilder:validation:Required
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	// AllowedOrganizationIds lists the organization IDs BitwardenSecrets may sync from.
+	// +kubebuilder:validation:Optional
+	AllowedOrganizationIds []string `json:"allowedOrganizationIds,omitempty"`
+	// AllowedProjectIds lists the Secrets Manager project IDs whose secrets may be synced, and that
+	// BitwardenPushSecrets and BitwardenGeneratedSecrets may create secrets in.
+	// Secrets that do not belong to one of these projects cause the sync to be rejected.
+	// +kubebuilder:validation:Optional
+	AllowedProjectIds []string `json:"allowedProjectIds,omitempty"`
+	// AllowedSecretNamePatterns lists glob patterns (for example "app-*") that the name of the
+	// created Kubernetes secret must match.
+	// +kubebuilder:validation:Optional
+	AllowedSecretNamePatterns []string `json:"allowedSecretNamePatterns,omitempty"`
+	// AllowedSecretTypes lists the Kubernetes secret types BitwardenSecrets may create.
+	// +kubebuilder:validation:Optional
+	AllowedSecretTypes []corev1.SecretType `json:"allowedSecretTypes,omitempty"`
+	// MaxKeys limits the number of keys in the created Kubernetes secret.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	MaxKeys *int32 `json:"maxKeys,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// BitwardenSecretPolicy is the Schema for the bitwardensecretpolicies API
+type BitwardenSecretPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BitwardenSecretPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BitwardenSecretPolicyList contains a list of BitwardenSecretPolicy
+type BitwardenSecretPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BitwardenSecretPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BitwardenSecretPolicy{}, &BitwardenSecretPolicyList{})
+}
@@ -25,6 +25,7 @@ Trademark Guidelines
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -44,6 +45,214 @@ func (in *AuthToken) DeepCopy() *AuthToken {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenGeneratedSecret) DeepCopyInto(out *BitwardenGeneratedSecret) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenGeneratedSecret.
+func (in *BitwardenGeneratedSecret) DeepCopy() *BitwardenGeneratedSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenGeneratedSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BitwardenGeneratedSecret) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenGeneratedSecretList) DeepCopyInto(out *BitwardenGeneratedSecretList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]BitwardenGeneratedSecret, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenGeneratedSecretList.
+func (in *BitwardenGeneratedSecretList) DeepCopy() *BitwardenGeneratedSecretList {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenGeneratedSecretList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BitwardenGeneratedSecretList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenGeneratedSecretSpec) DeepCopyInto(out *BitwardenGeneratedSecretSpec) {
+	*out = *in
+	out.AuthToken = in.AuthToken
+	in.Password.DeepCopyInto(&out.Password)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenGeneratedSecretSpec.
+func (in *BitwardenGeneratedSecretSpec) DeepCopy() *BitwardenGeneratedSecretSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenGeneratedSecretSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenGeneratedSecretStatus) DeepCopyInto(out *BitwardenGeneratedSecretStatus) {
+	*out = *in
+	in.GeneratedTime.DeepCopyInto(&out.GeneratedTime)
+	in.LastSuccessfulSyncTime.DeepCopyInto(&out.LastSuccessfulSyncTime)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenGeneratedSecretStatus.
+func (in *BitwardenGeneratedSecretStatus) DeepCopy() *BitwardenGeneratedSecretStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenGeneratedSecretStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenPushSecret) DeepCopyInto(out *BitwardenPushSecret) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenPushSecret.
+func (in *BitwardenPushSecret) DeepCopy() *BitwardenPushSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenPushSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BitwardenPushSecret) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenPushSecretList) DeepCopyInto(out *BitwardenPushSecretList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]BitwardenPushSecret, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenPushSecretList.
+func (in *BitwardenPushSecretList) DeepCopy() *BitwardenPushSecretList {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenPushSecretList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BitwardenPushSecretList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenPushSecretSpec) DeepCopyInto(out *BitwardenPushSecretSpec) {
+	*out = *in
+	out.AuthToken = in.AuthToken
+	if in.Map != nil {
+		in, out := &in.Map, &out.Map
+		*out = make([]PushSecretMap, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenPushSecretSpec.
+func (in *BitwardenPushSecretSpec) DeepCopy() *BitwardenPushSecretSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenPushSecretSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenPushSecretStatus) DeepCopyInto(out *BitwardenPushSecretStatus) {
+	*out = *in
+	in.LastSuccessfulPushTime.DeepCopyInto(&out.LastSuccessfulPushTime)
+	if in.PushedSecrets != nil {
+		in, out := &in.PushedSecrets, &out.PushedSecrets
+		*out = make([]PushedSecret, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenPushSecretStatus.
+func (in *BitwardenPushSecretStatus) DeepCopy() *BitwardenPushSecretStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenPushSecretStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BitwardenSecret) DeepCopyInto(out *BitwardenSecret) {
 	*out = *in
@@ -103,6 +312,105 @@ func (in *BitwardenSecretList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenSecretPolicy) DeepCopyInto(out *BitwardenSecretPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenSecretPolicy.
+func (in *BitwardenSecretPolicy) DeepCopy() *BitwardenSecretPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenSecretPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BitwardenSecretPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenSecretPolicyList) DeepCopyInto(out *BitwardenSecretPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]BitwardenSecretPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenSecretPolicyList.
+func (in *BitwardenSecretPolicyList) DeepCopy() *BitwardenSecretPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenSecretPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BitwardenSecretPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BitwardenSecretPolicySpec) DeepCopyInto(out *BitwardenSecretPolicySpec) {
+	*out = *in
+	in.NamespaceSelector.DeepCopyInto(&out.NamespaceSelector)
+	if in.AllowedOrganizationIds != nil {
+		in, out := &in.AllowedOrganizationIds, &out.AllowedOrganizationIds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedProjectIds != nil {
+		in, out := &in.AllowedProjectIds, &out.AllowedProjectIds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedSecretNamePatterns != nil {
+		in, out := &in.AllowedSecretNamePatterns, &out.AllowedSecretNamePatterns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedSecretTypes != nil {
+		in, out := &in.AllowedSecretTypes, &out.AllowedSecretTypes
+		*out = make([]corev1.SecretType, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxKeys != nil {
+		in, out := &in.MaxKeys, &out.MaxKeys
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenSecretPolicySpec.
+func (in *BitwardenSecretPolicySpec) DeepCopy() *BitwardenSecretPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BitwardenSecretPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BitwardenSecretSpec) DeepCopyInto(out *BitwardenSecretSpec) {
 	*out = *in
@@ -112,6 +420,11 @@ func (in *BitwardenSecretSpec) DeepCopyInto(out *BitwardenSecretSpec) {
 		copy(*out, *in)
 	}
 	out.AuthToken = in.AuthToken
+	if in.Versioning != nil {
+		in, out := &in.Versioning, &out.Versioning
+		*out = new(SecretVersioning)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenSecretSpec.
@@ -128,6 +441,10 @@ func (in *BitwardenSecretSpec) DeepCopy() *BitwardenSecretSpec {
 func (in *BitwardenSecretStatus) DeepCopyInto(out *BitwardenSecretStatus) {
 	*out = *in
 	in.LastSuccessfulSyncTime.DeepCopyInto(&out.LastSuccessfulSyncTime)
+	if in.LastCheckedTime != nil {
+		in, out := &in.LastCheckedTime, &out.LastCheckedTime
+		*out = (*in).DeepCopy()
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]metav1.Condition, len(*in))
@@ -135,6 +452,23 @@ func (in *BitwardenSecretStatus) DeepCopyInto(out *BitwardenSecretStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.MissingSecrets != nil {
+		in, out := &in.MissingSecrets, &out.MissingSecrets
+		*out = make([]MissingSecret, len(*in))
+		copy(*out, *in)
+	}
+	if in.Backoff != nil {
+		in, out := &in.Backoff, &out.Backoff
+		*out = new(SyncBackoff)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]SecretConsumer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BitwardenSecretStatus.
@@ -147,6 +481,106 @@ func (in *BitwardenSecretStatus) DeepCopy() *BitwardenSecretStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MissingSecret) DeepCopyInto(out *MissingSecret) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MissingSecret.
+func (in *MissingSecret) DeepCopy() *MissingSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(MissingSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PasswordOptions) DeepCopyInto(out *PasswordOptions) {
+	*out = *in
+	if in.MinLowercase != nil {
+		in, out := &in.MinLowercase, &out.MinLowercase
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MinUppercase != nil {
+		in, out := &in.MinUppercase, &out.MinUppercase
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MinNumber != nil {
+		in, out := &in.MinNumber, &out.MinNumber
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MinSpecial != nil {
+		in, out := &in.MinSpecial, &out.MinSpecial
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PasswordOptions.
+func (in *PasswordOptions) DeepCopy() *PasswordOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(PasswordOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushSecretMap) DeepCopyInto(out *PushSecretMap) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushSecretMap.
+func (in *PushSecretMap) DeepCopy() *PushSecretMap {
+	if in == nil {
+		return nil
+	}
+	out := new(PushSecretMap)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushedSecret) DeepCopyInto(out *PushedSecret) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushedSecret.
+func (in *PushedSecret) DeepCopy() *PushedSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(PushedSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretConsumer) DeepCopyInto(out *SecretConsumer) {
+	*out = *in
+	if in.MissingKeys != nil {
+		in, out := &in.MissingKeys, &out.MissingKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretConsumer.
+func (in *SecretConsumer) DeepCopy() *SecretConsumer {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretConsumer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretMap) DeepCopyInto(out *SecretMap) {
 	*out = *in
@@ -161,3 +595,37 @@ func (in *SecretMap) DeepCopy() *SecretMap {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretVersioning) DeepCopyInto(out *SecretVersioning) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretVersioning.
+func (in *SecretVersioning) DeepCopy() *SecretVersioning {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretVersioning)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SyncBackoff) DeepCopyInto(out *SyncBackoff) {
+	*out = *in
+	if in.NextRetryTime != nil {
+		in, out := &in.NextRetryTime, &out.NextRetryTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SyncBackoff.
+func (in *SyncBackoff) DeepCopy() *SyncBackoff {
+	if in == nil {
+		return nil
+	}
+	out := new(SyncBackoff)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -22,19 +22,22 @@ Trademark Guidelines
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
-	"net/url"
 	"os"
-	"strconv"
 	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/google/uuid"
+
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -43,9 +46,14 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/config"
 	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	"github.com/bitwarden/sm-kubernetes/internal/csi"
+	"github.com/bitwarden/sm-kubernetes/internal/delivery"
+	webhookv1 "github.com/bitwarden/sm-kubernetes/internal/webhook/v1"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -54,6 +62,32 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+const (
+	// How often the SDK state of auth tokens that are no longer referenced is removed
+	stateCleanupInterval = time.Hour
+	// How long the CSI provider keeps the SDK state of an auth token that no mount used
+	csiStateTTL = 24 * time.Hour
+	// Maximum number of authenticated Bitwarden clients kept between reconciles
+	clientPoolSize = 100
+	// How long a sync is shared between BitwardenSecrets using the same organization and token
+	syncCacheTTL = 30 * time.Second
+	// How often the operator configuration file is checked for changes
+	configReloadInterval = 10 * time.Second
+	// How long the readiness check waits for a Bitwarden endpoint, and how long its outcome is reused
+	readinessCheckTimeout  = 5 * time.Second
+	readinessCheckCacheTTL = 30 * time.Second
+	// Name of the leader election lease, which also prefixes the names of the shard leases
+	leaderElectionID = "479cde60.bitwarden.com"
+	// Namespace of the service account token mounted into the pod
+	inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	// CA certificate of the webhook serving certificate, which the injected init containers verify the delivery API with
+	webhookCAFile = "/tmp/k8s-webhook-server/serving-certs/ca.crt"
+	// How long a single request of an injected init container to the delivery API may take
+	fetchRequestTimeout = 30 * time.Second
+	// Socket of the provider API, in the directory the Secrets Store CSI driver looks for providers in
+	csiProviderEndpoint = "/provider/" + csi.ProviderName + ".sock"
+)
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
@@ -62,10 +96,21 @@ func init() {
 }
 
 func main() {
+	// The image of the operator also runs the init containers injecting data into pods
+	if len(os.Args) > 1 && os.Args[1] == "fetch" {
+		os.Exit(runFetch(os.Args[2:]))
+	}
+	// The image of the operator also runs as a provider of the Secrets Store CSI driver on every node
+	if len(os.Args) > 1 && os.Args[1] == "csi-provider" {
+		os.Exit(runCSIProvider(os.Args[2:]))
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var enableHTTP2 bool
+	var configFile string
+	var watchNamespaces string
 	var tlsOpts []func(*tls.Config)
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
@@ -73,6 +118,12 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&configFile, "config", "",
+		"Path to the operator configuration file. Settings that are safe to change at runtime are reloaded when it changes. "+
+			"Environment variables override the settings of the file.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated list of namespaces to watch for BitwardenSecrets and Secrets. "+
+			"All namespaces are watched when empty. Overrides the watchNamespaces setting.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -96,6 +147,10 @@ func main() {
 		tlsOpts = append(tlsOpts, disableHTTP2)
 	}
 
+	webhookServer := webhook.NewServer(webhook.Options{
+		TLSOpts: tlsOpts,
+	})
+
 	metricsServerOptions := server.Options{
 		BindAddress:    metricsAddr,
 		SecureServing:  true,
@@ -103,20 +158,34 @@ func main() {
 		FilterProvider: filters.WithAuthenticationAndAuthorization,
 	}
 
-	bwApiUrl, identApiUrl, statePath, refreshIntervalSeconds, err := GetSettings()
+	operatorConfig, err := LoadConfig(configFile, watchNamespaces)
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		os.Exit(1)
+	}
 
+	bwClientFactory, timeoutClientFactory := newBitwardenClientFactory(operatorConfig)
+
+	stateEncryptionKey, err := GetStateEncryptionKey(operatorConfig.State.EncryptionKeyFile)
 	if err != nil {
-		panic(err)
+		setupLog.Error(err, "unable to read state encryption key")
+		os.Exit(1)
 	}
 
-	bwClientFactory := controller.NewBitwardenClientFactory(*bwApiUrl, *identApiUrl)
+	stateStore, err := controller.NewStateStore(operatorConfig.State.Path, stateEncryptionKey)
+	if err != nil {
+		setupLog.Error(err, "unable to set up state store")
+		os.Exit(1)
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsServerOptions,
+		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "479cde60.bitwarden.com",
+		LeaderElectionID:       leaderElectionID,
+		Cache:                  controller.CacheOptions(operatorConfig.WatchNamespaces),
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -134,18 +203,152 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controller.BitwardenSecretReconciler{
+	reconciler := &controller.BitwardenSecretReconciler{
+		Client:                  mgr.GetClient(),
+		APIReader:               mgr.GetAPIReader(),
+		Scheme:                  mgr.GetScheme(),
+		BitwardenClientFactory:  bwClientFactory,
+		StateStore:              stateStore,
+		SyncCache:               controller.NewSyncCache(syncCacheTTL),
+		RefreshIntervalSeconds:  operatorConfig.Sync.RefreshIntervalSeconds,
+		MaxConcurrentReconciles: operatorConfig.Sync.MaxConcurrentReconciles,
+		WatchNamespaces:         operatorConfig.WatchNamespaces,
+		RedactIdentifiers:       operatorConfig.Logging.RedactIdentifiers,
+	}
+	if operatorConfig.Features.Reloader {
+		reconciler.Reloader = &controller.Reloader{
+			Client:   mgr.GetClient(),
+			Reader:   mgr.GetAPIReader(),
+			Recorder: mgr.GetEventRecorder("bitwarden-reloader"),
+		}
+	}
+	if operatorConfig.Features.ConsumerTracking {
+		reconciler.Consumers = &controller.ConsumerTracker{
+			Reader:   mgr.GetClient(),
+			Recorder: mgr.GetEventRecorder("bitwarden-consumers"),
+		}
+	}
+	var injection *webhookv1.InjectionConfig
+	if operatorConfig.Features.Injection || operatorConfig.Features.DeliveryApi {
+		reconciler.Delivered = controller.NewDeliveryCache()
+	}
+	if operatorConfig.Features.Injection {
+		injection = &webhookv1.InjectionConfig{
+			Image:       operatorConfig.Injection.Image,
+			DeliveryURL: operatorConfig.Injection.DeliveryUrl,
+			CAFile:      webhookCAFile,
+		}
+	}
+	if operatorConfig.Sharding.Shards > 0 {
+		leaseNamespace, err := ShardLeaseNamespace(operatorConfig.Sharding.LeaseNamespace)
+		if err != nil {
+			setupLog.Error(err, "unable to determine the namespace of the shard leases")
+			os.Exit(1)
+		}
+		hostname, err := os.Hostname()
+		if err != nil {
+			setupLog.Error(err, "unable to determine the shard identity")
+			os.Exit(1)
+		}
+
+		reconciler.Shards = controller.NewShardManager(mgr.GetClient(), mgr.GetAPIReader(), leaseNamespace, leaderElectionID,
+			hostname+"_"+uuid.NewString(), operatorConfig.Sharding.Shards)
+		if err := mgr.Add(reconciler.Shards); err != nil {
+			setupLog.Error(err, "unable to set up shard manager")
+			os.Exit(1)
+		}
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "BitwardenSecret")
+		os.Exit(1)
+	}
+	pushReconciler := &controller.BitwardenPushSecretReconciler{
 		Client:                 mgr.GetClient(),
+		APIReader:              mgr.GetAPIReader(),
+		BitwardenClientFactory: bwClientFactory,
+		StateStore:             stateStore,
+		Recorder:               mgr.GetEventRecorder("bitwarden-push"),
+		RefreshIntervalSeconds: operatorConfig.Sync.RefreshIntervalSeconds,
+	}
+	if err = pushReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "BitwardenPushSecret")
+		os.Exit(1)
+	}
+	generatedReconciler := &controller.BitwardenGeneratedSecretReconciler{
+		Client:                 mgr.GetClient(),
+		APIReader:              mgr.GetAPIReader(),
 		Scheme:                 mgr.GetScheme(),
 		BitwardenClientFactory: bwClientFactory,
-		StatePath:              *statePath,
-		RefreshIntervalSeconds: *refreshIntervalSeconds,
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "BitwardenSecret")
+		StateStore:             stateStore,
+		Recorder:               mgr.GetEventRecorder("bitwarden-generator"),
+		RefreshIntervalSeconds: operatorConfig.Sync.RefreshIntervalSeconds,
+	}
+	if err = generatedReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "BitwardenGeneratedSecret")
 		os.Exit(1)
 	}
+	if operatorConfig.Features.Webhooks {
+		if err = webhookv1.SetupBitwardenSecretWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "BitwardenSecret")
+			os.Exit(1)
+		}
+		if err = webhookv1.SetupBitwardenPushSecretWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "BitwardenPushSecret")
+			os.Exit(1)
+		}
+		if err = webhookv1.SetupBitwardenGeneratedSecretWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "BitwardenGeneratedSecret")
+			os.Exit(1)
+		}
+		if err = webhookv1.SetupPodWebhookWithManager(mgr, operatorConfig.Features.ReadinessGates, injection); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
+			os.Exit(1)
+		}
+		if reconciler.Delivered != nil {
+			mgr.GetWebhookServer().Register(delivery.Pattern, &delivery.Server{
+				Client:    mgr.GetClient(),
+				APIReader: mgr.GetAPIReader(),
+				Delivered: reconciler.Delivered,
+			})
+		}
+	}
+	if operatorConfig.Features.ReadinessGates {
+		if err = (&controller.PodReadinessReconciler{Client: mgr.GetClient()}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "PodReadinessGate")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	if err := mgr.Add(&controller.StateJanitor{
+		Client:     mgr.GetClient(),
+		APIReader:  mgr.GetAPIReader(),
+		StateStore: stateStore,
+		Interval:   stateCleanupInterval,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up state janitor")
+		os.Exit(1)
+	}
+
+	if configFile != "" {
+		watcher, err := config.NewWatcher(configFile, configReloadInterval, operatorConfig, func(reloaded *config.OperatorConfig) {
+			reconciler.SetRefreshInterval(reloaded.Sync.RefreshIntervalSeconds)
+			pushReconciler.SetRefreshInterval(reloaded.Sync.RefreshIntervalSeconds)
+			generatedReconciler.SetRefreshInterval(reloaded.Sync.RefreshIntervalSeconds)
+			reconciler.SetRedactIdentifiers(reloaded.Logging.RedactIdentifiers)
+			timeoutClientFactory.SetTimeout(reloaded.CallTimeout())
+			bwClientFactory.SetSettings(reloaded.CircuitBreaker.FailureThreshold, reloaded.CircuitBreakerProbeInterval())
+		})
+		if err != nil {
+			setupLog.Error(err, "unable to watch operator configuration")
+			os.Exit(1)
+		}
+		if err := mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to set up operator configuration reload")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -154,6 +357,28 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if operatorConfig.Features.ReadinessCheck {
+		readinessChecks := map[string]string{
+			"bitwarden-api":      operatorConfig.Bitwarden.ApiUrl,
+			"bitwarden-identity": operatorConfig.Bitwarden.IdentityApiUrl,
+		}
+		// The webhooks are served by the operator pods, so pods that are not ready during a Bitwarden outage
+		// take the webhooks down with them, and the webhooks that fail closed reject their requests
+		if operatorConfig.Features.Webhooks {
+			setupLog.Info("The readiness of the operator depends on Bitwarden, so the webhooks are unavailable while it cannot be reached")
+		}
+		for name, endpoint := range readinessChecks {
+			checker := controller.NewEndpointChecker(endpoint, readinessCheckTimeout, readinessCheckCacheTTL)
+			if err := mgr.Add(checker); err != nil {
+				setupLog.Error(err, "unable to set up reachability check", "check", name)
+				os.Exit(1)
+			}
+			if err := mgr.AddReadyzCheck(name, checker.Check); err != nil {
+				setupLog.Error(err, "unable to set up ready check", "check", name)
+				os.Exit(1)
+			}
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -162,78 +387,172 @@ func main() {
 	}
 }
 
-func GetSettings() (*string, *string, *string, *int, error) {
-	bwApiUrl := strings.TrimSpace(os.Getenv("BW_API_URL"))
-	identApiUrl := strings.TrimSpace(os.Getenv("BW_IDENTITY_API_URL"))
-	statePath := strings.TrimSpace(os.Getenv("BW_SECRETS_MANAGER_STATE_PATH"))
-	refreshIntervalSecondsStr := strings.TrimSpace(os.Getenv("BW_SECRETS_MANAGER_REFRESH_INTERVAL"))
-	refreshIntervalSeconds := 300
-
-	if refreshIntervalSecondsStr != "" {
-		value, err := strconv.Atoi(refreshIntervalSecondsStr)
+// LoadConfig loads the operator configuration file, or uses the defaults when no file is given. Environment
+// variables override the settings either way, and a non-empty watchNamespaces flag overrides the watched namespaces.
+func LoadConfig(configFile string, watchNamespaces string) (*config.OperatorConfig, error) {
+	var operatorConfig *config.OperatorConfig
+	var err error
+	if configFile == "" {
+		operatorConfig, err = config.FromEnv(os.LookupEnv)
+	} else {
+		operatorConfig, err = config.Load(configFile)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			setupLog.Error(err, fmt.Sprintf("Invalid refresh interval supplied: %s.  Defaulting to 300 seconds.", refreshIntervalSecondsStr))
-		} else if value >= 180 {
-			refreshIntervalSeconds = value
-		} else {
-			setupLog.Info(fmt.Sprintf("Refresh interval value is below the minimum allowed value of 180 seconds. Reverting to the default 300 seconds. Value supplied: %d", value))
+	if namespaces := config.SplitList(watchNamespaces); len(namespaces) > 0 {
+		operatorConfig.WatchNamespaces = namespaces
+		if err := operatorConfig.Validate(); err != nil {
+			return nil, err
 		}
 	}
 
-	if bwApiUrl != "" {
-		_, err := url.ParseRequestURI(bwApiUrl)
+	return operatorConfig, nil
+}
 
-		if err != nil {
-			setupLog.Error(err, fmt.Sprintf("Bitwarden API URL is not valid.  Value supplied: %s", bwApiUrl))
-			return nil, nil, nil, nil, err
-		}
+// newBitwardenClientFactory returns the factory of pooled Bitwarden clients whose calls time out and open the
+// circuit breaker, along with the timeout factory whose call timeout is reloadable.
+func newBitwardenClientFactory(operatorConfig *config.OperatorConfig) (*controller.CircuitBreakerClientFactory, *controller.TimeoutClientFactory) {
+	// Sessions are kept for two refresh intervals so that they survive until the next sync of every BitwardenSecret using them
+	bwClientPool := controller.NewBitwardenClientPool(
+		controller.NewBitwardenClientFactory(operatorConfig.Bitwarden.ApiUrl, operatorConfig.Bitwarden.IdentityApiUrl),
+		clientPoolSize,
+		2*time.Duration(operatorConfig.Sync.RefreshIntervalSeconds)*time.Second)
+	timeoutClientFactory := controller.NewTimeoutClientFactory(bwClientPool, operatorConfig.CallTimeout())
+	bwClientFactory := controller.NewCircuitBreakerClientFactory(
+		timeoutClientFactory,
+		operatorConfig.CircuitBreaker.FailureThreshold,
+		operatorConfig.CircuitBreakerProbeInterval())
+	return bwClientFactory, timeoutClientFactory
+}
 
-		u, err := url.Parse(bwApiUrl)
+// runCSIProvider serves the provider API of the Secrets Store CSI driver on a unix socket. It is the command
+// of the provider daemon set, which runs next to the driver on every node.
+func runCSIProvider(args []string) int {
+	providerFlags := flag.NewFlagSet("csi-provider", flag.ContinueOnError)
+	endpoint := providerFlags.String("endpoint", csiProviderEndpoint, "Unix socket the provider API is served on.")
+	configFile := providerFlags.String("config", "",
+		"Path to the operator configuration file, of which the Bitwarden, state and circuit breaker settings are used. "+
+			"Environment variables override the settings of the file.")
+	opts := zap.Options{}
+	opts.BindFlags(providerFlags)
+	if err := providerFlags.Parse(args); err != nil {
+		return 2
+	}
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-		if err != nil || u.Scheme == "" || u.Host == "" {
-			message := fmt.Sprintf("Bitwarden API URL is not valid.  Value supplied: %s", bwApiUrl)
-			if err == nil {
-				err = fmt.Errorf("%s", message)
-			}
+	operatorConfig, err := LoadConfig(*configFile, "")
+	if err != nil {
+		setupLog.Error(err, "invalid operator configuration")
+		return 1
+	}
+	bwClientFactory, _ := newBitwardenClientFactory(operatorConfig)
 
-			setupLog.Error(err, message)
-			return nil, nil, nil, nil, err
-		}
+	stateEncryptionKey, err := GetStateEncryptionKey(operatorConfig.State.EncryptionKeyFile)
+	if err != nil {
+		setupLog.Error(err, "unable to read state encryption key")
+		return 1
+	}
+	stateStore, err := controller.NewStateStore(operatorConfig.State.Path, stateEncryptionKey)
+	if err != nil {
+		setupLog.Error(err, "unable to set up state store")
+		return 1
 	}
 
-	if identApiUrl != "" {
-		_, err := url.ParseRequestURI(identApiUrl)
+	ctx := ctrl.SetupSignalHandler()
+	// The provider does not watch the cluster, so the state of a token is removed once no mount used it for a while
+	janitor := &controller.StateJanitor{
+		StateStore: stateStore,
+		Interval:   stateCleanupInterval,
+		UnusedTTL:  csiStateTTL,
+	}
+	go func() {
+		_ = janitor.Start(ctx)
+	}()
 
-		if err != nil {
-			setupLog.Error(err, fmt.Sprintf("Bitwarden Identity URL is not valid.  Value supplied: %s", identApiUrl))
-			return nil, nil, nil, nil, err
-		}
+	provider := &csi.Provider{
+		Puller: &controller.SecretPuller{BitwardenClientFactory: bwClientFactory, StateStore: stateStore},
+	}
+	if err := csi.Serve(ctx, *endpoint, provider); err != nil {
+		setupLog.Error(err, "problem serving the provider API")
+		return 1
+	}
+	return 0
+}
 
-		u, err := url.ParseRequestURI(identApiUrl)
+// runFetch fetches the data of a BitwardenSecret from the delivery API and writes it to a directory. It is
+// the command of the init containers injected into pods.
+func runFetch(args []string) int {
+	fetchFlags := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	url := fetchFlags.String("url", "", "URL of the BitwardenSecret in the delivery API.")
+	tokenFile := fetchFlags.String("token-file", "", "File holding the service account token to authenticate with.")
+	dir := fetchFlags.String("dir", "", "Directory the data is written to.")
+	format := fetchFlags.String("format", delivery.FormatFiles,
+		"How the data is written: files, one file per key, or env, a secrets.env file of shell variable assignments.")
+	timeout := fetchFlags.Duration("timeout", 5*time.Minute, "How long to wait for the data to become available.")
+	opts := zap.Options{}
+	opts.BindFlags(fetchFlags)
+	if err := fetchFlags.Parse(args); err != nil {
+		return 2
+	}
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	if *url == "" || *tokenFile == "" || *dir == "" {
+		setupLog.Error(nil, "--url, --token-file and --dir are required")
+		return 2
+	}
 
-		if err != nil || u.Scheme == "" || u.Host == "" {
-			message := fmt.Sprintf("Bitwarden Identity URL is not valid.  Value supplied: %s", identApiUrl)
-			if err == nil {
-				err = fmt.Errorf("%s", message)
-			}
+	client, err := delivery.NewHTTPClient(os.Getenv(delivery.EnvCABundle), fetchRequestTimeout)
+	if err != nil {
+		setupLog.Error(err, "invalid CA bundle", "env", delivery.EnvCABundle)
+		return 1
+	}
 
-			setupLog.Error(err, message)
-			return nil, nil, nil, nil, err
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	data, err := delivery.Fetch(ctx, client, *url, *tokenFile)
+	if err != nil {
+		setupLog.Error(err, "unable to fetch the data", "url", *url)
+		return 1
 	}
 
-	if bwApiUrl == "" {
-		bwApiUrl = "https://api.bitwarden.com"
+	if err := delivery.Write(*dir, *format, data); err != nil {
+		setupLog.Error(err, "unable to write the data", "dir", *dir)
+		return 1
 	}
+	setupLog.Info("Wrote the data", "keys", len(data), "dir", *dir)
+	return 0
+}
 
-	if identApiUrl == "" {
-		identApiUrl = "https://identity.bitwarden.com"
+// ShardLeaseNamespace returns the configured namespace of the shard leases, or else the namespace the operator runs in.
+func ShardLeaseNamespace(configured string) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+
+	namespace, err := os.ReadFile(inClusterNamespaceFile)
+	if err != nil {
+		return "", fmt.Errorf("set sharding.leaseNamespace when running outside of a cluster: %w", err)
+	}
+	return strings.TrimSpace(string(namespace)), nil
+}
+
+// GetStateEncryptionKey reads the key used to encrypt the SDK state files from keyFile, typically a mounted
+// Kubernetes secret. It returns nil when no key file is configured, in which case the state is stored unencrypted.
+func GetStateEncryptionKey(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		return nil, nil
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
 	}
 
-	if statePath == "" {
-		statePath = "/var/bitwarden/state"
+	key = bytes.TrimSpace(key)
+	if len(key) < controller.MinStateEncryptionKeyLength {
+		return nil, fmt.Errorf("state encryption key in %s must be at least %d bytes long", keyFile, controller.MinStateEncryptionKeyLength)
 	}
 
-	return &bwApiUrl, &identApiUrl, &statePath, &refreshIntervalSeconds, nil
+	return key, nil
 }
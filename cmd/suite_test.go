@@ -23,7 +23,9 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -46,19 +48,48 @@ var _ = AfterSuite(func() {
 	By(" tearing down")
 })
 
-var _ = Describe("Get settings", Ordered, func() {
+var _ = Describe("Load config", Ordered, func() {
+
+	envVars := []string{
+		"BW_API_URL",
+		"BW_IDENTITY_API_URL",
+		"BW_SECRETS_MANAGER_STATE_PATH",
+		"BW_SECRETS_MANAGER_REFRESH_INTERVAL",
+		"BW_SECRETS_MANAGER_CALL_TIMEOUT",
+		"BW_SECRETS_MANAGER_MAX_CONCURRENT_RECONCILES",
+		"BW_SECRETS_MANAGER_CIRCUIT_BREAKER_THRESHOLD",
+		"BW_SECRETS_MANAGER_CIRCUIT_BREAKER_PROBE_INTERVAL",
+		"BW_SECRETS_MANAGER_READINESS_CHECK",
+		"BW_SECRETS_MANAGER_WATCH_NAMESPACES",
+		"BW_SECRETS_MANAGER_SHARDS",
+		"BW_SECRETS_MANAGER_RELOADER",
+		"BW_SECRETS_MANAGER_CONSUMER_TRACKING",
+		"BW_SECRETS_MANAGER_READINESS_GATES",
+		"BW_SECRETS_MANAGER_INJECTION",
+		"BW_SECRETS_MANAGER_INJECTION_IMAGE",
+		"BW_SECRETS_MANAGER_DELIVERY_URL",
+		"BW_SECRETS_MANAGER_DELIVERY_API",
+		"BW_SECRETS_MANAGER_SHARD_LEASE_NAMESPACE",
+	}
+
+	BeforeEach(func() {
+		for _, name := range envVars {
+			os.Setenv(name, "")
+		}
+	})
 
 	It("Pulls the default settings", func() {
-		os.Setenv("BW_API_URL", "")
-		os.Setenv("BW_IDENTITY_API_URL", "")
-		os.Setenv("BW_SECRETS_MANAGER_STATE_PATH", "")
-		os.Setenv("BW_SECRETS_MANAGER_REFRESH_INTERVAL", "")
-		apiUri, identityUri, statePath, refreshInterval, err := GetSettings()
-		Expect(*apiUri).Should(Equal("https://api.bitwarden.com"))
-		Expect(*identityUri).Should(Equal("https://identity.bitwarden.com"))
-		Expect(*statePath).Should(Equal("/var/bitwarden/state"))
-		Expect(*refreshInterval).Should(Equal(300))
+		operatorConfig, err := LoadConfig("", "")
 		Expect(err).Should(BeNil())
+		Expect(operatorConfig.Bitwarden.ApiUrl).Should(Equal("https://api.bitwarden.com"))
+		Expect(operatorConfig.Bitwarden.IdentityApiUrl).Should(Equal("https://identity.bitwarden.com"))
+		Expect(operatorConfig.State.Path).Should(Equal("/var/bitwarden/state"))
+		Expect(operatorConfig.Sync.RefreshIntervalSeconds).Should(Equal(300))
+		Expect(operatorConfig.Sync.MaxConcurrentReconciles).Should(Equal(1))
+		Expect(operatorConfig.CallTimeout()).Should(Equal(30 * time.Second))
+		Expect(operatorConfig.CircuitBreaker.FailureThreshold).Should(Equal(5))
+		Expect(operatorConfig.CircuitBreakerProbeInterval()).Should(Equal(60 * time.Second))
+		Expect(operatorConfig.Features.ReadinessCheck).Should(BeFalse())
 	})
 
 	It("Pulls some env settings", func() {
@@ -66,86 +97,141 @@ var _ = Describe("Get settings", Ordered, func() {
 		os.Setenv("BW_IDENTITY_API_URL", "https://identity.bitwarden.eu")
 		os.Setenv("BW_SECRETS_MANAGER_STATE_PATH", "~/state")
 		os.Setenv("BW_SECRETS_MANAGER_REFRESH_INTERVAL", "180")
-		apiUri, identityUri, statePath, refreshInterval, err := GetSettings()
-		Expect(*apiUri).Should(Equal("https://api.bitwarden.eu"))
-		Expect(*identityUri).Should(Equal("https://identity.bitwarden.eu"))
-		Expect(*statePath).Should(Equal("~/state"))
-		Expect(*refreshInterval).Should(Equal(180))
+		os.Setenv("BW_SECRETS_MANAGER_CALL_TIMEOUT", "45")
+		os.Setenv("BW_SECRETS_MANAGER_MAX_CONCURRENT_RECONCILES", "8")
+		os.Setenv("BW_SECRETS_MANAGER_CIRCUIT_BREAKER_THRESHOLD", "0")
+		os.Setenv("BW_SECRETS_MANAGER_CIRCUIT_BREAKER_PROBE_INTERVAL", "120")
+		os.Setenv("BW_SECRETS_MANAGER_READINESS_CHECK", "true")
+		os.Setenv("BW_SECRETS_MANAGER_SHARDS", "16")
+		os.Setenv("BW_SECRETS_MANAGER_SHARD_LEASE_NAMESPACE", "sm-operator-system")
+		operatorConfig, err := LoadConfig("", "")
+		Expect(err).Should(BeNil())
+		Expect(operatorConfig.Bitwarden.ApiUrl).Should(Equal("https://api.bitwarden.eu"))
+		Expect(operatorConfig.Bitwarden.IdentityApiUrl).Should(Equal("https://identity.bitwarden.eu"))
+		Expect(operatorConfig.State.Path).Should(Equal("~/state"))
+		Expect(operatorConfig.Sync.RefreshIntervalSeconds).Should(Equal(180))
+		Expect(operatorConfig.Sync.MaxConcurrentReconciles).Should(Equal(8))
+		Expect(operatorConfig.CallTimeout()).Should(Equal(45 * time.Second))
+		Expect(operatorConfig.CircuitBreaker.FailureThreshold).Should(Equal(0))
+		Expect(operatorConfig.CircuitBreakerProbeInterval()).Should(Equal(120 * time.Second))
+		Expect(operatorConfig.Features.ReadinessCheck).Should(BeTrue())
+		Expect(operatorConfig.Sharding.Shards).Should(Equal(16))
+
+		leaseNamespace, err := ShardLeaseNamespace(operatorConfig.Sharding.LeaseNamespace)
 		Expect(err).Should(BeNil())
+		Expect(leaseNamespace).Should(Equal("sm-operator-system"))
 	})
 
 	It("Fails on bad API URL", func() {
 		os.Setenv("BW_API_URL", "https:/api.bitwarden.com")
-		os.Setenv("BW_IDENTITY_API_URL", "https://identity.bitwarden.eu")
-		os.Setenv("BW_SECRETS_MANAGER_STATE_PATH", "~/state")
-		os.Setenv("BW_SECRETS_MANAGER_REFRESH_INTERVAL", "180")
-
-		bwApi, identityApi, statePath, refreshInterval, err := GetSettings()
-
-		Expect(bwApi).Should(BeNil())
-		Expect(identityApi).Should(BeNil())
-		Expect(statePath).Should(BeNil())
-		Expect(refreshInterval).Should(BeNil())
-		Expect(err).ShouldNot(BeNil())
-		Expect(err.Error()).Should(Equal("Bitwarden API URL is not valid.  Value supplied: https:/api.bitwarden.com"))
+		_, err := LoadConfig("", "")
+		Expect(err).Should(MatchError(ContainSubstring("bitwarden.apiUrl is not a valid URL")))
 
 		os.Setenv("BW_API_URL", ".bitwarden.")
-
-		bwApi, identityApi, statePath, refreshInterval, err = GetSettings()
-
-		Expect(bwApi).Should(BeNil())
-		Expect(identityApi).Should(BeNil())
-		Expect(statePath).Should(BeNil())
-		Expect(refreshInterval).Should(BeNil())
-		Expect(err).ShouldNot(BeNil())
-		Expect(err.Error()).Should(Equal("parse \".bitwarden.\": invalid URI for request"))
+		_, err = LoadConfig("", "")
+		Expect(err).Should(MatchError(ContainSubstring("bitwarden.apiUrl is not a valid URL")))
 	})
 
 	It("Fails on bad Identity URL", func() {
-		os.Setenv("BW_API_URL", "https://identity.bitwarden.eu")
 		os.Setenv("BW_IDENTITY_API_URL", "https:/identity.bitwarden.com")
-		os.Setenv("BW_SECRETS_MANAGER_STATE_PATH", "~/state")
-		os.Setenv("BW_SECRETS_MANAGER_REFRESH_INTERVAL", "180")
+		_, err := LoadConfig("", "")
+		Expect(err).Should(MatchError(ContainSubstring("bitwarden.identityApiUrl is not a valid URL")))
+	})
 
-		bwApi, identityApi, statePath, refreshInterval, err := GetSettings()
+	It("Pulls with defaulted refresh interval", func() {
+		os.Setenv("BW_SECRETS_MANAGER_REFRESH_INTERVAL", "179")
+		operatorConfig, err := LoadConfig("", "")
+		Expect(err).Should(BeNil())
+		Expect(operatorConfig.Sync.RefreshIntervalSeconds).Should(Equal(300))
 
-		Expect(bwApi).Should(BeNil())
-		Expect(identityApi).Should(BeNil())
-		Expect(statePath).Should(BeNil())
-		Expect(refreshInterval).Should(BeNil())
-		Expect(err).ShouldNot(BeNil())
-		Expect(err.Error()).Should(Equal("Bitwarden Identity URL is not valid.  Value supplied: https:/identity.bitwarden.com"))
+		os.Setenv("BW_SECRETS_MANAGER_REFRESH_INTERVAL", "abc")
+		operatorConfig, err = LoadConfig("", "")
+		Expect(err).Should(BeNil())
+		Expect(operatorConfig.Sync.RefreshIntervalSeconds).Should(Equal(300))
+	})
+
+	It("Fails on invalid values instead of defaulting them", func() {
+		os.Setenv("BW_SECRETS_MANAGER_CALL_TIMEOUT", "0")
+		os.Setenv("BW_SECRETS_MANAGER_READINESS_CHECK", "sometimes")
+		_, err := LoadConfig("", "")
+		Expect(err).Should(MatchError(ContainSubstring("bitwarden.callTimeoutSeconds must be positive")))
+		Expect(err).Should(MatchError(ContainSubstring("BW_SECRETS_MANAGER_READINESS_CHECK must be true or false")))
+	})
 
-		os.Setenv("BW_IDENTITY_API_URL", ".bitwarden.")
+	It("Reads the configuration file with env overrides", func() {
+		configFile := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(configFile, []byte(`apiVersion: config.k8s.bitwarden.com/v1alpha1
+kind: OperatorConfig
+bitwarden:
+  apiUrl: https://vault.example.com/api
+  identityApiUrl: https://vault.example.com/identity
+sync:
+  refreshIntervalSeconds: 600
+`), 0o600)).Should(Succeed())
+
+		os.Setenv("BW_SECRETS_MANAGER_REFRESH_INTERVAL", "900")
+		operatorConfig, err := LoadConfig(configFile, "")
+		Expect(err).Should(BeNil())
+		Expect(operatorConfig.Bitwarden.ApiUrl).Should(Equal("https://vault.example.com/api"))
+		Expect(operatorConfig.Sync.RefreshIntervalSeconds).Should(Equal(900))
+	})
+
+	It("Restricts the watched namespaces", func() {
+		os.Setenv("BW_SECRETS_MANAGER_WATCH_NAMESPACES", "team-a")
+		operatorConfig, err := LoadConfig("", "")
+		Expect(err).Should(BeNil())
+		Expect(operatorConfig.WatchNamespaces).Should(Equal([]string{"team-a"}))
+
+		// The flag takes precedence over the environment
+		operatorConfig, err = LoadConfig("", " team-b, team-c ,")
+		Expect(err).Should(BeNil())
+		Expect(operatorConfig.WatchNamespaces).Should(Equal([]string{"team-b", "team-c"}))
 
-		bwApi, identityApi, statePath, refreshInterval, err = GetSettings()
+		_, err = LoadConfig("", "Team_B")
+		Expect(err).Should(MatchError(ContainSubstring(`invalid namespace "Team_B"`)))
+	})
 
-		Expect(bwApi).Should(BeNil())
-		Expect(identityApi).Should(BeNil())
-		Expect(statePath).Should(BeNil())
-		Expect(refreshInterval).Should(BeNil())
+	It("Fails on a missing configuration file", func() {
+		_, err := LoadConfig(filepath.Join(GinkgoT().TempDir(), "missing.yaml"), "")
 		Expect(err).ShouldNot(BeNil())
-		Expect(err.Error()).Should(Equal("parse \".bitwarden.\": invalid URI for request"))
 	})
 
-	It("Pulls with defaulted refresh interval", func() {
-		os.Setenv("BW_API_URL", "")
-		os.Setenv("BW_IDENTITY_API_URL", "")
-		os.Setenv("BW_SECRETS_MANAGER_STATE_PATH", "")
-		os.Setenv("BW_SECRETS_MANAGER_REFRESH_INTERVAL", "179")
-		apiUri, identityUri, statePath, refreshInterval, err := GetSettings()
-		Expect(*apiUri).Should(Equal("https://api.bitwarden.com"))
-		Expect(*identityUri).Should(Equal("https://identity.bitwarden.com"))
-		Expect(*statePath).Should(Equal("/var/bitwarden/state"))
-		Expect(*refreshInterval).Should(Equal(300))
+	AfterAll(func() {
+		for _, name := range envVars {
+			os.Unsetenv(name)
+		}
+	})
+})
+
+var _ = Describe("Get state encryption key", func() {
+
+	It("Returns no key when no key file is configured", func() {
+		key, err := GetStateEncryptionKey("")
+		Expect(key).Should(BeNil())
 		Expect(err).Should(BeNil())
+	})
 
-		os.Setenv("BW_SECRETS_MANAGER_REFRESH_INTERVAL", "abc")
-		apiUri, identityUri, statePath, refreshInterval, err = GetSettings()
-		Expect(*apiUri).Should(Equal("https://api.bitwarden.com"))
-		Expect(*identityUri).Should(Equal("https://identity.bitwarden.com"))
-		Expect(*statePath).Should(Equal("/var/bitwarden/state"))
-		Expect(*refreshInterval).Should(Equal(300))
+	It("Reads the key from the key file", func() {
+		keyFile := filepath.Join(GinkgoT().TempDir(), "key")
+		Expect(os.WriteFile(keyFile, []byte("0123456789abcdef0123456789abcdef\n"), 0o600)).Should(Succeed())
+
+		key, err := GetStateEncryptionKey(keyFile)
+		Expect(string(key)).Should(Equal("0123456789abcdef0123456789abcdef"))
 		Expect(err).Should(BeNil())
 	})
+
+	It("Fails on a short key", func() {
+		keyFile := filepath.Join(GinkgoT().TempDir(), "key")
+		Expect(os.WriteFile(keyFile, []byte("too-short"), 0o600)).Should(Succeed())
+
+		key, err := GetStateEncryptionKey(keyFile)
+		Expect(key).Should(BeNil())
+		Expect(err).ShouldNot(BeNil())
+	})
+
+	It("Fails on a missing key file", func() {
+		key, err := GetStateEncryptionKey(filepath.Join(GinkgoT().TempDir(), "missing"))
+		Expect(key).Should(BeNil())
+		Expect(err).ShouldNot(BeNil())
+	})
 })
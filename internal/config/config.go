@@ -0,0 +1,390 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+// Package config loads and validates the operator configuration file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	APIVersion = "config.k8s.bitwarden.com/v1alpha1"
+	Kind       = "OperatorConfig"
+
+	// The shortest refresh interval accepted, to protect the Bitwarden API
+	MinRefreshIntervalSeconds = 180
+)
+
+// OperatorConfig is the configuration of the operator. Every setting has a default, so an empty file
+// with only apiVersion and kind is valid.
+type OperatorConfig struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	Bitwarden       BitwardenConfig      `json:"bitwarden"`
+	State           StateConfig          `json:"state"`
+	Sync            SyncConfig           `json:"sync"`
+	CircuitBreaker  CircuitBreakerConfig `json:"circuitBreaker"`
+	WatchNamespaces []string             `json:"watchNamespaces,omitempty"`
+	Sharding        ShardingConfig       `json:"sharding"`
+	Logging         LoggingConfig        `json:"logging"`
+	Injection       InjectionConfig      `json:"injection"`
+	Features        FeaturesConfig       `json:"features"`
+}
+
+type BitwardenConfig struct {
+	ApiUrl         string `json:"apiUrl"`
+	IdentityApiUrl string `json:"identityApiUrl"`
+	// How long a single call to the Bitwarden API may take. Reloadable.
+	CallTimeoutSeconds int `json:"callTimeoutSeconds"`
+}
+
+type StateConfig struct {
+	Path string `json:"path"`
+	// File holding the key that encrypts the SDK state files at rest. The state is stored unencrypted when empty.
+	EncryptionKeyFile string `json:"encryptionKeyFile,omitempty"`
+}
+
+type SyncConfig struct {
+	// How often every BitwardenSecret is synced. Reloadable.
+	RefreshIntervalSeconds int `json:"refreshIntervalSeconds"`
+	// Number of BitwardenSecrets synced in parallel
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles"`
+}
+
+type CircuitBreakerConfig struct {
+	// Consecutive failures after which calls to the Bitwarden API are suspended; 0 disables the circuit breaker. Reloadable.
+	FailureThreshold int `json:"failureThreshold"`
+	// How often a suspended Bitwarden API is probed. Reloadable.
+	ProbeIntervalSeconds int `json:"probeIntervalSeconds"`
+}
+
+type ShardingConfig struct {
+	// Number of shards the BitwardenSecrets are split into; 0 disables sharding. With sharding, every replica
+	// syncs the BitwardenSecrets of the shards it holds a lease for, instead of only the leader syncing all of them.
+	Shards int `json:"shards"`
+	// Namespace of the shard leases. Defaults to the namespace the operator runs in.
+	LeaseNamespace string `json:"leaseNamespace,omitempty"`
+}
+
+type InjectionConfig struct {
+	// Image of the init container injecting data into pods, normally the image of the operator
+	Image string `json:"image,omitempty"`
+	// Base URL the init containers reach the delivery API of the operator at, through its webhook service
+	DeliveryUrl string `json:"deliveryUrl,omitempty"`
+}
+
+type LoggingConfig struct {
+	// Replace organization and secret IDs in log messages with a hash of them. Reloadable.
+	RedactIdentifiers bool `json:"redactIdentifiers"`
+}
+
+type FeaturesConfig struct {
+	Webhooks bool `json:"webhooks"`
+	// Only report the operator ready while Bitwarden can be reached. The webhooks are unavailable while it is not.
+	ReadinessCheck bool `json:"readinessCheck"`
+	// Restart the workloads consuming a synced secret when its data changes
+	Reloader bool `json:"reloader"`
+	// Publish the workloads and pods consuming each synced secret in the status of its BitwardenSecret
+	ConsumerTracking bool `json:"consumerTracking"`
+	// Keep pods referencing the secrets of BitwardenSecrets from becoming ready until those are synced.
+	// Requires the webhooks.
+	ReadinessGates bool `json:"readinessGates"`
+	// Inject the data of BitwardenSecrets into annotated pods without writing it to Kubernetes secrets.
+	// Requires the webhooks and the injection settings.
+	Injection bool `json:"injection"`
+	// Serve the data of BitwardenSecrets to clients allowed to get their data subresource, through the
+	// delivery API on the webhook server. Requires the webhooks.
+	DeliveryApi bool `json:"deliveryApi"`
+}
+
+// Default returns the configuration used when no configuration file is given.
+func Default() *OperatorConfig {
+	return &OperatorConfig{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Bitwarden: BitwardenConfig{
+			ApiUrl:             "https://api.bitwarden.com",
+			IdentityApiUrl:     "https://identity.bitwarden.com",
+			CallTimeoutSeconds: 30,
+		},
+		State: StateConfig{
+			Path: "/var/bitwarden/state",
+		},
+		Sync: SyncConfig{
+			RefreshIntervalSeconds:  300,
+			MaxConcurrentReconciles: 1,
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold:     5,
+			ProbeIntervalSeconds: 60,
+		},
+		Features: FeaturesConfig{
+			Webhooks: true,
+		},
+	}
+}
+
+// Load reads the configuration file at path, applies the environment variable overrides and validates
+// the result. Unknown fields are rejected, so that typos are not silently ignored.
+func Load(path string) (*OperatorConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data, os.LookupEnv)
+}
+
+// Parse decodes a configuration file on top of the defaults, applies the environment variable overrides
+// returned by lookupEnv and validates the result.
+func Parse(data []byte, lookupEnv func(string) (string, bool)) (*OperatorConfig, error) {
+	config := Default()
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("invalid operator configuration: %w", err)
+	}
+
+	if config.APIVersion != APIVersion || config.Kind != Kind {
+		return nil, fmt.Errorf("unsupported operator configuration %s/%s, expected %s/%s", config.APIVersion, config.Kind, APIVersion, Kind)
+	}
+
+	if err := config.overrideAndValidate(lookupEnv); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// FromEnv returns the defaults with the environment variable overrides, for running without a configuration file.
+func FromEnv(lookupEnv func(string) (string, bool)) (*OperatorConfig, error) {
+	config := Default()
+	if err := config.overrideAndValidate(lookupEnv); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// overrideAndValidate applies the environment variable overrides and reports every invalid setting at once.
+func (c *OperatorConfig) overrideAndValidate(lookupEnv func(string) (string, bool)) error {
+	return errors.Join(c.ApplyEnvOverrides(lookupEnv), c.Validate())
+}
+
+// ApplyEnvOverrides replaces settings with the environment variables that are set and not empty.
+func (c *OperatorConfig) ApplyEnvOverrides(lookupEnv func(string) (string, bool)) error {
+	var errs []error
+
+	lookup := func(name string) (string, bool) {
+		value, ok := lookupEnv(name)
+		value = strings.TrimSpace(value)
+		return value, ok && value != ""
+	}
+	overrideString := func(name string, setting *string) {
+		if value, ok := lookup(name); ok {
+			*setting = value
+		}
+	}
+	overrideInt := func(name string, setting *int) {
+		if value, ok := lookup(name); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a number, got %q", name, value))
+				return
+			}
+			*setting = parsed
+		}
+	}
+	overrideList := func(name string, setting *[]string) {
+		if value, ok := lookup(name); ok {
+			*setting = SplitList(value)
+		}
+	}
+	overrideBool := func(name string, setting *bool) {
+		if value, ok := lookup(name); ok {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be true or false, got %q", name, value))
+				return
+			}
+			*setting = parsed
+		}
+	}
+
+	overrideRefreshInterval := func(name string, setting *int) {
+		if value, ok := lookup(name); ok {
+			// Deployments configured through the environment ran with an invalid refresh interval before the
+			// configuration file was validated, so it is ignored with an error rather than stopping the operator
+			logger := log.Log.WithName("config")
+			parsed, err := strconv.Atoi(value)
+			switch {
+			case err != nil:
+				logger.Error(err, fmt.Sprintf("Invalid refresh interval supplied in %s. Keeping %d seconds.", name, *setting), "value", value)
+			case parsed < MinRefreshIntervalSeconds:
+				logger.Info(fmt.Sprintf("Refresh interval in %s is below the minimum allowed value of %d seconds. Keeping %d seconds.", name, MinRefreshIntervalSeconds, *setting), "value", parsed)
+			default:
+				*setting = parsed
+			}
+		}
+	}
+
+	overrideString("BW_API_URL", &c.Bitwarden.ApiUrl)
+	overrideString("BW_IDENTITY_API_URL", &c.Bitwarden.IdentityApiUrl)
+	overrideInt("BW_SECRETS_MANAGER_CALL_TIMEOUT", &c.Bitwarden.CallTimeoutSeconds)
+	overrideString("BW_SECRETS_MANAGER_STATE_PATH", &c.State.Path)
+	overrideString("BW_SECRETS_MANAGER_STATE_ENCRYPTION_KEY_FILE", &c.State.EncryptionKeyFile)
+	overrideRefreshInterval("BW_SECRETS_MANAGER_REFRESH_INTERVAL", &c.Sync.RefreshIntervalSeconds)
+	overrideInt("BW_SECRETS_MANAGER_MAX_CONCURRENT_RECONCILES", &c.Sync.MaxConcurrentReconciles)
+	overrideInt("BW_SECRETS_MANAGER_CIRCUIT_BREAKER_THRESHOLD", &c.CircuitBreaker.FailureThreshold)
+	overrideInt("BW_SECRETS_MANAGER_CIRCUIT_BREAKER_PROBE_INTERVAL", &c.CircuitBreaker.ProbeIntervalSeconds)
+	overrideList("BW_SECRETS_MANAGER_WATCH_NAMESPACES", &c.WatchNamespaces)
+	overrideInt("BW_SECRETS_MANAGER_SHARDS", &c.Sharding.Shards)
+	overrideString("BW_SECRETS_MANAGER_SHARD_LEASE_NAMESPACE", &c.Sharding.LeaseNamespace)
+	overrideBool("BW_SECRETS_MANAGER_REDACT_LOGS", &c.Logging.RedactIdentifiers)
+	overrideBool("BW_SECRETS_MANAGER_READINESS_CHECK", &c.Features.ReadinessCheck)
+	overrideBool("BW_SECRETS_MANAGER_RELOADER", &c.Features.Reloader)
+	overrideBool("BW_SECRETS_MANAGER_CONSUMER_TRACKING", &c.Features.ConsumerTracking)
+	overrideBool("BW_SECRETS_MANAGER_READINESS_GATES", &c.Features.ReadinessGates)
+	overrideBool("BW_SECRETS_MANAGER_INJECTION", &c.Features.Injection)
+	overrideString("BW_SECRETS_MANAGER_INJECTION_IMAGE", &c.Injection.Image)
+	overrideString("BW_SECRETS_MANAGER_DELIVERY_URL", &c.Injection.DeliveryUrl)
+	overrideBool("BW_SECRETS_MANAGER_DELIVERY_API", &c.Features.DeliveryApi)
+	overrideBool("ENABLE_WEBHOOKS", &c.Features.Webhooks)
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting of the configuration.
+func (c *OperatorConfig) Validate() error {
+	var errs []error
+
+	if u, err := url.ParseRequestURI(c.Bitwarden.ApiUrl); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("bitwarden.apiUrl is not a valid URL: %q", c.Bitwarden.ApiUrl))
+	}
+	if u, err := url.ParseRequestURI(c.Bitwarden.IdentityApiUrl); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("bitwarden.identityApiUrl is not a valid URL: %q", c.Bitwarden.IdentityApiUrl))
+	}
+	if c.Bitwarden.CallTimeoutSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("bitwarden.callTimeoutSeconds must be positive, got %d", c.Bitwarden.CallTimeoutSeconds))
+	}
+	if c.State.Path == "" {
+		errs = append(errs, fmt.Errorf("state.path must not be empty"))
+	}
+	if c.Sync.RefreshIntervalSeconds < MinRefreshIntervalSeconds {
+		errs = append(errs, fmt.Errorf("sync.refreshIntervalSeconds must be at least %d, got %d", MinRefreshIntervalSeconds, c.Sync.RefreshIntervalSeconds))
+	}
+	if c.Sync.MaxConcurrentReconciles <= 0 {
+		errs = append(errs, fmt.Errorf("sync.maxConcurrentReconciles must be positive, got %d", c.Sync.MaxConcurrentReconciles))
+	}
+	if c.CircuitBreaker.FailureThreshold < 0 {
+		errs = append(errs, fmt.Errorf("circuitBreaker.failureThreshold must not be negative, got %d", c.CircuitBreaker.FailureThreshold))
+	}
+	if c.CircuitBreaker.ProbeIntervalSeconds <= 0 {
+		errs = append(errs, fmt.Errorf("circuitBreaker.probeIntervalSeconds must be positive, got %d", c.CircuitBreaker.ProbeIntervalSeconds))
+	}
+	if c.Sharding.Shards < 0 {
+		errs = append(errs, fmt.Errorf("sharding.shards must not be negative, got %d", c.Sharding.Shards))
+	}
+	if c.Sharding.LeaseNamespace != "" {
+		if problems := validation.IsDNS1123Label(c.Sharding.LeaseNamespace); len(problems) > 0 {
+			errs = append(errs, fmt.Errorf("sharding.leaseNamespace is not a valid namespace %q: %s", c.Sharding.LeaseNamespace, strings.Join(problems, "; ")))
+		}
+	}
+	if c.Features.Injection {
+		if !c.Features.Webhooks {
+			errs = append(errs, fmt.Errorf("features.injection requires features.webhooks"))
+		}
+		if c.Injection.Image == "" {
+			errs = append(errs, fmt.Errorf("injection.image must be set when features.injection is enabled"))
+		}
+		if u, err := url.ParseRequestURI(c.Injection.DeliveryUrl); err != nil || u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("injection.deliveryUrl is not a valid HTTPS URL: %q", c.Injection.DeliveryUrl))
+		}
+	}
+	if c.Features.DeliveryApi && !c.Features.Webhooks {
+		errs = append(errs, fmt.Errorf("features.deliveryApi requires features.webhooks"))
+	}
+	for _, namespace := range c.WatchNamespaces {
+		if problems := validation.IsDNS1123Label(namespace); len(problems) > 0 {
+			errs = append(errs, fmt.Errorf("watchNamespaces contains invalid namespace %q: %s", namespace, strings.Join(problems, "; ")))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SplitList splits a comma separated list, dropping empty items.
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (c *OperatorConfig) CallTimeout() time.Duration {
+	return time.Duration(c.Bitwarden.CallTimeoutSeconds) * time.Second
+}
+
+func (c *OperatorConfig) CircuitBreakerProbeInterval() time.Duration {
+	return time.Duration(c.CircuitBreaker.ProbeIntervalSeconds) * time.Second
+}
+
+// RestartRequired returns the settings that differ between the configurations and only take effect
+// when the operator restarts.
+func (c *OperatorConfig) RestartRequired(other *OperatorConfig) []string {
+	var changed []string
+	if c.Bitwarden.ApiUrl != other.Bitwarden.ApiUrl {
+		changed = append(changed, "bitwarden.apiUrl")
+	}
+	if c.Bitwarden.IdentityApiUrl != other.Bitwarden.IdentityApiUrl {
+		changed = append(changed, "bitwarden.identityApiUrl")
+	}
+	if c.State != other.State {
+		changed = append(changed, "state")
+	}
+	if c.Sync.MaxConcurrentReconciles != other.Sync.MaxConcurrentReconciles {
+		changed = append(changed, "sync.maxConcurrentReconciles")
+	}
+	if !slices.Equal(c.WatchNamespaces, other.WatchNamespaces) {
+		changed = append(changed, "watchNamespaces")
+	}
+	if c.Sharding != other.Sharding {
+		changed = append(changed, "sharding")
+	}
+	if c.Injection != other.Injection {
+		changed = append(changed, "injection")
+	}
+	if c.Features != other.Features {
+		changed = append(changed, "features")
+	}
+	return changed
+}
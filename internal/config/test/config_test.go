@@ -0,0 +1,229 @@
+package config_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bitwarden/sm-kubernetes/internal/config"
+)
+
+const header = `apiVersion: config.k8s.bitwarden.com/v1alpha1
+kind: OperatorConfig
+`
+
+func noEnv(string) (string, bool) {
+	return "", false
+}
+
+var _ = Describe("Operator Config Tests", func() {
+	It("should default every setting that is not in the file", func() {
+		operatorConfig, err := config.Parse([]byte(header), noEnv)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operatorConfig).To(Equal(config.Default()))
+	})
+
+	It("should read every setting", func() {
+		operatorConfig, err := config.Parse([]byte(header+`bitwarden:
+  apiUrl: https://vault.example.com/api
+  identityApiUrl: https://vault.example.com/identity
+  callTimeoutSeconds: 10
+state:
+  path: /state
+  encryptionKeyFile: /keys/state
+sync:
+  refreshIntervalSeconds: 600
+  maxConcurrentReconciles: 4
+circuitBreaker:
+  failureThreshold: 0
+  probeIntervalSeconds: 30
+watchNamespaces:
+- team-a
+- team-b
+sharding:
+  shards: 4
+  leaseNamespace: sm-operator-system
+injection:
+  image: bitwarden/sm-operator:1.0.0
+  deliveryUrl: https://sm-operator-webhook-service.sm-operator-system.svc
+logging:
+  redactIdentifiers: true
+features:
+  webhooks: false
+  readinessCheck: true
+  reloader: true
+  consumerTracking: true
+  readinessGates: true
+`), noEnv)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operatorConfig.Bitwarden).To(Equal(config.BitwardenConfig{
+			ApiUrl:             "https://vault.example.com/api",
+			IdentityApiUrl:     "https://vault.example.com/identity",
+			CallTimeoutSeconds: 10,
+		}))
+		Expect(operatorConfig.State).To(Equal(config.StateConfig{Path: "/state", EncryptionKeyFile: "/keys/state"}))
+		Expect(operatorConfig.Sync).To(Equal(config.SyncConfig{RefreshIntervalSeconds: 600, MaxConcurrentReconciles: 4}))
+		Expect(operatorConfig.CircuitBreaker).To(Equal(config.CircuitBreakerConfig{FailureThreshold: 0, ProbeIntervalSeconds: 30}))
+		Expect(operatorConfig.WatchNamespaces).To(Equal([]string{"team-a", "team-b"}))
+		Expect(operatorConfig.Sharding).To(Equal(config.ShardingConfig{Shards: 4, LeaseNamespace: "sm-operator-system"}))
+		Expect(operatorConfig.Injection).To(Equal(config.InjectionConfig{
+			Image:       "bitwarden/sm-operator:1.0.0",
+			DeliveryUrl: "https://sm-operator-webhook-service.sm-operator-system.svc",
+		}))
+		Expect(operatorConfig.Logging.RedactIdentifiers).To(BeTrue())
+		Expect(operatorConfig.Features).To(Equal(config.FeaturesConfig{Webhooks: false, ReadinessCheck: true, Reloader: true, ConsumerTracking: true, ReadinessGates: true}))
+	})
+
+	It("should reject unknown settings and versions", func() {
+		_, err := config.Parse([]byte(header+"sync:\n  refreshInterval: 600\n"), noEnv)
+		Expect(err).To(MatchError(ContainSubstring("unknown field")))
+
+		_, err = config.Parse([]byte("apiVersion: config.k8s.bitwarden.com/v2\nkind: OperatorConfig\n"), noEnv)
+		Expect(err).To(MatchError(ContainSubstring("unsupported operator configuration")))
+	})
+
+	It("should report every invalid setting", func() {
+		_, err := config.Parse([]byte(header+`bitwarden:
+  apiUrl: not-a-url
+state:
+  path: ""
+sync:
+  refreshIntervalSeconds: 60
+  maxConcurrentReconciles: 0
+circuitBreaker:
+  failureThreshold: -1
+  probeIntervalSeconds: 0
+watchNamespaces:
+- Team_A
+sharding:
+  shards: -1
+injection:
+  deliveryUrl: http://sm-operator-webhook-service.sm-operator-system.svc
+features:
+  webhooks: false
+  injection: true
+  deliveryApi: true
+`), noEnv)
+		Expect(err).To(MatchError(ContainSubstring("bitwarden.apiUrl is not a valid URL")))
+		Expect(err).To(MatchError(ContainSubstring("state.path must not be empty")))
+		Expect(err).To(MatchError(ContainSubstring("sync.refreshIntervalSeconds must be at least 180")))
+		Expect(err).To(MatchError(ContainSubstring("sync.maxConcurrentReconciles must be positive")))
+		Expect(err).To(MatchError(ContainSubstring("circuitBreaker.failureThreshold must not be negative")))
+		Expect(err).To(MatchError(ContainSubstring("circuitBreaker.probeIntervalSeconds must be positive")))
+		Expect(err).To(MatchError(ContainSubstring(`invalid namespace "Team_A"`)))
+		Expect(err).To(MatchError(ContainSubstring("sharding.shards must not be negative")))
+		Expect(err).To(MatchError(ContainSubstring("features.injection requires features.webhooks")))
+		Expect(err).To(MatchError(ContainSubstring("injection.image must be set")))
+		Expect(err).To(MatchError(ContainSubstring("injection.deliveryUrl is not a valid HTTPS URL")))
+		Expect(err).To(MatchError(ContainSubstring("features.deliveryApi requires features.webhooks")))
+	})
+
+	It("should let environment variables override the file", func() {
+		env := map[string]string{
+			"BW_SECRETS_MANAGER_REFRESH_INTERVAL": "900",
+			"BW_SECRETS_MANAGER_REDACT_LOGS":      "true",
+			"ENABLE_WEBHOOKS":                     "false",
+			"BW_API_URL":                          "",
+		}
+		lookupEnv := func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		}
+
+		operatorConfig, err := config.Parse([]byte(header+"sync:\n  refreshIntervalSeconds: 600\n"), lookupEnv)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operatorConfig.Sync.RefreshIntervalSeconds).To(Equal(900))
+		Expect(operatorConfig.Logging.RedactIdentifiers).To(BeTrue())
+		Expect(operatorConfig.Features.Webhooks).To(BeFalse())
+		// Empty variables are ignored
+		Expect(operatorConfig.Bitwarden.ApiUrl).To(Equal("https://api.bitwarden.com"))
+	})
+
+	It("should keep the refresh interval when the environment variable is invalid", func() {
+		for _, value := range []string{"60", "not-a-number"} {
+			lookupEnv := func(name string) (string, bool) {
+				if name == "BW_SECRETS_MANAGER_REFRESH_INTERVAL" {
+					return value, true
+				}
+				return "", false
+			}
+
+			operatorConfig, err := config.Parse([]byte(header), lookupEnv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(operatorConfig.Sync.RefreshIntervalSeconds).To(Equal(300))
+
+			operatorConfig, err = config.Parse([]byte(header+"sync:\n  refreshIntervalSeconds: 600\n"), lookupEnv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(operatorConfig.Sync.RefreshIntervalSeconds).To(Equal(600))
+		}
+	})
+
+	It("should list the changed settings that require a restart", func() {
+		initial := config.Default()
+		changed := config.Default()
+		changed.Sync.RefreshIntervalSeconds = 600
+		changed.Logging.RedactIdentifiers = true
+		Expect(initial.RestartRequired(changed)).To(BeEmpty())
+
+		changed.Sync.MaxConcurrentReconciles = 2
+		changed.WatchNamespaces = []string{"team-a"}
+		changed.Sharding.Shards = 4
+		Expect(initial.RestartRequired(changed)).To(ConsistOf("sync.maxConcurrentReconciles", "watchNamespaces", "sharding"))
+	})
+})
+
+var _ = Describe("Operator Config Watcher Tests", func() {
+	var (
+		configFile string
+		reloaded   []*config.OperatorConfig
+		watcher    *config.Watcher
+	)
+
+	writeConfig := func(content string) {
+		Expect(os.WriteFile(configFile, []byte(content), 0o600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		configFile = filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		writeConfig(header)
+		reloaded = nil
+
+		initial, err := config.Load(configFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		watcher, err = config.NewWatcher(configFile, time.Hour, initial, func(c *config.OperatorConfig) {
+			reloaded = append(reloaded, c)
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should apply a changed configuration once", func() {
+		watcher.Reload(context.Background())
+		Expect(reloaded).To(BeEmpty())
+
+		writeConfig(header + "sync:\n  refreshIntervalSeconds: 600\n")
+		watcher.Reload(context.Background())
+		watcher.Reload(context.Background())
+		Expect(reloaded).To(HaveLen(1))
+		Expect(reloaded[0].Sync.RefreshIntervalSeconds).To(Equal(600))
+	})
+
+	It("should keep the current configuration when the file is invalid", func() {
+		writeConfig(header + "sync:\n  refreshIntervalSeconds: 60\n")
+		watcher.Reload(context.Background())
+		Expect(reloaded).To(BeEmpty())
+
+		Expect(os.Remove(configFile)).To(Succeed())
+		watcher.Reload(context.Background())
+		Expect(reloaded).To(BeEmpty())
+
+		writeConfig(header + "sync:\n  refreshIntervalSeconds: 240\n")
+		watcher.Reload(context.Background())
+		Expect(reloaded).To(HaveLen(1))
+		Expect(reloaded[0].Sync.RefreshIntervalSeconds).To(Equal(240))
+	})
+})
@@ -0,0 +1,109 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Watcher reloads the configuration file when it changes and hands the new configuration to OnChange.
+//
+// The file is polled rather than watched for events, since ConfigMap volumes are updated by swapping a
+// symlink. A file that fails to parse or validate is logged and ignored, keeping the current configuration.
+// Settings that differ from the configuration the operator started with and can only be applied on startup
+// are logged as requiring a restart; OnChange still receives them and is expected to apply only the
+// reloadable ones.
+type Watcher struct {
+	Path     string
+	Interval time.Duration
+	OnChange func(*OperatorConfig)
+
+	initial *OperatorConfig
+	data    []byte
+}
+
+func NewWatcher(path string, interval time.Duration, initial *OperatorConfig, onChange func(*OperatorConfig)) (*Watcher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watcher{
+		Path:     path,
+		Interval: interval,
+		OnChange: onChange,
+		initial:  initial,
+		data:     data,
+	}, nil
+}
+
+// Start implements manager.Runnable.
+func (w *Watcher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			w.Reload(ctx)
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every replica applies the configuration.
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Reload reads the configuration file and applies it when its content changed.
+func (w *Watcher) Reload(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("config-watcher").WithValues("path", w.Path)
+
+	data, err := os.ReadFile(w.Path)
+	if err != nil {
+		logger.Error(err, "Failed to read the operator configuration. Keeping the current configuration.")
+		return
+	}
+	if bytes.Equal(data, w.data) {
+		return
+	}
+	w.data = data
+
+	config, err := Parse(data, os.LookupEnv)
+	if err != nil {
+		logger.Error(err, "Invalid operator configuration. Keeping the current configuration.")
+		return
+	}
+
+	if changed := w.initial.RestartRequired(config); len(changed) > 0 {
+		logger.Info("Some changed settings only take effect when the operator restarts", "settings", changed)
+	}
+
+	logger.Info("Reloaded the operator configuration")
+	w.OnChange(config)
+}
@@ -0,0 +1,119 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointChecker is a readiness check that verifies a Bitwarden endpoint can be reached.
+//
+// It requests the /alive path of the endpoint and fails when the request errors or the endpoint answers
+// with a server error. The outcome is cached for CacheTTL, so frequent probes by the kubelet do not
+// translate into requests to Bitwarden. Every outcome is also published as the bitwarden_endpoint_reachable
+// metric, and running the checker as a runnable of the manager keeps the metric current without probes.
+type EndpointChecker struct {
+	URL      string
+	Client   *http.Client
+	CacheTTL time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	lastErr   error
+}
+
+func NewEndpointChecker(baseUrl string, timeout time.Duration, cacheTTL time.Duration) *EndpointChecker {
+	return &EndpointChecker{
+		URL:      strings.TrimSuffix(baseUrl, "/") + "/alive",
+		Client:   &http.Client{Timeout: timeout},
+		CacheTTL: cacheTTL,
+	}
+}
+
+// Check implements healthz.Checker. Concurrent checks wait for a single request to the endpoint.
+func (c *EndpointChecker) Check(req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.CacheTTL {
+		return c.lastErr
+	}
+
+	return c.refresh(req.Context())
+}
+
+// Start checks the endpoint every CacheTTL, which must be positive, until the context is cancelled.
+func (c *EndpointChecker) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.CacheTTL)
+	defer ticker.Stop()
+
+	for {
+		c.mu.Lock()
+		_ = c.refresh(ctx)
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection returns false because every replica reports whether it can reach Bitwarden.
+func (c *EndpointChecker) NeedLeaderElection() bool {
+	return false
+}
+
+// refresh checks the endpoint and records the outcome. The caller holds mu.
+func (c *EndpointChecker) refresh(ctx context.Context) error {
+	c.lastErr = c.probe(ctx)
+	c.checkedAt = time.Now()
+	if c.lastErr != nil {
+		endpointReachable.WithLabelValues(c.URL).Set(0)
+	} else {
+		endpointReachable.WithLabelValues(c.URL).Set(1)
+	}
+	return c.lastErr
+}
+
+func (c *EndpointChecker) probe(ctx context.Context) error {
+	probeReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Client.Do(probeReq)
+	if err != nil {
+		return fmt.Errorf("bitwarden endpoint %s is not reachable: %w", c.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("bitwarden endpoint %s answered with %s", c.URL, resp.Status)
+	}
+	return nil
+}
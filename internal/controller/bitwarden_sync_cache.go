@@ -0,0 +1,177 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	"golang.org/x/sync/singleflight"
+)
+
+// How long the secrets returned for an organization and token are remembered after their last sync
+const syncHistoryRetention = 24 * time.Hour
+
+type syncCacheEntry struct {
+	response  *sdk.SecretsSyncResponse
+	expiresAt time.Time
+}
+
+// syncHistory tracks when the set of secrets returned for an organization and token last changed, which the
+// revision dates of the secrets do not show for deleted secrets or secrets the machine account lost or gained
+// access to.
+type syncHistory struct {
+	secretIds string
+	// Changes before the first sync are unknown
+	firstSynced time.Time
+	changed     time.Time
+	lastSynced  time.Time
+}
+
+// SyncCache shares full Secrets Manager syncs between BitwardenSecrets that use the same organization and
+// machine account token. Concurrent requests for the same pair wait for a single call to the API, and the
+// result is served to later requests until it is older than the TTL. Errors are never cached.
+//
+// Since the cached syncs are full syncs shared between BitwardenSecrets with different last sync times, the
+// callers find out themselves whether anything changed for them, from the revision dates of the secrets and
+// SecretsChangedSince.
+type SyncCache struct {
+	TTL time.Duration
+
+	group   singleflight.Group
+	mu      sync.Mutex
+	entries map[string]syncCacheEntry
+	history map[string]*syncHistory
+}
+
+func NewSyncCache(ttl time.Duration) *SyncCache {
+	return &SyncCache{
+		TTL:     ttl,
+		entries: map[string]syncCacheEntry{},
+		history: map[string]*syncHistory{},
+	}
+}
+
+// Sync returns the cached sync of the organization for the token, or calls fetch to perform it. The
+// returned response is shared and must not be modified.
+func (c *SyncCache) Sync(orgId string, authToken string, fetch func() (*sdk.SecretsSyncResponse, error)) (*sdk.SecretsSyncResponse, error) {
+	key := syncCacheKey(orgId, authToken)
+
+	if response, ok := c.lookup(key); ok {
+		syncCacheHits.Inc()
+		return response, nil
+	}
+
+	fetched := false
+	result, err, _ := c.group.Do(key, func() (any, error) {
+		fetched = true
+
+		response, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		c.mu.Lock()
+		c.evictExpiredLocked()
+		c.entries[key] = syncCacheEntry{response: response, expiresAt: now.Add(c.TTL)}
+		c.recordHistoryLocked(key, response, now)
+		c.mu.Unlock()
+
+		return response, nil
+	})
+
+	// Requests that joined a call already in flight did not reach the API either
+	if fetched {
+		syncCacheMisses.Inc()
+	} else {
+		syncCacheHits.Inc()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return result.(*sdk.SecretsSyncResponse), nil
+}
+
+// SecretsChangedSince reports whether secrets may have been added to or removed from the syncs of the
+// organization for the token after since. It returns true when the syncs are not known that far back.
+func (c *SyncCache) SecretsChangedSince(orgId string, authToken string, since time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history, ok := c.history[syncCacheKey(orgId, authToken)]
+	return !ok || since.Before(history.firstSynced) || history.changed.After(since)
+}
+
+func syncCacheKey(orgId string, authToken string) string {
+	return orgId + "/" + HashAuthToken(authToken)
+}
+
+func (c *SyncCache) recordHistoryLocked(key string, response *sdk.SecretsSyncResponse, now time.Time) {
+	var ids []string
+	if response != nil {
+		for _, smSecret := range response.Secrets {
+			ids = append(ids, smSecret.ID)
+		}
+	}
+	slices.Sort(ids)
+	secretIds := strings.Join(ids, ",")
+
+	history, ok := c.history[key]
+	if !ok {
+		c.history[key] = &syncHistory{secretIds: secretIds, firstSynced: now, changed: now, lastSynced: now}
+		return
+	}
+	if history.secretIds != secretIds {
+		history.secretIds = secretIds
+		history.changed = now
+	}
+	history.lastSynced = now
+}
+
+func (c *SyncCache) lookup(key string) (*sdk.SecretsSyncResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.response, true
+}
+
+func (c *SyncCache) evictExpiredLocked() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	for key, history := range c.history {
+		if now.Sub(history.lastSynced) > syncHistoryRetention {
+			delete(c.history, key)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Condition set on BitwardenSecrets that were not synced because the circuit breaker of their API and token is open
+	ConditionBitwardenUnavailable = "BitwardenUnavailable"
+	ReasonCircuitOpen             = "CircuitOpen"
+)
+
+// CircuitState is the state of the circuit breaker of an API URL and machine account token
+type CircuitState int
+
+const (
+	// Calls go through
+	CircuitClosed CircuitState = iota
+	// Calls fail right away without reaching the API
+	CircuitOpen
+	// A single probe call goes through to find out whether the API is available again
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitOpenError is returned instead of calling the Bitwarden API while its circuit breaker is open
+type CircuitOpenError struct {
+	ApiUrl string
+	// RetryAfter is how long until the circuit breaker lets the next probe through
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("bitwarden API %s is unavailable after repeated failures; the next attempt is made in %s", e.ApiUrl, e.RetryAfter.Round(time.Second))
+}
+
+// IsCircuitOpenError reports whether err was returned by an open circuit breaker without calling the API.
+func IsCircuitOpenError(err error) bool {
+	var circuitErr *CircuitOpenError
+	return errors.As(err, &circuitErr)
+}
+
+type circuit struct {
+	state     CircuitState
+	failures  int
+	nextProbe time.Time
+}
+
+// CircuitBreakerClientFactory is a BitwardenClientFactory that stops calling the Bitwarden API for an
+// (API URL, token) pair after FailureThreshold consecutive failures to reach the API.
+//
+// While the circuit is open every call fails with a CircuitOpenError. Once ProbeInterval has passed a single
+// caller is let through as a probe: the circuit closes again when it succeeds and stays open for another
+// interval when it fails. Auth and permanent errors show that the API is reachable and close the circuit.
+// A FailureThreshold of 0 disables the circuit breaker.
+type CircuitBreakerClientFactory struct {
+	Factory          BitwardenClientFactory
+	FailureThreshold int
+	ProbeInterval    time.Duration
+
+	mu       sync.Mutex
+	circuits map[clientPoolKey]*circuit
+}
+
+func NewCircuitBreakerClientFactory(factory BitwardenClientFactory, failureThreshold int, probeInterval time.Duration) *CircuitBreakerClientFactory {
+	return &CircuitBreakerClientFactory{
+		Factory:          factory,
+		FailureThreshold: failureThreshold,
+		ProbeInterval:    probeInterval,
+		circuits:         map[clientPoolKey]*circuit{},
+	}
+}
+
+func (f *CircuitBreakerClientFactory) GetBitwardenClient() (sdk.BitwardenClientInterface, error) {
+	client, err := f.Factory.GetBitwardenClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &breakerClient{factory: f, client: client}, nil
+}
+
+func (f *CircuitBreakerClientFactory) GetApiUrl() string {
+	return f.Factory.GetApiUrl()
+}
+
+func (f *CircuitBreakerClientFactory) GetIdentityApiUrl() string {
+	return f.Factory.GetIdentityApiUrl()
+}
+
+// SetSettings changes the failure threshold and probe interval. Open circuits keep their next probe time.
+func (f *CircuitBreakerClientFactory) SetSettings(failureThreshold int, probeInterval time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.FailureThreshold = failureThreshold
+	f.ProbeInterval = probeInterval
+}
+
+// State returns the state of the circuit breaker for the auth token.
+func (f *CircuitBreakerClientFactory) State(authToken string) CircuitState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if c := f.circuits[f.key(authToken)]; c != nil {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+func (f *CircuitBreakerClientFactory) key(authToken string) clientPoolKey {
+	return clientPoolKey{apiUrl: f.GetApiUrl(), tokenHash: HashAuthToken(authToken)}
+}
+
+// allow returns a CircuitOpenError when calls for the key must not reach the API.
+func (f *CircuitBreakerClientFactory) allow(key clientPoolKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.circuits[key]
+	if c == nil || c.state == CircuitClosed || f.FailureThreshold <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if c.state == CircuitOpen && !now.Before(c.nextProbe) {
+		c.state = CircuitHalfOpen
+		f.setStateLocked(key, c.state)
+		return nil
+	}
+
+	// A probe is already in flight
+	retryAfter := f.ProbeInterval
+	if c.state == CircuitOpen {
+		retryAfter = c.nextProbe.Sub(now)
+	}
+	return &CircuitOpenError{ApiUrl: key.apiUrl, RetryAfter: retryAfter}
+}
+
+// check returns a CircuitOpenError when calls for the key must not reach the API, like allow, but leaves the
+// probe to the next call that goes through allow.
+func (f *CircuitBreakerClientFactory) check(key clientPoolKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.circuits[key]
+	if c == nil || c.state == CircuitClosed || f.FailureThreshold <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if c.state == CircuitOpen && !now.Before(c.nextProbe) {
+		return nil
+	}
+
+	retryAfter := f.ProbeInterval
+	if c.state == CircuitOpen {
+		retryAfter = c.nextProbe.Sub(now)
+	}
+	return &CircuitOpenError{ApiUrl: key.apiUrl, RetryAfter: retryAfter}
+}
+
+// record updates the circuit of the key with the outcome of a call.
+func (f *CircuitBreakerClientFactory) record(key clientPoolKey, err error) {
+	logger := log.Log.WithName("circuit-breaker").WithValues("apiUrl", key.apiUrl)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.circuits[key]
+	// Only failures to reach the API count; any answer from it shows that it is available
+	if !IsUnavailableError(err) {
+		if c == nil {
+			return
+		}
+		if c.state != CircuitClosed {
+			logger.Info("Bitwarden API is available again. Closing the circuit breaker.")
+		}
+		delete(f.circuits, key)
+		circuitBreakerState.DeleteLabelValues(key.apiUrl, key.tokenHash)
+		return
+	}
+
+	if c == nil {
+		c = &circuit{}
+		f.circuits[key] = c
+	}
+	c.failures++
+
+	// A failure while the circuit is not closed comes from a probe, or from a login let through once the probe was due
+	if c.state != CircuitClosed || (f.FailureThreshold > 0 && c.failures >= f.FailureThreshold) {
+		c.state = CircuitOpen
+		c.nextProbe = time.Now().Add(f.ProbeInterval)
+		logger.Info("Bitwarden API is unavailable. Opening the circuit breaker.", "consecutiveFailures", c.failures, "probeInterval", f.ProbeInterval, "error", err.Error())
+	}
+	f.setStateLocked(key, c.state)
+}
+
+func (f *CircuitBreakerClientFactory) setStateLocked(key clientPoolKey, state CircuitState) {
+	circuitBreakerState.WithLabelValues(key.apiUrl, key.tokenHash).Set(float64(state))
+}
+
+type breakerClient struct {
+	factory *CircuitBreakerClientFactory
+	client  sdk.BitwardenClientInterface
+	key     clientPoolKey
+}
+
+// withBreaker runs call unless the circuit of the client's token is open, and records its outcome.
+func withBreaker[T any](c *breakerClient, call func(sdk.BitwardenClientInterface) (T, error)) (T, error) {
+	var zero T
+	if err := c.factory.allow(c.key); err != nil {
+		return zero, err
+	}
+
+	result, err := call(c.client)
+	c.factory.record(c.key, err)
+	return result, err
+}
+
+// AccessTokenLogin logs in unless the circuit of the token is open. A successful login is not recorded, since a
+// pooled client reuses an idle session without calling the API: the circuit only closes once a call that
+// reaches the API succeeds, and the login does not take the place of the probe.
+func (c *breakerClient) AccessTokenLogin(accessToken string, stateFile *string) error {
+	c.key = c.factory.key(accessToken)
+	if err := c.factory.check(c.key); err != nil {
+		return err
+	}
+
+	err := c.client.AccessTokenLogin(accessToken, stateFile)
+	if err != nil {
+		c.factory.record(c.key, err)
+	}
+	return err
+}
+
+func (c *breakerClient) Projects() sdk.ProjectsInterface {
+	return &breakerProjects{client: c}
+}
+
+func (c *breakerClient) Secrets() sdk.SecretsInterface {
+	return &breakerSecrets{client: c}
+}
+
+func (c *breakerClient) Generators() sdk.GeneratorsInterface {
+	return &breakerGenerators{client: c}
+}
+
+func (c *breakerClient) Close() {
+	c.client.Close()
+}
+
+func (c *breakerClient) AfterClose(release func()) {
+	afterClose(c.client, release)
+}
+
+type breakerSecrets struct {
+	client *breakerClient
+}
+
+func (s *breakerSecrets) Create(key, value, note string, organizationID string, projectIDs []string) (*sdk.SecretResponse, error) {
+	return withBreaker(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretResponse, error) {
+		return c.Secrets().Create(key, value, note, organizationID, projectIDs)
+	})
+}
+
+func (s *breakerSecrets) List(organizationID string) (*sdk.SecretIdentifiersResponse, error) {
+	return withBreaker(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretIdentifiersResponse, error) {
+		return c.Secrets().List(organizationID)
+	})
+}
+
+func (s *breakerSecrets) Get(secretID string) (*sdk.SecretResponse, error) {
+	return withBreaker(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretResponse, error) {
+		return c.Secrets().Get(secretID)
+	})
+}
+
+func (s *breakerSecrets) GetByIDS(secretIDs []string) (*sdk.SecretsResponse, error) {
+	return withBreaker(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretsResponse, error) {
+		return c.Secrets().GetByIDS(secretIDs)
+	})
+}
+
+func (s *breakerSecrets) Update(secretID string, key, value, note string, organizationID string, projectIDs []string) (*sdk.SecretResponse, error) {
+	return withBreaker(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretResponse, error) {
+		return c.Secrets().Update(secretID, key, value, note, organizationID, projectIDs)
+	})
+}
+
+func (s *breakerSecrets) Delete(secretIDs []string) (*sdk.SecretsDeleteResponse, error) {
+	return withBreaker(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretsDeleteResponse, error) {
+		return c.Secrets().Delete(secretIDs)
+	})
+}
+
+func (s *breakerSecrets) Sync(organizationID string, lastSyncedDate *time.Time) (*sdk.SecretsSyncResponse, error) {
+	return withBreaker(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretsSyncResponse, error) {
+		return c.Secrets().Sync(organizationID, lastSyncedDate)
+	})
+}
+
+type breakerProjects struct {
+	client *breakerClient
+}
+
+func (p *breakerProjects) Create(organizationID string, name string) (*sdk.ProjectResponse, error) {
+	return withBreaker(p.client, func(c sdk.BitwardenClientInterface) (*sdk.ProjectResponse, error) {
+		return c.Projects().Create(organizationID, name)
+	})
+}
+
+func (p *breakerProjects) List(organizationID string) (*sdk.ProjectsResponse, error) {
+	return withBreaker(p.client, func(c sdk.BitwardenClientInterface) (*sdk.ProjectsResponse, error) {
+		return c.Projects().List(organizationID)
+	})
+}
+
+func (p *breakerProjects) Get(projectID string) (*sdk.ProjectResponse, error) {
+	return withBreaker(p.client, func(c sdk.BitwardenClientInterface) (*sdk.ProjectResponse, error) {
+		return c.Projects().Get(projectID)
+	})
+}
+
+func (p *breakerProjects) Update(projectID string, organizationID string, name string) (*sdk.ProjectResponse, error) {
+	return withBreaker(p.client, func(c sdk.BitwardenClientInterface) (*sdk.ProjectResponse, error) {
+		return c.Projects().Update(projectID, organizationID, name)
+	})
+}
+
+func (p *breakerProjects) Delete(projectIDs []string) (*sdk.ProjectsDeleteResponse, error) {
+	return withBreaker(p.client, func(c sdk.BitwardenClientInterface) (*sdk.ProjectsDeleteResponse, error) {
+		return c.Projects().Delete(projectIDs)
+	})
+}
+
+type breakerGenerators struct {
+	client *breakerClient
+}
+
+func (g *breakerGenerators) GeneratePassword(request sdk.PasswordGeneratorRequest) (*string, error) {
+	return withBreaker(g.client, func(c sdk.BitwardenClientInterface) (*string, error) {
+		return c.Generators().GeneratePassword(request)
+	})
+}
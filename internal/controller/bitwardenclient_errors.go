@@ -0,0 +1,104 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The SDK only reports errors as messages, so authentication failures are recognized by what the
+// Bitwarden API and identity service return for rejected or expired tokens.
+var authErrorMarkers = []string{
+	"unauthorized",
+	"invalid_grant",
+	"invalid_client",
+	"access token is not in a valid format",
+	"token has expired",
+}
+
+// A 401 status code is only recognized as a status, since IDs, URLs and sizes in a message may contain "401"
+var authStatusPattern = regexp.MustCompile(`\b(status(?: code)?:?|http(?:/[0-9.]+)?) 401\b`)
+
+// IsAuthError reports whether an error returned by the SDK was caused by a rejected or expired access token.
+func IsAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	message := strings.ToLower(err.Error())
+	if authStatusPattern.MatchString(message) {
+		return true
+	}
+	for _, marker := range authErrorMarkers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Errors of the connection to the Bitwarden API rather than answers from it
+var unavailableErrorMarkers = []string{
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"no such host",
+	"network is unreachable",
+	"no route to host",
+	"i/o timeout",
+	"timed out",
+	"tls handshake",
+	"unexpected eof",
+	"error sending request",
+	"service unavailable",
+	"bad gateway",
+	"gateway timeout",
+	"internal server error",
+}
+
+// 5xx status codes, recognized only as a status for the same reason as authStatusPattern
+var unavailableStatusPattern = regexp.MustCompile(`\b(status(?: code)?:?|http(?:/[0-9.]+)?) 5[0-9][0-9]\b|\b5[0-9][0-9] (internal server error|bad gateway|service unavailable|gateway timeout)\b`)
+
+// IsUnavailableError reports whether an error returned by the SDK means the Bitwarden API could not be reached or
+// failed on its side: a transport error, a timeout or a 5xx status. Errors the API answered with, such as a
+// missing secret or an invalid request, say nothing about its availability.
+func IsUnavailableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsTimeoutError(err) {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	if unavailableStatusPattern.MatchString(message) {
+		return true
+	}
+	for _, marker := range unavailableErrorMarkers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,415 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+)
+
+type clientPoolKey struct {
+	apiUrl    string
+	tokenHash string
+}
+
+type pooledSession struct {
+	key      clientPoolKey
+	client   sdk.BitwardenClientInterface
+	lastUsed time.Time
+	// Sessions created while the pool was full are closed instead of being returned to the pool
+	pooled bool
+	broken bool
+}
+
+// BitwardenClientPool is a BitwardenClientFactory that keeps authenticated SDK clients around between
+// reconciles, so that BitwardenSecrets sharing a machine account token do not log in on every sync.
+//
+// The clients handed out by the pool log in lazily: AccessTokenLogin picks an idle session for the
+// (API URL, token) pair or creates and authenticates a new one, and Close returns the session to the pool.
+// A session is used by one caller at a time. Calls that fail with an authentication error log in again
+// once and are retried, and sessions that cannot be re-authenticated are discarded.
+type BitwardenClientPool struct {
+	Factory BitwardenClientFactory
+	// MaxSize bounds the number of sessions, idle or in use, held by the pool
+	MaxSize int
+	// IdleTimeout is how long an unused session is kept before it is closed
+	IdleTimeout time.Duration
+
+	mu   sync.Mutex
+	idle map[clientPoolKey][]*pooledSession
+	size int
+}
+
+func NewBitwardenClientPool(factory BitwardenClientFactory, maxSize int, idleTimeout time.Duration) *BitwardenClientPool {
+	return &BitwardenClientPool{
+		Factory:     factory,
+		MaxSize:     maxSize,
+		IdleTimeout: idleTimeout,
+		idle:        map[clientPoolKey][]*pooledSession{},
+	}
+}
+
+func (p *BitwardenClientPool) GetBitwardenClient() (sdk.BitwardenClientInterface, error) {
+	return &pooledClient{pool: p}, nil
+}
+
+func (p *BitwardenClientPool) GetApiUrl() string {
+	return p.Factory.GetApiUrl()
+}
+
+func (p *BitwardenClientPool) GetIdentityApiUrl() string {
+	return p.Factory.GetIdentityApiUrl()
+}
+
+// Size returns the number of sessions held by the pool.
+func (p *BitwardenClientPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.size
+}
+
+// Close closes all idle sessions. Sessions in use are closed when they are returned.
+func (p *BitwardenClientPool) Close() {
+	p.mu.Lock()
+	var expired []*pooledSession
+	for key, sessions := range p.idle {
+		expired = append(expired, sessions...)
+		delete(p.idle, key)
+	}
+	p.size -= len(expired)
+	p.mu.Unlock()
+
+	closeSessions(expired)
+}
+
+// checkout returns an idle session for the key, or nil when there is none.
+func (p *BitwardenClientPool) checkout(key clientPoolKey) *pooledSession {
+	p.mu.Lock()
+	expired := p.evictExpiredLocked()
+
+	var session *pooledSession
+	if sessions := p.idle[key]; len(sessions) > 0 {
+		session = sessions[len(sessions)-1]
+		p.idle[key] = sessions[:len(sessions)-1]
+		if len(p.idle[key]) == 0 {
+			delete(p.idle, key)
+		}
+	}
+	p.mu.Unlock()
+
+	closeSessions(expired)
+	return session
+}
+
+// reserve accounts for a new session, making room by closing the least recently used idle session
+// when the pool is full. It returns false when the pool is full of sessions in use.
+func (p *BitwardenClientPool) reserve() bool {
+	p.mu.Lock()
+	expired := p.evictExpiredLocked()
+
+	if p.size >= p.MaxSize {
+		if lru := p.evictLeastRecentlyUsedLocked(); lru != nil {
+			expired = append(expired, lru)
+		}
+	}
+
+	reserved := p.size < p.MaxSize
+	if reserved {
+		p.size++
+	}
+	p.mu.Unlock()
+
+	closeSessions(expired)
+	return reserved
+}
+
+func (p *BitwardenClientPool) unreserve() {
+	p.mu.Lock()
+	p.size--
+	p.mu.Unlock()
+}
+
+// release returns a session to the pool, or closes it when it is broken or was not pooled.
+func (p *BitwardenClientPool) release(session *pooledSession) {
+	if !session.pooled || session.broken {
+		session.client.Close()
+		if session.pooled {
+			p.unreserve()
+		}
+		return
+	}
+
+	session.lastUsed = time.Now()
+
+	p.mu.Lock()
+	p.idle[session.key] = append(p.idle[session.key], session)
+	p.mu.Unlock()
+}
+
+func (p *BitwardenClientPool) evictExpiredLocked() []*pooledSession {
+	var expired []*pooledSession
+	for key, sessions := range p.idle {
+		kept := sessions[:0]
+		for _, session := range sessions {
+			if time.Since(session.lastUsed) > p.IdleTimeout {
+				expired = append(expired, session)
+			} else {
+				kept = append(kept, session)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(p.idle, key)
+		} else {
+			p.idle[key] = kept
+		}
+	}
+
+	p.size -= len(expired)
+	return expired
+}
+
+func (p *BitwardenClientPool) evictLeastRecentlyUsedLocked() *pooledSession {
+	var lruKey clientPoolKey
+	lruIndex := -1
+	for key, sessions := range p.idle {
+		for i, session := range sessions {
+			if lruIndex == -1 || session.lastUsed.Before(p.idle[lruKey][lruIndex].lastUsed) {
+				lruKey, lruIndex = key, i
+			}
+		}
+	}
+
+	if lruIndex == -1 {
+		return nil
+	}
+
+	sessions := p.idle[lruKey]
+	lru := sessions[lruIndex]
+	p.idle[lruKey] = append(sessions[:lruIndex], sessions[lruIndex+1:]...)
+	if len(p.idle[lruKey]) == 0 {
+		delete(p.idle, lruKey)
+	}
+
+	p.size--
+	return lru
+}
+
+func closeSessions(sessions []*pooledSession) {
+	for _, session := range sessions {
+		session.client.Close()
+	}
+}
+
+// pooledClient is the handle returned by the pool. It is bound to a session by AccessTokenLogin.
+type pooledClient struct {
+	pool *BitwardenClientPool
+
+	session     *pooledSession
+	accessToken string
+	stateFile   *string
+}
+
+func (c *pooledClient) AccessTokenLogin(accessToken string, stateFile *string) error {
+	if c.session != nil {
+		c.Close()
+	}
+
+	key := clientPoolKey{apiUrl: c.pool.GetApiUrl(), tokenHash: HashAuthToken(accessToken)}
+	c.accessToken = accessToken
+	c.stateFile = stateFile
+
+	if session := c.pool.checkout(key); session != nil {
+		c.session = session
+		return nil
+	}
+
+	pooled := c.pool.reserve()
+
+	client, err := c.pool.Factory.GetBitwardenClient()
+	if err != nil {
+		if pooled {
+			c.pool.unreserve()
+		}
+		return err
+	}
+
+	session := &pooledSession{key: key, client: client, pooled: pooled}
+	if err := client.AccessTokenLogin(accessToken, stateFile); err != nil {
+		session.broken = true
+		c.pool.release(session)
+		return err
+	}
+
+	c.session = session
+	return nil
+}
+
+func (c *pooledClient) Projects() sdk.ProjectsInterface {
+	return &pooledProjects{client: c}
+}
+
+func (c *pooledClient) Secrets() sdk.SecretsInterface {
+	return &pooledSecrets{client: c}
+}
+
+func (c *pooledClient) Generators() sdk.GeneratorsInterface {
+	return &pooledGenerators{client: c}
+}
+
+// Close returns the session to the pool.
+func (c *pooledClient) Close() {
+	if c.session == nil {
+		return
+	}
+
+	c.pool.release(c.session)
+	c.session = nil
+}
+
+// Discard closes the session instead of returning it to the pool.
+func (c *pooledClient) Discard() {
+	if c.session == nil {
+		return
+	}
+
+	c.session.broken = true
+	c.Close()
+}
+
+// withSession runs call against the bound session. If it fails with an authentication error, the session
+// logs in again and the call is retried once.
+func withSession[T any](c *pooledClient, call func(sdk.BitwardenClientInterface) (T, error)) (T, error) {
+	var zero T
+	if c.session == nil {
+		return zero, fmt.Errorf("bitwarden client is not logged in")
+	}
+
+	result, err := call(c.session.client)
+	if err == nil || !IsAuthError(err) {
+		return result, err
+	}
+
+	if loginErr := c.session.client.AccessTokenLogin(c.accessToken, c.stateFile); loginErr != nil {
+		c.session.broken = true
+		return zero, loginErr
+	}
+
+	result, err = call(c.session.client)
+	if IsAuthError(err) {
+		c.session.broken = true
+	}
+	return result, err
+}
+
+type pooledSecrets struct {
+	client *pooledClient
+}
+
+func (s *pooledSecrets) Create(key, value, note string, organizationID string, projectIDs []string) (*sdk.SecretResponse, error) {
+	return withSession(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretResponse, error) {
+		return c.Secrets().Create(key, value, note, organizationID, projectIDs)
+	})
+}
+
+func (s *pooledSecrets) List(organizationID string) (*sdk.SecretIdentifiersResponse, error) {
+	return withSession(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretIdentifiersResponse, error) {
+		return c.Secrets().List(organizationID)
+	})
+}
+
+func (s *pooledSecrets) Get(secretID string) (*sdk.SecretResponse, error) {
+	return withSession(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretResponse, error) {
+		return c.Secrets().Get(secretID)
+	})
+}
+
+func (s *pooledSecrets) GetByIDS(secretIDs []string) (*sdk.SecretsResponse, error) {
+	return withSession(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretsResponse, error) {
+		return c.Secrets().GetByIDS(secretIDs)
+	})
+}
+
+func (s *pooledSecrets) Update(secretID string, key, value, note string, organizationID string, projectIDs []string) (*sdk.SecretResponse, error) {
+	return withSession(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretResponse, error) {
+		return c.Secrets().Update(secretID, key, value, note, organizationID, projectIDs)
+	})
+}
+
+func (s *pooledSecrets) Delete(secretIDs []string) (*sdk.SecretsDeleteResponse, error) {
+	return withSession(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretsDeleteResponse, error) {
+		return c.Secrets().Delete(secretIDs)
+	})
+}
+
+func (s *pooledSecrets) Sync(organizationID string, lastSyncedDate *time.Time) (*sdk.SecretsSyncResponse, error) {
+	return withSession(s.client, func(c sdk.BitwardenClientInterface) (*sdk.SecretsSyncResponse, error) {
+		return c.Secrets().Sync(organizationID, lastSyncedDate)
+	})
+}
+
+type pooledProjects struct {
+	client *pooledClient
+}
+
+func (p *pooledProjects) Create(organizationID string, name string) (*sdk.ProjectResponse, error) {
+	return withSession(p.client, func(c sdk.BitwardenClientInterface) (*sdk.ProjectResponse, error) {
+		return c.Projects().Create(organizationID, name)
+	})
+}
+
+func (p *pooledProjects) List(organizationID string) (*sdk.ProjectsResponse, error) {
+	return withSession(p.client, func(c sdk.BitwardenClientInterface) (*sdk.ProjectsResponse, error) {
+		return c.Projects().List(organizationID)
+	})
+}
+
+func (p *pooledProjects) Get(projectID string) (*sdk.ProjectResponse, error) {
+	return withSession(p.client, func(c sdk.BitwardenClientInterface) (*sdk.ProjectResponse, error) {
+		return c.Projects().Get(projectID)
+	})
+}
+
+func (p *pooledProjects) Update(projectID string, organizationID string, name string) (*sdk.ProjectResponse, error) {
+	return withSession(p.client, func(c sdk.BitwardenClientInterface) (*sdk.ProjectResponse, error) {
+		return c.Projects().Update(projectID, organizationID, name)
+	})
+}
+
+func (p *pooledProjects) Delete(projectIDs []string) (*sdk.ProjectsDeleteResponse, error) {
+	return withSession(p.client, func(c sdk.BitwardenClientInterface) (*sdk.ProjectsDeleteResponse, error) {
+		return c.Projects().Delete(projectIDs)
+	})
+}
+
+type pooledGenerators struct {
+	client *pooledClient
+}
+
+func (g *pooledGenerators) GeneratePassword(request sdk.PasswordGeneratorRequest) (*string, error) {
+	return withSession(g.client, func(c sdk.BitwardenClientInterface) (*string, error) {
+		return c.Generators().GeneratePassword(request)
+	})
+}
@@ -0,0 +1,344 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+)
+
+// Condition reason of syncs that failed because a call to Bitwarden did not complete in time
+const ReasonBitwardenTimeout = "BitwardenTimeout"
+
+// TimeoutError is returned when a call to the Bitwarden SDK does not complete within its deadline
+type TimeoutError struct {
+	Call    string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("bitwarden %s did not complete within %s", e.Call, e.Timeout)
+}
+
+// IsTimeoutError reports whether err was caused by a call to the Bitwarden SDK exceeding its deadline.
+func IsTimeoutError(err error) bool {
+	var timeoutErr *TimeoutError
+	return errors.As(err, &timeoutErr)
+}
+
+// discardableClient is implemented by clients that must not be reused once one of their calls was abandoned
+type discardableClient interface {
+	Discard()
+}
+
+// releasingClient is implemented by clients whose calls may keep running after Close. AfterClose runs release
+// once no call of the closed client is running any more, which may be long after Close returned.
+type releasingClient interface {
+	AfterClose(release func())
+}
+
+// TimeoutClientFactory is a BitwardenClientFactory that bounds every SDK call of its clients by Timeout.
+//
+// The SDK calls take no context and cannot be cancelled, so a call that exceeds its deadline is abandoned:
+// the caller gets a TimeoutError and the client refuses any further calls. The client is discarded instead
+// of closed normally once the abandoned call returns, so a pooled session that got stuck is never reused.
+type TimeoutClientFactory struct {
+	Factory BitwardenClientFactory
+	Timeout time.Duration
+
+	mu sync.RWMutex
+}
+
+func NewTimeoutClientFactory(factory BitwardenClientFactory, timeout time.Duration) *TimeoutClientFactory {
+	return &TimeoutClientFactory{
+		Factory: factory,
+		Timeout: timeout,
+	}
+}
+
+func (f *TimeoutClientFactory) GetBitwardenClient() (sdk.BitwardenClientInterface, error) {
+	client, err := f.Factory.GetBitwardenClient()
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return &timeoutClient{client: client, timeout: f.Timeout}, nil
+}
+
+// SetTimeout changes the deadline of the clients created from now on.
+func (f *TimeoutClientFactory) SetTimeout(timeout time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Timeout = timeout
+}
+
+func (f *TimeoutClientFactory) GetApiUrl() string {
+	return f.Factory.GetApiUrl()
+}
+
+func (f *TimeoutClientFactory) GetIdentityApiUrl() string {
+	return f.Factory.GetIdentityApiUrl()
+}
+
+type timeoutClient struct {
+	client  sdk.BitwardenClientInterface
+	timeout time.Duration
+
+	mu sync.Mutex
+	// A call exceeded its deadline; the client must not be used again
+	abandoned bool
+	// A call is still running in the background
+	running bool
+	closed  bool
+	// Run once the abandoned call returns, see AfterClose
+	afterClose func()
+}
+
+type callOutcome[T any] struct {
+	result T
+	err    error
+}
+
+// withDeadline runs call on the wrapped client and gives up waiting for it after the timeout.
+func withDeadline[T any](c *timeoutClient, name string, call func(sdk.BitwardenClientInterface) (T, error)) (T, error) {
+	var zero T
+
+	c.mu.Lock()
+	if c.abandoned || c.closed {
+		c.mu.Unlock()
+		return zero, &TimeoutError{Call: name, Timeout: c.timeout}
+	}
+	c.running = true
+	c.mu.Unlock()
+
+	done := make(chan callOutcome[T], 1)
+	go func() {
+		result, err := call(c.client)
+
+		c.mu.Lock()
+		done <- callOutcome[T]{result: result, err: err}
+		c.running = false
+		discard := c.abandoned && c.closed
+		release := c.afterClose
+		c.afterClose = nil
+		c.mu.Unlock()
+
+		// The caller gave up on the call and already closed the client
+		if discard {
+			c.discard()
+		}
+		if release != nil {
+			release()
+		}
+	}()
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+
+	select {
+	case outcome := <-done:
+		return outcome.result, outcome.err
+	case <-timer.C:
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The call may have completed while the timer fired
+	select {
+	case outcome := <-done:
+		return outcome.result, outcome.err
+	default:
+	}
+
+	c.abandoned = true
+	sdkCallTimeouts.WithLabelValues(name).Inc()
+	return zero, &TimeoutError{Call: name, Timeout: c.timeout}
+}
+
+func (c *timeoutClient) discard() {
+	if client, ok := c.client.(discardableClient); ok {
+		client.Discard()
+		return
+	}
+	c.client.Close()
+}
+
+func (c *timeoutClient) AccessTokenLogin(accessToken string, stateFile *string) error {
+	_, err := withDeadline(c, "login", func(client sdk.BitwardenClientInterface) (struct{}, error) {
+		return struct{}{}, client.AccessTokenLogin(accessToken, stateFile)
+	})
+	return err
+}
+
+func (c *timeoutClient) Projects() sdk.ProjectsInterface {
+	return &timeoutProjects{client: c}
+}
+
+func (c *timeoutClient) Secrets() sdk.SecretsInterface {
+	return &timeoutSecrets{client: c}
+}
+
+func (c *timeoutClient) Generators() sdk.GeneratorsInterface {
+	return &timeoutGenerators{client: c}
+}
+
+// Close closes the wrapped client, or leaves it to an abandoned call that is still running.
+func (c *timeoutClient) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	running, abandoned := c.running, c.abandoned
+	c.mu.Unlock()
+
+	switch {
+	case running:
+		// Discarded by the abandoned call once it returns
+	case abandoned:
+		c.discard()
+	default:
+		c.client.Close()
+	}
+}
+
+// AfterClose runs release right away, or once an abandoned call that is still running returns, so that the
+// state file of the session is not handed to another session while the SDK may still write it.
+func (c *timeoutClient) AfterClose(release func()) {
+	c.mu.Lock()
+	if c.running {
+		c.afterClose = release
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	release()
+}
+
+// afterClose runs release once no call of the closed client is running any more.
+func afterClose(client sdk.BitwardenClientInterface, release func()) {
+	if client, ok := client.(releasingClient); ok {
+		client.AfterClose(release)
+		return
+	}
+	release()
+}
+
+type timeoutSecrets struct {
+	client *timeoutClient
+}
+
+func (s *timeoutSecrets) Create(key, value, note string, organizationID string, projectIDs []string) (*sdk.SecretResponse, error) {
+	return withDeadline(s.client, "secret create", func(c sdk.BitwardenClientInterface) (*sdk.SecretResponse, error) {
+		return c.Secrets().Create(key, value, note, organizationID, projectIDs)
+	})
+}
+
+func (s *timeoutSecrets) List(organizationID string) (*sdk.SecretIdentifiersResponse, error) {
+	return withDeadline(s.client, "secret list", func(c sdk.BitwardenClientInterface) (*sdk.SecretIdentifiersResponse, error) {
+		return c.Secrets().List(organizationID)
+	})
+}
+
+func (s *timeoutSecrets) Get(secretID string) (*sdk.SecretResponse, error) {
+	return withDeadline(s.client, "secret get", func(c sdk.BitwardenClientInterface) (*sdk.SecretResponse, error) {
+		return c.Secrets().Get(secretID)
+	})
+}
+
+func (s *timeoutSecrets) GetByIDS(secretIDs []string) (*sdk.SecretsResponse, error) {
+	return withDeadline(s.client, "secret get by ids", func(c sdk.BitwardenClientInterface) (*sdk.SecretsResponse, error) {
+		return c.Secrets().GetByIDS(secretIDs)
+	})
+}
+
+func (s *timeoutSecrets) Update(secretID string, key, value, note string, organizationID string, projectIDs []string) (*sdk.SecretResponse, error) {
+	return withDeadline(s.client, "secret update", func(c sdk.BitwardenClientInterface) (*sdk.SecretResponse, error) {
+		return c.Secrets().Update(secretID, key, value, note, organizationID, projectIDs)
+	})
+}
+
+func (s *timeoutSecrets) Delete(secretIDs []string) (*sdk.SecretsDeleteResponse, error) {
+	return withDeadline(s.client, "secret delete", func(c sdk.BitwardenClientInterface) (*sdk.SecretsDeleteResponse, error) {
+		return c.Secrets().Delete(secretIDs)
+	})
+}
+
+func (s *timeoutSecrets) Sync(organizationID string, lastSyncedDate *time.Time) (*sdk.SecretsSyncResponse, error) {
+	return withDeadline(s.client, "sync", func(c sdk.BitwardenClientInterface) (*sdk.SecretsSyncResponse, error) {
+		return c.Secrets().Sync(organizationID, lastSyncedDate)
+	})
+}
+
+type timeoutProjects struct {
+	client *timeoutClient
+}
+
+func (p *timeoutProjects) Create(organizationID string, name string) (*sdk.ProjectResponse, error) {
+	return withDeadline(p.client, "project create", func(c sdk.BitwardenClientInterface) (*sdk.ProjectResponse, error) {
+		return c.Projects().Create(organizationID, name)
+	})
+}
+
+func (p *timeoutProjects) List(organizationID string) (*sdk.ProjectsResponse, error) {
+	return withDeadline(p.client, "project list", func(c sdk.BitwardenClientInterface) (*sdk.ProjectsResponse, error) {
+		return c.Projects().List(organizationID)
+	})
+}
+
+func (p *timeoutProjects) Get(projectID string) (*sdk.ProjectResponse, error) {
+	return withDeadline(p.client, "project get", func(c sdk.BitwardenClientInterface) (*sdk.ProjectResponse, error) {
+		return c.Projects().Get(projectID)
+	})
+}
+
+func (p *timeoutProjects) Update(projectID string, organizationID string, name string) (*sdk.ProjectResponse, error) {
+	return withDeadline(p.client, "project update", func(c sdk.BitwardenClientInterface) (*sdk.ProjectResponse, error) {
+		return c.Projects().Update(projectID, organizationID, name)
+	})
+}
+
+func (p *timeoutProjects) Delete(projectIDs []string) (*sdk.ProjectsDeleteResponse, error) {
+	return withDeadline(p.client, "project delete", func(c sdk.BitwardenClientInterface) (*sdk.ProjectsDeleteResponse, error) {
+		return c.Projects().Delete(projectIDs)
+	})
+}
+
+type timeoutGenerators struct {
+	client *timeoutClient
+}
+
+func (g *timeoutGenerators) GeneratePassword(request sdk.PasswordGeneratorRequest) (*string, error) {
+	return withDeadline(g.client, "password generation", func(c sdk.BitwardenClientInterface) (*string, error) {
+		return c.Generators().GeneratePassword(request)
+	})
+}
@@ -0,0 +1,398 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+const (
+	// ConditionSuccessfulSync reports whether the generated password was synced to the Kubernetes secret
+	ConditionSuccessfulSync = "SuccessfulSync"
+
+	// DefaultGeneratedSecretKey is the key of the Kubernetes secret holding the password when none is set
+	DefaultGeneratedSecretKey = "password"
+
+	ReasonPasswordGenerated     = "PasswordGenerated"
+	ReasonExistingSecretFound   = "ExistingSecretFound"
+	ReasonGeneratedSecretSynced = "GeneratedSecretSynced"
+	ReasonGeneratedSyncFailed   = "SyncFailed"
+)
+
+// BitwardenGeneratedSecretReconciler generates passwords into Secrets Manager and syncs them to Kubernetes secrets
+type BitwardenGeneratedSecretReconciler struct {
+	client.Client
+	// APIReader reads the secrets that are not kept in the cache. Every secret is read through the cache when nil.
+	APIReader              client.Reader
+	Scheme                 *runtime.Scheme
+	BitwardenClientFactory BitwardenClientFactory
+	StateStore             *StateStore
+	Recorder               events.EventRecorder
+	RefreshIntervalSeconds int
+
+	// Guards the settings that can be changed while the operator is running
+	settingsMu sync.RWMutex
+}
+
+//+kubebuilder:rbac:groups=k8s.bitwarden.com,resources=bitwardengeneratedsecrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=k8s.bitwarden.com,resources=bitwardengeneratedsecrets/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=k8s.bitwarden.com,resources=bitwardengeneratedsecrets/finalizers,verbs=update
+
+// Reconcile generates the password of a BitwardenGeneratedSecret the first time, and syncs the secret holding
+// it to the Kubernetes secret every refresh interval. The ID of the secret is recorded in the status as soon as
+// it is created, and the password is never generated again once it is set.
+func (r *BitwardenGeneratedSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	generated := &operatorsv1.BitwardenGeneratedSecret{}
+	if err := r.Get(ctx, req.NamespacedName, generated); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !generated.DeletionTimestamp.IsZero() {
+		// The Kubernetes secret is garbage collected with its owner, and the generated secret is kept in Secrets Manager
+		return ctrl.Result{}, nil
+	}
+
+	authToken, err := readAuthToken(ctx, r.Client, r.APIReader, generated.Namespace, generated.Spec.AuthToken)
+	if err != nil {
+		return r.recordFailure(logger, ctx, generated, err)
+	}
+
+	var smSecret *sdk.SecretResponse
+	var reason string
+	err = withBitwardenClient(logger, r.BitwardenClientFactory, r.StateStore, authToken, func(bitwardenClient sdk.BitwardenClientInterface) error {
+		var err error
+		if generated.Status.BwSecretId != "" {
+			smSecret, err = GetGeneratedSecret(bitwardenClient.Secrets(), generated.Status.BwSecretId)
+			return err
+		}
+		smSecret, reason, err = GenerateSecret(bitwardenClient, generated)
+		return err
+	})
+	if err != nil {
+		return r.recordFailure(logger, ctx, generated, err)
+	}
+
+	if reason != "" {
+		// Recorded before anything else can fail, so that the password is not generated twice
+		original := generated.DeepCopy()
+		generated.Status.BwSecretId = smSecret.ID
+		generated.Status.GeneratedTime = metav1.NewTime(time.Now().UTC())
+		if err := r.Status().Patch(ctx, generated, client.MergeFrom(original)); err != nil {
+			return ctrl.Result{}, err
+		}
+		if reason == ReasonPasswordGenerated {
+			logger.Info("Generated a password in Secrets Manager", "secretId", smSecret.ID)
+			r.Recorder.Eventf(generated, nil, corev1.EventTypeNormal, reason, "Generate", "Generated a password in secret %s", smSecret.ID)
+		} else {
+			logger.Info("Using the existing secret in Secrets Manager", "secretId", smSecret.ID)
+			r.Recorder.Eventf(generated, nil, corev1.EventTypeNormal, reason, "Generate", "Using the existing secret %s named %s", smSecret.ID, generated.Spec.BwSecretName)
+		}
+	}
+
+	if err := r.syncK8sSecret(ctx, generated, smSecret.Value); err != nil {
+		return r.recordFailure(logger, ctx, generated, err)
+	}
+
+	original := generated.DeepCopy()
+	generated.Status.LastSuccessfulSyncTime = metav1.NewTime(time.Now().UTC())
+	apimeta.SetStatusCondition(&generated.Status.Conditions, metav1.Condition{
+		Type:    ConditionSuccessfulSync,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonGeneratedSecretSynced,
+		Message: fmt.Sprintf("Synced secret %s to %s/%s", smSecret.ID, generated.Namespace, generated.Spec.SecretName),
+	})
+	if err := r.Status().Patch(ctx, generated, client.MergeFrom(original)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := time.Now().UTC()
+	return ctrl.Result{RequeueAfter: NextSyncTime(generated.UID, r.refreshInterval(), now).Sub(now)}, nil
+}
+
+// PasswordGeneratorRequest returns the request for the password generator, or an error for options it would reject.
+func PasswordGeneratorRequest(options operatorsv1.PasswordOptions) (sdk.PasswordGeneratorRequest, error) {
+	request := sdk.PasswordGeneratorRequest{
+		Length:         options.Length,
+		Lowercase:      options.Lowercase,
+		Uppercase:      options.Uppercase,
+		Numbers:        options.Numbers,
+		Special:        options.Special,
+		AvoidAmbiguous: options.AvoidAmbiguous,
+	}
+	if !request.Lowercase && !request.Uppercase && !request.Numbers && !request.Special {
+		return request, errors.New("the password options include no character class")
+	}
+
+	// Minimums of excluded character classes are ignored by the generator
+	var minimums int64
+	minimum := func(included bool, value *int64) *int64 {
+		if !included || value == nil {
+			return nil
+		}
+		minimums += *value
+		return value
+	}
+	request.MinLowercase = minimum(request.Lowercase, options.MinLowercase)
+	request.MinUppercase = minimum(request.Uppercase, options.MinUppercase)
+	request.MinNumber = minimum(request.Numbers, options.MinNumber)
+	request.MinSpecial = minimum(request.Special, options.MinSpecial)
+	if request.Length < minimums {
+		return request, fmt.Errorf("the password length %d is less than the sum %d of the minimums", request.Length, minimums)
+	}
+
+	return request, nil
+}
+
+// GeneratedSecretNote returns the note of the secrets created for a BitwardenGeneratedSecret.
+func GeneratedSecretNote(generated *operatorsv1.BitwardenGeneratedSecret) string {
+	return fmt.Sprintf("Generated for the Kubernetes secret %s/%s by BitwardenGeneratedSecret %s", generated.Namespace, generated.Spec.SecretName, generated.Name)
+}
+
+// GenerateSecret returns the secret named in the spec if it already exists in the project, or creates it with a
+// generated password. The reason tells which of the two happened.
+func GenerateSecret(bitwardenClient sdk.BitwardenClientInterface, generated *operatorsv1.BitwardenGeneratedSecret) (*sdk.SecretResponse, string, error) {
+	spec := &generated.Spec
+	request, err := PasswordGeneratorRequest(spec.Password)
+	if err != nil {
+		return nil, "", NewPermanentError(err)
+	}
+
+	existing, err := findSecretByName(bitwardenClient.Secrets(), spec.OrganizationId, spec.ProjectId, spec.BwSecretName)
+	if err != nil || existing != nil {
+		return existing, ReasonExistingSecretFound, err
+	}
+
+	password, err := bitwardenClient.Generators().GeneratePassword(request)
+	if err != nil {
+		return nil, "", err
+	}
+	if password == nil || *password == "" {
+		return nil, "", errors.New("the password generator returned no password")
+	}
+
+	smSecret, err := bitwardenClient.Secrets().Create(spec.BwSecretName, *password, GeneratedSecretNote(generated), spec.OrganizationId, []string{spec.ProjectId})
+	if err != nil {
+		return nil, "", err
+	}
+	return smSecret, ReasonPasswordGenerated, nil
+}
+
+// findSecretByName returns the secret of the project with the name, or nil if there is none. Names are not unique
+// in Secrets Manager, so several secrets with the name are an error rather than a guess.
+func findSecretByName(secrets sdk.SecretsInterface, orgId string, projectId string, name string) (*sdk.SecretResponse, error) {
+	identifiers, err := secrets.List(orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	if identifiers == nil {
+		return nil, nil
+	}
+
+	var ids []string
+	for _, identifier := range identifiers.Data {
+		if identifier.Key == name {
+			ids = append(ids, identifier.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	response, err := secrets.GetByIDS(ids)
+	if err != nil || response == nil {
+		return nil, err
+	}
+	var found []sdk.SecretResponse
+	for _, smSecret := range response.Data {
+		if smSecret.ProjectID != nil && *smSecret.ProjectID == projectId {
+			found = append(found, smSecret)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &found[0], nil
+	default:
+		return nil, NewPermanentError(fmt.Errorf("project %s has %d secrets named %s", projectId, len(found), name))
+	}
+}
+
+// GetGeneratedSecret returns the generated secret. A secret that was deleted, or that the machine account lost
+// access to, is not generated again, since consumers of the password may still depend on it.
+func GetGeneratedSecret(secrets sdk.SecretsInterface, id string) (*sdk.SecretResponse, error) {
+	response, err := secrets.GetByIDS([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		response = &sdk.SecretsResponse{}
+	}
+	for _, smSecret := range response.Data {
+		if smSecret.ID == id {
+			return &smSecret, nil
+		}
+	}
+	return nil, NewPermanentError(fmt.Errorf("generated secret %s does not exist or the machine account has no access to it; "+
+		"recreate the BitwardenGeneratedSecret to generate a new password", id))
+}
+
+// syncK8sSecret writes the password to the Kubernetes secret, creating it if needed. Other keys of the secret are
+// left alone, but a secret not created for this BitwardenGeneratedSecret is never written.
+func (r *BitwardenGeneratedSecretReconciler) syncK8sSecret(ctx context.Context, generated *operatorsv1.BitwardenGeneratedSecret, password string) error {
+	key := types.NamespacedName{Namespace: generated.Namespace, Name: generated.Spec.SecretName}
+	dataKey := generated.Spec.SecretKey
+	if dataKey == "" {
+		dataKey = DefaultGeneratedSecretKey
+	}
+	k8sSecret := &corev1.Secret{}
+	err := GetSecret(ctx, r.Client, r.APIReader, key, k8sSecret)
+	if k8serrors.IsNotFound(err) {
+		k8sSecret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels:    map[string]string{LabelSecretRole: SecretRoleSynced},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{dataKey: []byte(password)},
+		}
+		if err := ctrl.SetControllerReference(generated, k8sSecret, r.Scheme); err != nil {
+			return err
+		}
+		return r.Create(ctx, k8sSecret)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !metav1.IsControlledBy(k8sSecret, generated) {
+		return NewPermanentError(fmt.Errorf("secret %s exists and is not managed by BitwardenGeneratedSecret %s", key, generated.Name))
+	}
+	if string(k8sSecret.Data[dataKey]) == password && k8sSecret.Labels[LabelSecretRole] == SecretRoleSynced {
+		return nil
+	}
+
+	original := k8sSecret.DeepCopy()
+	if k8sSecret.Labels == nil {
+		k8sSecret.Labels = map[string]string{}
+	}
+	k8sSecret.Labels[LabelSecretRole] = SecretRoleSynced
+	if k8sSecret.Data == nil {
+		k8sSecret.Data = map[string][]byte{}
+	}
+	k8sSecret.Data[dataKey] = []byte(password)
+	return r.Patch(ctx, k8sSecret, client.MergeFrom(original))
+}
+
+// recordFailure records a failed generation or sync. Transient errors are retried with the backoff of the
+// controller; others once the BitwardenGeneratedSecret or its secrets change.
+func (r *BitwardenGeneratedSecretReconciler) recordFailure(logger logr.Logger, ctx context.Context, generated *operatorsv1.BitwardenGeneratedSecret, err error) (ctrl.Result, error) {
+	logger.Error(err, "Failed to sync the generated secret")
+	original := generated.DeepCopy()
+	apimeta.SetStatusCondition(&generated.Status.Conditions, metav1.Condition{
+		Type:    ConditionSuccessfulSync,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonGeneratedSyncFailed,
+		Message: err.Error(),
+	})
+	if patchErr := r.Status().Patch(ctx, generated, client.MergeFrom(original)); patchErr != nil {
+		return ctrl.Result{}, errors.Join(err, patchErr)
+	}
+
+	if ClassifyError(err) == ErrorClassTransient {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, reconcile.TerminalError(err)
+}
+
+func (r *BitwardenGeneratedSecretReconciler) refreshInterval() time.Duration {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+
+	return time.Duration(r.RefreshIntervalSeconds) * time.Second
+}
+
+// SetRefreshInterval changes how often generated secrets are synced, starting with their next sync.
+func (r *BitwardenGeneratedSecretReconciler) SetRefreshInterval(seconds int) {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	r.RefreshIntervalSeconds = seconds
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *BitwardenGeneratedSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &operatorsv1.BitwardenGeneratedSecret{}, authTokenSecretIndex, func(obj client.Object) []string {
+		return []string{obj.(*operatorsv1.BitwardenGeneratedSecret).Spec.AuthToken.SecretName}
+	}); err != nil {
+		return err
+	}
+
+	// Status updates do not change the generation, so recording a sync does not trigger another one
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&operatorsv1.BitwardenGeneratedSecret{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&corev1.Secret{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapAuthTokenSecretToGeneratedSecrets), builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
+		WithOptions(controller.Options{RateLimiter: NewReconcileRateLimiter(r.refreshInterval())}).
+		Complete(r)
+}
+
+// mapAuthTokenSecretToGeneratedSecrets enqueues the BitwardenGeneratedSecrets authenticating with a secret.
+func (r *BitwardenGeneratedSecretReconciler) mapAuthTokenSecretToGeneratedSecrets(ctx context.Context, obj client.Object) []reconcile.Request {
+	generatedSecrets := &operatorsv1.BitwardenGeneratedSecretList{}
+	if err := r.List(ctx, generatedSecrets, client.InNamespace(obj.GetNamespace()), client.MatchingFields{authTokenSecretIndex: obj.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list BitwardenGeneratedSecrets referencing auth token secret", "secret", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(generatedSecrets.Items))
+	for _, generated := range generatedSecrets.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: generated.Namespace, Name: generated.Name}})
+	}
+	return requests
+}
@@ -0,0 +1,566 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+const (
+	// FinalizerPushSecret deletes the pushed secrets from Secrets Manager before a BitwardenPushSecret with
+	// the Delete deletion policy is removed
+	FinalizerPushSecret = "k8s.bitwarden.com/push-secret"
+
+	// ConditionSuccessfulPush reports whether the data of the Kubernetes secret was pushed
+	ConditionSuccessfulPush = "SuccessfulPush"
+	// ConditionConflicted reports secrets that were edited in Secrets Manager and were not overwritten
+	ConditionConflicted = "Conflicted"
+
+	ReasonPushComplete    = "PushComplete"
+	ReasonPushFailed      = "PushFailed"
+	ReasonSourceNotFound  = "SourceNotFound"
+	ReasonSourceInvalid   = "SourceInvalid"
+	ReasonEditedInBw      = "EditedInSecretsManager"
+	ReasonNoConflicts     = "NoConflicts"
+	ReasonSecretsRetained = "PushedSecretsRetained"
+)
+
+// Field index of BitwardenPushSecrets by the names of their source and auth token secrets
+const pushSecretReferenceIndex = "spec.secretRefs"
+
+// PushEntry is a key of the Kubernetes secret and the secret in Secrets Manager it is pushed to
+type PushEntry struct {
+	SecretKeyName string
+	BwSecretName  string
+	Value         string
+}
+
+// BitwardenPushSecretReconciler pushes the data of Kubernetes secrets to Secrets Manager
+type BitwardenPushSecretReconciler struct {
+	client.Client
+	// APIReader reads the secrets that are not kept in the cache. Every secret is read through the cache when nil.
+	APIReader              client.Reader
+	BitwardenClientFactory BitwardenClientFactory
+	StateStore             *StateStore
+	Recorder               events.EventRecorder
+	RefreshIntervalSeconds int
+
+	// Guards the settings that can be changed while the operator is running
+	settingsMu sync.RWMutex
+}
+
+//+kubebuilder:rbac:groups=k8s.bitwarden.com,resources=bitwardenpushsecrets,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=k8s.bitwarden.com,resources=bitwardenpushsecrets/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=k8s.bitwarden.com,resources=bitwardenpushsecrets/finalizers,verbs=update
+
+// Reconcile creates or updates a secret in Secrets Manager for every pushed key of the Kubernetes secret, and
+// checks them again every refresh interval.
+func (r *BitwardenPushSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pushSecret := &operatorsv1.BitwardenPushSecret{}
+	if err := r.Get(ctx, req.NamespacedName, pushSecret); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !pushSecret.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(logger, ctx, pushSecret)
+	}
+
+	// Only BitwardenPushSecrets whose pushed secrets are deleted with them need a finalizer
+	deleteSecrets := pushSecret.Spec.DeletionPolicy == operatorsv1.PushDeletionDelete
+	if controllerutil.ContainsFinalizer(pushSecret, FinalizerPushSecret) != deleteSecrets {
+		original := pushSecret.DeepCopy()
+		if deleteSecrets {
+			controllerutil.AddFinalizer(pushSecret, FinalizerPushSecret)
+		} else {
+			controllerutil.RemoveFinalizer(pushSecret, FinalizerPushSecret)
+		}
+		if err := r.Patch(ctx, pushSecret, client.MergeFrom(original)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	source := &corev1.Secret{}
+	if err := GetSecret(ctx, r.Client, r.APIReader, types.NamespacedName{Namespace: pushSecret.Namespace, Name: pushSecret.Spec.SecretName}, source); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return r.recordSourceProblem(logger, ctx, pushSecret, ReasonSourceNotFound, fmt.Sprintf("Secret %s/%s not found", pushSecret.Namespace, pushSecret.Spec.SecretName))
+		}
+		return ctrl.Result{}, err
+	}
+	entries, err := PushEntries(pushSecret, source)
+	if err != nil {
+		return r.recordSourceProblem(logger, ctx, pushSecret, ReasonSourceInvalid, err.Error())
+	}
+
+	authToken, err := readAuthToken(ctx, r.Client, r.APIReader, pushSecret.Namespace, pushSecret.Spec.AuthToken)
+	if err != nil {
+		return r.recordFailure(logger, ctx, pushSecret, pushSecret.Status.PushedSecrets, err)
+	}
+
+	var pushed []operatorsv1.PushedSecret
+	err = withBitwardenClient(logger, r.BitwardenClientFactory, r.StateStore, authToken, func(bitwardenClient sdk.BitwardenClientInterface) error {
+		var err error
+		pushed, err = Push(bitwardenClient.Secrets(), pushSecret, entries)
+		return err
+	})
+	if err != nil {
+		return r.recordFailure(logger, ctx, pushSecret, pushed, err)
+	}
+
+	if err := r.recordCompletion(logger, ctx, pushSecret, pushed); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := time.Now().UTC()
+	return ctrl.Result{RequeueAfter: NextSyncTime(pushSecret.UID, r.refreshInterval(), now).Sub(now)}, nil
+}
+
+// PushEntries returns the keys of the Kubernetes secret that are pushed, sorted by key.
+func PushEntries(pushSecret *operatorsv1.BitwardenPushSecret, source *corev1.Secret) ([]PushEntry, error) {
+	var entries []PushEntry
+	var missing, binary []string
+	add := func(key string, name string) {
+		value, ok := source.Data[key]
+		switch {
+		case !ok:
+			missing = append(missing, key)
+		case !utf8.Valid(value):
+			// Secrets Manager only holds text
+			binary = append(binary, key)
+		default:
+			entries = append(entries, PushEntry{SecretKeyName: key, BwSecretName: name, Value: string(value)})
+		}
+	}
+
+	if len(pushSecret.Spec.Map) == 0 {
+		for key := range source.Data {
+			add(key, key)
+		}
+	}
+	for _, mapping := range pushSecret.Spec.Map {
+		add(mapping.SecretKeyName, mapping.BwSecretName)
+	}
+
+	var errs []error
+	if len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("secret %s/%s has no keys %s", source.Namespace, source.Name, strings.Join(missing, ", ")))
+	}
+	if len(binary) > 0 {
+		slices.Sort(binary)
+		errs = append(errs, fmt.Errorf("keys %s of secret %s/%s are not valid UTF-8 text", strings.Join(binary, ", "), source.Namespace, source.Name))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	slices.SortFunc(entries, func(a, b PushEntry) int { return strings.Compare(a.SecretKeyName, b.SecretKeyName) })
+	return entries, nil
+}
+
+// PushNote returns the note of the secrets pushed to Secrets Manager, which tells where they come from.
+func PushNote(pushSecret *operatorsv1.BitwardenPushSecret) string {
+	return fmt.Sprintf("Pushed from the Kubernetes secret %s/%s by BitwardenPushSecret %s", pushSecret.Namespace, pushSecret.Spec.SecretName, pushSecret.Name)
+}
+
+// Push creates the secrets of the entries in Secrets Manager, or updates those pushed before. A secret edited
+// in Secrets Manager since it was pushed is only overwritten with the Overwrite conflict policy. Secrets of
+// keys that are no longer pushed are deleted with the Delete deletion policy.
+//
+// The returned records include the secrets pushed before an error, so that they are not created twice. Secrets
+// pushed before but missing from the records are found by their name and note and taken over.
+func Push(secrets sdk.SecretsInterface, pushSecret *operatorsv1.BitwardenPushSecret, entries []PushEntry) ([]operatorsv1.PushedSecret, error) {
+	spec := &pushSecret.Spec
+	note := PushNote(pushSecret)
+	projectIds := []string{spec.ProjectId}
+
+	records := map[string]operatorsv1.PushedSecret{}
+	var ids []string
+	for _, record := range pushSecret.Status.PushedSecrets {
+		records[record.SecretKeyName] = record
+		ids = append(ids, record.BwSecretId)
+	}
+	sorted := func() []operatorsv1.PushedSecret {
+		result := make([]operatorsv1.PushedSecret, 0, len(records))
+		for _, record := range records {
+			result = append(result, record)
+		}
+		slices.SortFunc(result, func(a, b operatorsv1.PushedSecret) int { return strings.Compare(a.SecretKeyName, b.SecretKeyName) })
+		return result
+	}
+
+	// Secrets that were deleted or that the machine account lost access to are not returned, and are pushed again
+	current := map[string]sdk.SecretResponse{}
+	if len(ids) > 0 {
+		response, err := secrets.GetByIDS(ids)
+		if err != nil {
+			return sorted(), err
+		}
+		if response != nil {
+			for _, smSecret := range response.Data {
+				current[smSecret.ID] = smSecret
+			}
+		}
+	}
+
+	// Secrets pushed before that are missing from the status, because recording them failed or the status
+	// was read from a stale cache, are found by name and note instead of being created again
+	claimed := map[string]bool{}
+	for _, record := range records {
+		claimed[record.BwSecretId] = true
+	}
+	var untracked map[string][]sdk.SecretResponse
+
+	pushedKeys := map[string]bool{}
+	for _, entry := range entries {
+		pushedKeys[entry.SecretKeyName] = true
+		record, tracked := records[entry.SecretKeyName]
+		smSecret, exists := current[record.BwSecretId]
+
+		if !tracked || !exists {
+			if untracked == nil {
+				var err error
+				if untracked, err = findPushedSecrets(secrets, spec, note, entries); err != nil {
+					return sorted(), err
+				}
+			}
+			for _, candidate := range untracked[entry.BwSecretName] {
+				if !claimed[candidate.ID] {
+					claimed[candidate.ID] = true
+					smSecret, exists = candidate, true
+					record = operatorsv1.PushedSecret{
+						SecretKeyName: entry.SecretKeyName,
+						BwSecretId:    candidate.ID,
+						RevisionDate:  candidate.RevisionDate.UTC().Format(time.RFC3339Nano),
+					}
+					break
+				}
+			}
+		}
+
+		var response *sdk.SecretResponse
+		var err error
+		switch {
+		case !exists:
+			response, err = secrets.Create(entry.BwSecretName, entry.Value, note, spec.OrganizationId, projectIds)
+		case !revisionMatches(record, smSecret) && spec.ConflictPolicy != operatorsv1.PushConflictOverwrite:
+			record.Conflicted = true
+			records[entry.SecretKeyName] = record
+			continue
+		case revisionMatches(record, smSecret) && pushedUnchanged(smSecret, entry, note, spec):
+			record.Conflicted = false
+			records[entry.SecretKeyName] = record
+			continue
+		default:
+			response, err = secrets.Update(smSecret.ID, entry.BwSecretName, entry.Value, note, spec.OrganizationId, projectIds)
+		}
+		if err != nil {
+			return sorted(), err
+		}
+		records[entry.SecretKeyName] = operatorsv1.PushedSecret{
+			SecretKeyName: entry.SecretKeyName,
+			BwSecretId:    response.ID,
+			RevisionDate:  response.RevisionDate.UTC().Format(time.RFC3339Nano),
+		}
+	}
+
+	var stale []string
+	for key, record := range records {
+		if pushedKeys[key] {
+			continue
+		}
+		if _, exists := current[record.BwSecretId]; exists && spec.DeletionPolicy == operatorsv1.PushDeletionDelete {
+			stale = append(stale, record.BwSecretId)
+			continue
+		}
+		delete(records, key)
+	}
+	if len(stale) > 0 {
+		if _, err := secrets.Delete(stale); err != nil {
+			return sorted(), err
+		}
+		for key := range records {
+			if !pushedKeys[key] {
+				delete(records, key)
+			}
+		}
+	}
+
+	return sorted(), nil
+}
+
+// findPushedSecrets returns the secrets of the project that carry the note of the BitwardenPushSecret, by
+// name, for the names of the entries.
+func findPushedSecrets(secrets sdk.SecretsInterface, spec *operatorsv1.BitwardenPushSecretSpec, note string, entries []PushEntry) (map[string][]sdk.SecretResponse, error) {
+	found := map[string][]sdk.SecretResponse{}
+
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.BwSecretName] = true
+	}
+
+	identifiers, err := secrets.List(spec.OrganizationId)
+	if err != nil || identifiers == nil {
+		return found, err
+	}
+	var ids []string
+	for _, identifier := range identifiers.Data {
+		if names[identifier.Key] {
+			ids = append(ids, identifier.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return found, nil
+	}
+
+	response, err := secrets.GetByIDS(ids)
+	if err != nil || response == nil {
+		return found, err
+	}
+	for _, smSecret := range response.Data {
+		if smSecret.Note == note && smSecret.ProjectID != nil && *smSecret.ProjectID == spec.ProjectId {
+			found[smSecret.Key] = append(found[smSecret.Key], smSecret)
+		}
+	}
+	return found, nil
+}
+
+// revisionMatches reports whether the secret in Secrets Manager was not edited since it was pushed.
+func revisionMatches(record operatorsv1.PushedSecret, smSecret sdk.SecretResponse) bool {
+	revisionDate, err := time.Parse(time.RFC3339Nano, record.RevisionDate)
+	return err == nil && revisionDate.Equal(smSecret.RevisionDate)
+}
+
+// pushedUnchanged reports whether the secret in Secrets Manager already holds the entry.
+func pushedUnchanged(smSecret sdk.SecretResponse, entry PushEntry, note string, spec *operatorsv1.BitwardenPushSecretSpec) bool {
+	return smSecret.Key == entry.BwSecretName && smSecret.Value == entry.Value && smSecret.Note == note &&
+		smSecret.OrganizationID == spec.OrganizationId && smSecret.ProjectID != nil && *smSecret.ProjectID == spec.ProjectId
+}
+
+// readAuthToken reads the machine account token referenced by a resource in the namespace.
+func readAuthToken(ctx context.Context, cached client.Client, apiReader client.Reader, namespace string, ref operatorsv1.AuthToken) (string, error) {
+	authK8sSecret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: namespace, Name: ref.SecretName}
+	if err := GetSecret(ctx, cached, apiReader, key, authK8sSecret); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return "", NewAuthError(err)
+		}
+		return "", err
+	}
+
+	data, ok := authK8sSecret.Data[ref.SecretKey]
+	if !ok {
+		return "", NewAuthError(fmt.Errorf("auth token secret key %s not found in %s", ref.SecretKey, key))
+	}
+	return string(data), nil
+}
+
+// finalize deletes the pushed secrets from Secrets Manager and releases the BitwardenPushSecret. When the
+// secrets cannot be deleted for good, for example because the auth token secret was deleted first, they are
+// retained instead of blocking the deletion of the namespace.
+func (r *BitwardenPushSecretReconciler) finalize(logger logr.Logger, ctx context.Context, pushSecret *operatorsv1.BitwardenPushSecret) error {
+	if !controllerutil.ContainsFinalizer(pushSecret, FinalizerPushSecret) {
+		return nil
+	}
+
+	var ids []string
+	for _, record := range pushSecret.Status.PushedSecrets {
+		ids = append(ids, record.BwSecretId)
+	}
+	if len(ids) > 0 {
+		authToken, err := readAuthToken(ctx, r.Client, r.APIReader, pushSecret.Namespace, pushSecret.Spec.AuthToken)
+		if err == nil {
+			err = withBitwardenClient(logger, r.BitwardenClientFactory, r.StateStore, authToken, func(bitwardenClient sdk.BitwardenClientInterface) error {
+				_, err := bitwardenClient.Secrets().Delete(ids)
+				return err
+			})
+		}
+		if err != nil {
+			if ClassifyError(err) == ErrorClassTransient {
+				logger.Error(err, "Failed to delete the pushed secrets from Secrets Manager")
+				return err
+			}
+			logger.Error(err, "Retaining the pushed secrets in Secrets Manager")
+			r.Recorder.Eventf(pushSecret, nil, corev1.EventTypeWarning, ReasonSecretsRetained, "Delete",
+				"The pushed secrets could not be deleted from Secrets Manager and were retained: %v", err)
+		} else {
+			logger.Info("Deleted the pushed secrets from Secrets Manager", "count", len(ids))
+		}
+	}
+
+	original := pushSecret.DeepCopy()
+	controllerutil.RemoveFinalizer(pushSecret, FinalizerPushSecret)
+	return r.Patch(ctx, pushSecret, client.MergeFrom(original))
+}
+
+// recordSourceProblem records that the Kubernetes secret cannot be pushed. Sources that are not kept in the
+// cache are not watched, so it is checked again after the refresh interval.
+func (r *BitwardenPushSecretReconciler) recordSourceProblem(logger logr.Logger, ctx context.Context, pushSecret *operatorsv1.BitwardenPushSecret, reason string, message string) (ctrl.Result, error) {
+	logger.Info("Not pushing the Kubernetes secret", "reason", reason, "message", message)
+	original := pushSecret.DeepCopy()
+	apimeta.SetStatusCondition(&pushSecret.Status.Conditions, metav1.Condition{
+		Type:    ConditionSuccessfulPush,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+	if err := r.Status().Patch(ctx, pushSecret, client.MergeFrom(original)); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.refreshInterval()}, nil
+}
+
+// recordFailure records a failed push along with the secrets pushed before it failed. Transient errors are
+// retried with the backoff of the controller; others once the BitwardenPushSecret or its secrets change.
+func (r *BitwardenPushSecretReconciler) recordFailure(logger logr.Logger, ctx context.Context, pushSecret *operatorsv1.BitwardenPushSecret, pushed []operatorsv1.PushedSecret, err error) (ctrl.Result, error) {
+	logger.Error(err, "Failed to push the Kubernetes secret to Secrets Manager")
+	original := pushSecret.DeepCopy()
+	pushSecret.Status.PushedSecrets = pushed
+	apimeta.SetStatusCondition(&pushSecret.Status.Conditions, metav1.Condition{
+		Type:    ConditionSuccessfulPush,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonPushFailed,
+		Message: err.Error(),
+	})
+	if patchErr := r.Status().Patch(ctx, pushSecret, client.MergeFrom(original)); patchErr != nil {
+		return ctrl.Result{}, errors.Join(err, patchErr)
+	}
+
+	if ClassifyError(err) == ErrorClassTransient {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, reconcile.TerminalError(err)
+}
+
+// recordCompletion records the pushed secrets and reports those left conflicted.
+func (r *BitwardenPushSecretReconciler) recordCompletion(logger logr.Logger, ctx context.Context, pushSecret *operatorsv1.BitwardenPushSecret, pushed []operatorsv1.PushedSecret) error {
+	original := pushSecret.DeepCopy()
+	pushSecret.Status.PushedSecrets = pushed
+	pushSecret.Status.LastSuccessfulPushTime = metav1.NewTime(time.Now().UTC())
+	apimeta.SetStatusCondition(&pushSecret.Status.Conditions, metav1.Condition{
+		Type:    ConditionSuccessfulPush,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonPushComplete,
+		Message: fmt.Sprintf("Pushed %d keys of %s/%s", len(pushed), pushSecret.Namespace, pushSecret.Spec.SecretName),
+	})
+
+	var conflicted []string
+	for _, record := range pushed {
+		if record.Conflicted {
+			conflicted = append(conflicted, record.SecretKeyName)
+		}
+	}
+	conflictCondition := metav1.Condition{
+		Type:    ConditionConflicted,
+		Status:  metav1.ConditionFalse,
+		Reason:  ReasonNoConflicts,
+		Message: "No pushed secret was edited in Secrets Manager",
+	}
+	if len(conflicted) > 0 {
+		conflictCondition = metav1.Condition{
+			Type:   ConditionConflicted,
+			Status: metav1.ConditionTrue,
+			Reason: ReasonEditedInBw,
+			Message: fmt.Sprintf("The secrets of keys %s were edited in Secrets Manager and were not overwritten",
+				strings.Join(conflicted, ", ")),
+		}
+	}
+	if apimeta.SetStatusCondition(&pushSecret.Status.Conditions, conflictCondition) && len(conflicted) > 0 {
+		r.Recorder.Eventf(pushSecret, nil, corev1.EventTypeWarning, ReasonEditedInBw, "Push", "%s", conflictCondition.Message)
+	}
+
+	logger.Info("Pushed the Kubernetes secret to Secrets Manager", "keys", len(pushed), "conflicted", len(conflicted))
+	return r.Status().Patch(ctx, pushSecret, client.MergeFrom(original))
+}
+
+func (r *BitwardenPushSecretReconciler) refreshInterval() time.Duration {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+
+	return time.Duration(r.RefreshIntervalSeconds) * time.Second
+}
+
+// SetRefreshInterval changes how often pushed secrets are checked, starting with their next check.
+func (r *BitwardenPushSecretReconciler) SetRefreshInterval(seconds int) {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	r.RefreshIntervalSeconds = seconds
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *BitwardenPushSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &operatorsv1.BitwardenPushSecret{}, pushSecretReferenceIndex, func(obj client.Object) []string {
+		spec := obj.(*operatorsv1.BitwardenPushSecret).Spec
+		return []string{spec.SecretName, spec.AuthToken.SecretName}
+	}); err != nil {
+		return err
+	}
+
+	// Status updates do not change the generation, so recording a push does not trigger another one
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&operatorsv1.BitwardenPushSecret{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapSecretToPushSecrets), builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
+		WithOptions(controller.Options{RateLimiter: NewReconcileRateLimiter(r.refreshInterval())}).
+		Complete(r)
+}
+
+// mapSecretToPushSecrets enqueues the BitwardenPushSecrets pushing a secret or authenticating with it.
+func (r *BitwardenPushSecretReconciler) mapSecretToPushSecrets(ctx context.Context, obj client.Object) []reconcile.Request {
+	pushSecrets := &operatorsv1.BitwardenPushSecretList{}
+	if err := r.List(ctx, pushSecrets, client.InNamespace(obj.GetNamespace()), client.MatchingFields{pushSecretReferenceIndex: obj.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list BitwardenPushSecrets referencing secret", "secret", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(pushSecrets.Items))
+	for _, pushSecret := range pushSecrets.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pushSecret.Namespace, Name: pushSecret.Name}})
+	}
+	return requests
+}
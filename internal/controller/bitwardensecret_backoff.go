@@ -0,0 +1,139 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+// ErrorClass determines how a failed sync is retried
+type ErrorClass string
+
+const (
+	// ErrorClassTransient failures are retried with jittered exponential backoff
+	ErrorClassTransient ErrorClass = "Transient"
+	// ErrorClassAuth failures are retried once the auth token secret changes
+	ErrorClassAuth ErrorClass = "Auth"
+	// ErrorClassPermanent failures are retried once the BitwardenSecret changes
+	ErrorClassPermanent ErrorClass = "Permanent"
+)
+
+// Delay before the first retry of a transient failure. It doubles with every consecutive failure.
+const MinRetryDelay = 5 * time.Second
+
+// PermanentError marks an error that cannot be resolved by retrying until the BitwardenSecret is changed
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// NewPermanentError wraps err as a PermanentError
+func NewPermanentError(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// AuthError marks an error caused by a missing, incomplete or rejected auth token
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string { return e.Err.Error() }
+func (e *AuthError) Unwrap() error { return e.Err }
+
+// NewAuthError wraps err as an AuthError
+func NewAuthError(err error) error {
+	return &AuthError{Err: err}
+}
+
+// ClassifyError returns the class of an error returned while syncing a BitwardenSecret.
+// Errors that are not explicitly marked and not recognized as auth errors are treated as transient.
+func ClassifyError(err error) ErrorClass {
+	var permanentErr *PermanentError
+	if errors.As(err, &permanentErr) {
+		return ErrorClassPermanent
+	}
+
+	var authErr *AuthError
+	if errors.As(err, &authErr) || IsAuthError(err) {
+		return ErrorClassAuth
+	}
+
+	return ErrorClassTransient
+}
+
+// TransientRetryDelay returns the delay before retrying after the given number of consecutive transient
+// failures. The delay doubles with every failure up to maxDelay, and a random jitter of up to half the delay
+// is subtracted so that BitwardenSecrets failing together do not retry together.
+func TransientRetryDelay(consecutiveFailures int32, maxDelay time.Duration) time.Duration {
+	delay := maxDelay
+	if consecutiveFailures < 1 {
+		consecutiveFailures = 1
+	}
+	// Stop doubling well before the duration could overflow
+	if consecutiveFailures <= 20 {
+		delay = min(MinRetryDelay<<(consecutiveFailures-1), maxDelay)
+	}
+
+	half := delay / 2
+	return delay - half + rand.N(half+1)
+}
+
+// NextSyncBackoff returns the backoff state after a failed sync of bwSecret. authTokenVersion is the resource
+// version of the auth token secret the sync was attempted with, if it could be read.
+func NextSyncBackoff(bwSecret *operatorsv1.BitwardenSecret, class ErrorClass, authTokenVersion string, maxDelay time.Duration, now time.Time) (*operatorsv1.SyncBackoff, time.Duration) {
+	backoff := &operatorsv1.SyncBackoff{
+		ErrorClass:          string(class),
+		ConsecutiveFailures: 1,
+		ObservedGeneration:  bwSecret.Generation,
+	}
+	if previous := bwSecret.Status.Backoff; previous != nil {
+		backoff.ConsecutiveFailures = previous.ConsecutiveFailures + 1
+	}
+
+	switch class {
+	case ErrorClassTransient:
+		delay := TransientRetryDelay(backoff.ConsecutiveFailures, maxDelay)
+		backoff.NextRetryTime = &metav1.Time{Time: now.Add(delay)}
+		return backoff, delay
+	case ErrorClassAuth:
+		backoff.AuthTokenResourceVersion = authTokenVersion
+	}
+
+	return backoff, 0
+}
+
+// WaitingForAuthTokenRotation reports whether the last sync of bwSecret failed to authenticate with the
+// current version of its auth token secret, in which case retrying cannot succeed.
+func WaitingForAuthTokenRotation(bwSecret *operatorsv1.BitwardenSecret, authTokenVersion string) bool {
+	backoff := bwSecret.Status.Backoff
+	return backoff != nil &&
+		backoff.ErrorClass == string(ErrorClassAuth) &&
+		backoff.ObservedGeneration == bwSecret.Generation &&
+		backoff.AuthTokenResourceVersion == authTokenVersion
+}
@@ -0,0 +1,86 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// LabelSecretRole selects the Kubernetes secrets kept in the cache of the manager
+	LabelSecretRole = "k8s.bitwarden.com/secret-role"
+	// SecretRoleSynced marks the secrets written by the operator
+	SecretRoleSynced = "synced"
+	// SecretRoleAuthToken marks the secrets holding a machine account token
+	SecretRoleAuthToken = "auth-token"
+	// SecretRolePushSource marks the secrets pushed to Secrets Manager by a BitwardenPushSecret
+	SecretRolePushSource = "push-source"
+)
+
+// CachedSecretSelector selects the secrets written by the operator and the auth token and push source
+// secrets labelled for caching. Caching every secret in the cluster, including large ones such as Helm release secrets,
+// would cost far more memory than the operator needs.
+func CachedSecretSelector() labels.Selector {
+	requirement, err := labels.NewRequirement(LabelSecretRole, selection.In, []string{SecretRoleSynced, SecretRoleAuthToken, SecretRolePushSource})
+	if err != nil {
+		panic(err)
+	}
+	return labels.NewSelector().Add(*requirement)
+}
+
+// CacheOptions restricts the cache of the manager to the watched namespaces, if any, and to the secrets
+// selected by CachedSecretSelector. Managed fields are dropped from cached objects since nothing reads them.
+func CacheOptions(watchNamespaces []string) cache.Options {
+	options := cache.Options{
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.Secret{}: {Label: CachedSecretSelector()},
+		},
+		DefaultTransform: cache.TransformStripManagedFields(),
+	}
+
+	if len(watchNamespaces) > 0 {
+		options.DefaultNamespaces = map[string]cache.Config{}
+		for _, namespace := range watchNamespaces {
+			options.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	}
+
+	return options
+}
+
+// GetSecret reads a secret through the cache, falling back to apiReader for secrets that are not cached because
+// they are not labelled for it. apiReader may be nil when the cache holds every secret.
+func GetSecret(ctx context.Context, cached client.Reader, apiReader client.Reader, key types.NamespacedName, secret *corev1.Secret) error {
+	err := cached.Get(ctx, key, secret)
+	if apiReader == nil || !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	return apiReader.Get(ctx, key, secret)
+}
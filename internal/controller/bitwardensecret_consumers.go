@@ -0,0 +1,303 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+const (
+	// Condition reporting whether the Kubernetes secret of a BitwardenSecret is consumed, and only through keys it contains
+	ConditionConsumersReady = "ConsumersReady"
+	ReasonConsumersFound    = "ConsumersFound"
+	ReasonNoConsumers       = "NoConsumers"
+	ReasonMissingKeys       = "MissingKeys"
+
+	// Field index of pods and workloads by the names of the secrets they reference
+	secretConsumerIndex = "spec.secretRefs"
+
+	// Consumers beyond this number are counted in the ConsumersReady condition but not listed in the status
+	maxListedConsumers = 100
+)
+
+// ConsumerTracker finds the workloads and pods referencing the Kubernetes secrets written by the operator, so
+// that it is known who uses a credential before it is rotated.
+//
+// Pods are grouped by their controller, such as a ReplicaSet or Job, and the pod templates of Deployments,
+// StatefulSets and DaemonSets are listed as well, so that workloads scaled to zero are found too.
+type ConsumerTracker struct {
+	// Reader lists the pods and workloads from the cache indexed by IndexConsumers
+	Reader   client.Reader
+	Recorder events.EventRecorder
+}
+
+// IndexConsumers indexes pods and workloads by the names of the secrets they reference.
+func IndexConsumers(ctx context.Context, indexer client.FieldIndexer) error {
+	for _, obj := range []client.Object{&corev1.Pod{}, &appsv1.Deployment{}, &appsv1.StatefulSet{}, &appsv1.DaemonSet{}} {
+		if err := indexer.IndexField(ctx, obj, secretConsumerIndex, indexSecretConsumer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indexSecretConsumer(obj client.Object) []string {
+	var spec *corev1.PodSpec
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		spec = &o.Spec
+	case *appsv1.Deployment:
+		spec = &o.Spec.Template.Spec
+	case *appsv1.StatefulSet:
+		spec = &o.Spec.Template.Spec
+	case *appsv1.DaemonSet:
+		spec = &o.Spec.Template.Spec
+	default:
+		return nil
+	}
+	return slices.Sorted(maps.Keys(SecretReferences(spec)))
+}
+
+// SecretReferences returns the keys of each secret a pod spec references through env, envFrom, volumes or
+// imagePullSecrets. Secrets only referenced as a whole, such as through envFrom, map to no keys.
+func SecretReferences(spec *corev1.PodSpec) map[string][]string {
+	refs := map[string][]string{}
+	reference := func(name string, keys ...string) {
+		if name != "" {
+			refs[name] = append(refs[name], keys...)
+		}
+	}
+	itemKeys := func(items []corev1.KeyToPath) []string {
+		keys := make([]string, 0, len(items))
+		for _, item := range items {
+			keys = append(keys, item.Key)
+		}
+		return keys
+	}
+
+	for _, pullSecret := range spec.ImagePullSecrets {
+		reference(pullSecret.Name)
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil {
+			reference(volume.Secret.SecretName, itemKeys(volume.Secret.Items)...)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					reference(source.Secret.Name, itemKeys(source.Secret.Items)...)
+				}
+			}
+		}
+	}
+
+	referenceEnv := func(envFrom []corev1.EnvFromSource, env []corev1.EnvVar) {
+		for _, source := range envFrom {
+			if source.SecretRef != nil {
+				reference(source.SecretRef.Name)
+			}
+		}
+		for _, variable := range env {
+			if variable.ValueFrom != nil && variable.ValueFrom.SecretKeyRef != nil {
+				reference(variable.ValueFrom.SecretKeyRef.Name, variable.ValueFrom.SecretKeyRef.Key)
+			}
+		}
+	}
+	for _, container := range slices.Concat(spec.InitContainers, spec.Containers) {
+		referenceEnv(container.EnvFrom, container.Env)
+	}
+	for _, container := range spec.EphemeralContainers {
+		referenceEnv(container.EnvFrom, container.Env)
+	}
+
+	for name, keys := range refs {
+		slices.Sort(keys)
+		refs[name] = slices.Compact(keys)
+	}
+	return refs
+}
+
+// Consumers returns the consumers of a secret, sorted by kind and name, together with the keys they reference
+// that are missing from the data of the secret. Pods that have terminated are not consumers.
+func (t *ConsumerTracker) Consumers(ctx context.Context, namespace string, secretName string, data map[string][]byte) ([]operatorsv1.SecretConsumer, error) {
+	found := map[string]*operatorsv1.SecretConsumer{}
+	add := func(kind string, name string, pods int32, spec *corev1.PodSpec) {
+		consumer, ok := found[kind+"/"+name]
+		if !ok {
+			consumer = &operatorsv1.SecretConsumer{Kind: kind, Name: name}
+			found[kind+"/"+name] = consumer
+		}
+		consumer.Pods += pods
+		for _, key := range SecretReferences(spec)[secretName] {
+			if _, ok := data[key]; !ok && !slices.Contains(consumer.MissingKeys, key) {
+				consumer.MissingKeys = append(consumer.MissingKeys, key)
+			}
+		}
+	}
+
+	opts := []client.ListOption{client.InNamespace(namespace), client.MatchingFields{secretConsumerIndex: secretName}}
+
+	pods := &corev1.PodList{}
+	if err := t.Reader.List(ctx, pods, opts...); err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if owner := metav1.GetControllerOf(pod); owner != nil {
+			add(owner.Kind, owner.Name, 1, &pod.Spec)
+		} else {
+			add("Pod", pod.Name, 1, &pod.Spec)
+		}
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := t.Reader.List(ctx, deployments, opts...); err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		add("Deployment", deployments.Items[i].Name, 0, &deployments.Items[i].Spec.Template.Spec)
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := t.Reader.List(ctx, statefulSets, opts...); err != nil {
+		return nil, err
+	}
+	for i := range statefulSets.Items {
+		add("StatefulSet", statefulSets.Items[i].Name, 0, &statefulSets.Items[i].Spec.Template.Spec)
+	}
+
+	daemonSets := &appsv1.DaemonSetList{}
+	if err := t.Reader.List(ctx, daemonSets, opts...); err != nil {
+		return nil, err
+	}
+	for i := range daemonSets.Items {
+		add("DaemonSet", daemonSets.Items[i].Name, 0, &daemonSets.Items[i].Spec.Template.Spec)
+	}
+
+	consumers := make([]operatorsv1.SecretConsumer, 0, len(found))
+	for _, consumer := range found {
+		slices.Sort(consumer.MissingKeys)
+		consumers = append(consumers, *consumer)
+	}
+	slices.SortFunc(consumers, func(a, b operatorsv1.SecretConsumer) int {
+		return cmp.Or(cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Name, b.Name))
+	})
+	return consumers, nil
+}
+
+// ConsumersCondition returns the ConsumersReady condition for the consumers of a secret.
+func ConsumersCondition(secretName string, consumers []operatorsv1.SecretConsumer) metav1.Condition {
+	if len(consumers) == 0 {
+		return metav1.Condition{
+			Type:    ConditionConsumersReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  ReasonNoConsumers,
+			Message: fmt.Sprintf("No workload or pod references secret %s", secretName),
+		}
+	}
+
+	var missing []string
+	for _, consumer := range consumers {
+		if len(consumer.MissingKeys) > 0 {
+			missing = append(missing, fmt.Sprintf("%s/%s references %s", consumer.Kind, consumer.Name, strings.Join(consumer.MissingKeys, ", ")))
+		}
+	}
+	if len(missing) > 0 {
+		return metav1.Condition{
+			Type:    ConditionConsumersReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  ReasonMissingKeys,
+			Message: fmt.Sprintf("Keys missing from secret %s: %s", secretName, strings.Join(missing, "; ")),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    ConditionConsumersReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonConsumersFound,
+		Message: fmt.Sprintf("%d consumers reference secret %s", len(consumers), secretName),
+	}
+}
+
+// recordConsumers publishes the consumers of the Kubernetes secret of a BitwardenSecret, and warns when the
+// secret has none or when they reference keys it does not contain. Failing to record them does not fail the sync.
+func (r *BitwardenSecretReconciler) recordConsumers(logger logr.Logger, ctx context.Context, bwSecret *operatorsv1.BitwardenSecret) {
+	secretName := bwSecret.Spec.SecretName
+	if bwSecret.Spec.Versioning != nil {
+		secretName = bwSecret.Status.CurrentSecretName
+	}
+	if secretName == "" {
+		return
+	}
+
+	secret := &corev1.Secret{}
+	if err := GetSecret(ctx, r.Client, r.APIReader, types.NamespacedName{Namespace: bwSecret.Namespace, Name: secretName}, secret); err != nil {
+		logger.Error(err, "Failed to read the secret to find its consumers")
+		return
+	}
+
+	consumers, err := r.Consumers.Consumers(ctx, bwSecret.Namespace, secretName, secret.Data)
+	if err != nil {
+		logger.Error(err, "Failed to find the consumers of the secret")
+		return
+	}
+
+	original := bwSecret.DeepCopy()
+	condition := ConsumersCondition(secretName, consumers)
+	changed := apimeta.SetStatusCondition(&bwSecret.Status.Conditions, condition)
+	bwSecret.Status.Consumers = consumers[:min(len(consumers), maxListedConsumers)]
+	if len(bwSecret.Status.Consumers) == 0 {
+		bwSecret.Status.Consumers = nil
+	}
+	if !changed && equality.Semantic.DeepEqual(original.Status.Consumers, bwSecret.Status.Consumers) {
+		return
+	}
+
+	if err := r.Status().Patch(ctx, bwSecret, client.MergeFrom(original)); err != nil {
+		logger.Error(err, "Failed to record the consumers of BitwardenSecret")
+		return
+	}
+
+	if changed && condition.Status == metav1.ConditionFalse && r.Consumers.Recorder != nil {
+		r.Consumers.Recorder.Eventf(bwSecret, nil, corev1.EventTypeWarning, condition.Reason, "TrackConsumers", "%s", condition.Message)
+	}
+}
@@ -21,20 +21,35 @@ Trademark Guidelines
 package controller
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	sdk "github.com/bitwarden/sdk-go/v2"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"k8s.io/utils/ptr"
 
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -48,14 +63,39 @@ const (
 	AnnotationCustomMap = "k8s.bitwarden.com/custom-map"
 )
 
+// Field index of BitwardenSecrets by the name of their auth token secret
+const authTokenSecretIndex = "spec.authToken.secretName"
+
 // BitwardenSecretReconciler reconciles a BitwardenSecret object
 type BitwardenSecretReconciler struct {
 	client.Client
-	Scheme                  *runtime.Scheme
-	BitwardenClientFactory  BitwardenClientFactory
-	StatePath               string
-	RefreshIntervalSeconds  int
+	Scheme                 *runtime.Scheme
+	BitwardenClientFactory BitwardenClientFactory
+	StateStore             *StateStore
+	SyncCache              *SyncCache
+	RefreshIntervalSeconds int
+	// MaxConcurrentReconciles is the number of BitwardenSecrets synced in parallel. Defaults to 1.
+	MaxConcurrentReconciles int
+	// APIReader reads the secrets that are not kept in the cache. Every secret is read through the cache when nil.
+	APIReader client.Reader
+	// Reloader restarts the workloads consuming a secret when its data changes. Workloads are not restarted when nil.
+	Reloader *Reloader
+	// Delivered keeps the data of BitwardenSecrets delivered by injection. BitwardenSecrets with the Inject
+	// delivery mode are rejected when nil.
+	Delivered *DeliveryCache
+	// Consumers finds the workloads and pods referencing the secrets. Consumers are not tracked when nil.
+	Consumers *ConsumerTracker
+	// Shards splits the BitwardenSecrets between the replicas of the operator. Every BitwardenSecret is
+	// synced by the leader when nil.
+	Shards *ShardManager
+	// WatchNamespaces are the namespaces the manager cache is restricted to. All namespaces are watched when empty.
+	WatchNamespaces []string
+	// RedactIdentifiers replaces organization and secret IDs in log messages with a hash of them
+	RedactIdentifiers       bool
 	SetK8sSecretAnnotations func(*operatorsv1.BitwardenSecret, *corev1.Secret) error
+
+	// Guards the settings that can be changed while the operator is running
+	settingsMu sync.RWMutex
 }
 
 //+kubebuilder:rbac:groups=k8s.bitwarden.com,resources=bitwardensecrets,verbs=get;list;watch;create;update;patch;delete
@@ -63,6 +103,11 @@ type BitwardenSecretReconciler struct {
 //+kubebuilder:rbac:groups=k8s.bitwarden.com,resources=bitwardensecrets/finalizers,verbs=update
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=secrets/status,verbs=get
+//+kubebuilder:rbac:groups=k8s.bitwarden.com,resources=bitwardensecretpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -82,26 +127,55 @@ func (r *BitwardenSecretReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		//Error was due to missing item
 		if k8serrors.IsNotFound(err) {
 			logger.Info(fmt.Sprintf("%s/%s was deleted.", req.NamespacedName.Namespace, req.Name))
+			r.Delivered.Delete(req.NamespacedName)
 			return ctrl.Result{}, err
 		}
 
-		logErr := r.LogError(logger, ctx, bwSecret, err, "Error looking up BitwardenSecret")
+		//Other lookup error. Without the object no status can be recorded, so the default rate limiter retries
+		logger.Error(err, "Error looking up BitwardenSecret")
+		return ctrl.Result{}, err
+	}
 
-		//Other lookup error
-		return ctrl.Result{RequeueAfter: time.Duration(r.RefreshIntervalSeconds) * time.Second}, logErr
+	// Every replica watches all BitwardenSecrets, but only syncs those of the shards it holds
+	if !r.Shards.Owns(bwSecret.UID) {
+		r.Delivered.Delete(req.NamespacedName)
+		return ctrl.Result{}, nil
 	}
 
 	// Validate that useSecretNames and onlyMappedSecrets are not both enabled
 	if bwSecret.Spec.UseSecretNames && bwSecret.Spec.OnlyMappedSecrets {
-		err := fmt.Errorf("useSecretNames and onlyMappedSecrets cannot both be enabled; these options are mutually exclusive")
-		logErr := r.LogError(logger, ctx, bwSecret, err, "Invalid BitwardenSecret configuration")
-		return ctrl.Result{}, logErr
+		err := NewPermanentError(fmt.Errorf("useSecretNames and onlyMappedSecrets cannot both be enabled; these options are mutually exclusive"))
+		return r.HandleSyncError(logger, ctx, bwSecret, err, "Invalid BitwardenSecret configuration", "")
+	}
+
+	inject := bwSecret.Spec.Delivery == operatorsv1.DeliveryInject
+	if inject && r.Delivered == nil {
+		err := NewPermanentError(fmt.Errorf("the Inject delivery mode requires the injection or delivery API feature of the operator"))
+		return r.HandleSyncError(logger, ctx, bwSecret, err, "Invalid BitwardenSecret configuration", "")
+	}
+
+	policies, err := GetApplicablePolicies(ctx, r.Client, req.NamespacedName.Namespace)
+	if err != nil {
+		return r.HandleSyncError(logger, ctx, bwSecret, err, "Error looking up BitwardenSecretPolicies", "")
+	}
+
+	if violations := CheckSpecPolicies(policies, bwSecret); len(violations) > 0 {
+		return r.LogPolicyViolation(logger, ctx, bwSecret, violations, "")
 	}
 
 	lastSync := bwSecret.Status.LastSuccessfulSyncTime
 
-	if !lastSync.IsZero() && time.Now().UTC().Before(lastSync.Time.Add(time.Duration(r.RefreshIntervalSeconds)*time.Second)) {
-		return ctrl.Result{}, nil
+	// Injected data only lives in memory, so it is pulled in full after a restart of the operator
+	_, delivered := r.Delivered.Get(bwSecret)
+	if inject && !delivered {
+		lastSync = metav1.Time{}
+	}
+
+	// A failed sync is retried according to its backoff instead of waiting for the next refresh
+	if bwSecret.Status.Backoff == nil && !lastSync.IsZero() {
+		if nextSync := NextSyncTime(bwSecret.UID, r.refreshInterval(), lastSync.Time); time.Now().UTC().Before(nextSync) {
+			return ctrl.Result{RequeueAfter: time.Until(nextSync)}, nil
+		}
 	}
 
 	message := fmt.Sprintf("Syncing  %s/%s", req.NamespacedName.Namespace, req.Name)
@@ -114,154 +188,442 @@ func (r *BitwardenSecretReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		Namespace: req.NamespacedName.Namespace,
 	}
 
-	err = r.Get(ctx, namespacedAuthK8sSecret, authK8sSecret)
+	err = GetSecret(ctx, r.Client, r.APIReader, namespacedAuthK8sSecret, authK8sSecret)
 
 	if err != nil {
-		logErr := r.LogError(logger, ctx, bwSecret, err, "Error pulling authorization token secret")
+		if k8serrors.IsNotFound(err) {
+			err = NewAuthError(err)
+		}
+		return r.HandleSyncError(logger, ctx, bwSecret, err, "Error pulling authorization token secret", "")
+	}
 
-		return ctrl.Result{
-			RequeueAfter: time.Duration(r.RefreshIntervalSeconds) * time.Second,
-		}, logErr
+	authTokenVersion := authK8sSecret.ResourceVersion
+	if WaitingForAuthTokenRotation(bwSecret, authTokenVersion) {
+		logger.Info(fmt.Sprintf("Authentication failed for %s/%s with the current auth token. Waiting for %s/%s to change.", req.NamespacedName.Namespace, req.Name, req.NamespacedName.Namespace, bwSecret.Spec.AuthToken.SecretName))
+		if !r.authTokenWatched(ctx, bwSecret) {
+			// Changes to auth token secrets outside of the cache are not watched, so check for a rotation periodically
+			return ctrl.Result{RequeueAfter: r.refreshInterval()}, nil
+		}
+		return ctrl.Result{}, nil
 	}
 
 	data, ok := authK8sSecret.Data[bwSecret.Spec.AuthToken.SecretKey]
 	if !ok || authK8sSecret.Data == nil {
-		err := fmt.Errorf("auth token secret key %s not found in %s/%s", bwSecret.Spec.AuthToken.SecretKey, req.NamespacedName.Namespace, bwSecret.Spec.AuthToken.SecretName)
-		logErr := r.LogError(logger, ctx, bwSecret, err, "Invalid authorization token secret")
-		return ctrl.Result{RequeueAfter: time.Duration(r.RefreshIntervalSeconds) * time.Second}, logErr
+		err := NewAuthError(fmt.Errorf("auth token secret key %s not found in %s/%s", bwSecret.Spec.AuthToken.SecretKey, req.NamespacedName.Namespace, bwSecret.Spec.AuthToken.SecretName))
+		return r.HandleSyncError(logger, ctx, bwSecret, err, "Invalid authorization token secret", authTokenVersion)
 	}
 	authToken := string(data)
 	orgId := bwSecret.Spec.OrganizationId
 
+	// The Kubernetes secret may not have been written by the failed sync, so a retry pulls everything again
+	if bwSecret.Status.Backoff != nil {
+		lastSync = metav1.Time{}
+	}
+
 	//Get the secrets from the Bitwarden API based on lastSync and organizationId
 	//This will also indicate if the Bitwarden secret needs to be refreshed
-	refresh, secrets, err := r.PullSecretManagerSecretDeltas(logger, orgId, authToken, lastSync.Time, bwSecret.Spec.UseSecretNames)
+	var refresh bool
+	var smSecrets []sdk.SecretResponse
+	var missingSecrets []operatorsv1.MissingSecret
+	if bwSecret.Spec.OnlyMappedSecrets {
+		refresh, smSecrets, missingSecrets, err = r.PullMappedSecrets(logger, bwSecret, authToken, lastSync.Time)
+	} else {
+		refresh, smSecrets, err = r.PullSecretManagerSecretDeltas(logger, orgId, authToken, lastSync.Time)
+	}
 
 	if err != nil {
-		logErr := r.LogError(logger, ctx, bwSecret, err, fmt.Sprintf("Error pulling Secret Manager secrets from API => API: %s -- Identity: %s -- State: %s -- OrgId: %s ", r.BitwardenClientFactory.GetApiUrl(), r.BitwardenClientFactory.GetIdentityApiUrl(), r.StatePath, orgId))
-
-		return ctrl.Result{
-			RequeueAfter: time.Duration(r.RefreshIntervalSeconds) * time.Second,
-		}, logErr
+		return r.HandleSyncError(logger, ctx, bwSecret, err, fmt.Sprintf("Error pulling Secret Manager secrets from API => API: %s -- Identity: %s -- State: %s -- OrgId: %s ", r.BitwardenClientFactory.GetApiUrl(), r.BitwardenClientFactory.GetIdentityApiUrl(), r.StateStore.Dir, r.redact(orgId)), authTokenVersion)
 	}
 
 	if refresh {
-		//Get The Bitwarden Secret from the K8s api
-		k8sSecret := &corev1.Secret{}
-
-		namespacedK8sSecret := types.NamespacedName{
-			Name:      bwSecret.Spec.SecretName,
-			Namespace: req.NamespacedName.Namespace,
+		if violations := CheckProjectPolicies(policies, smSecrets); len(violations) > 0 {
+			return r.LogPolicyViolation(logger, ctx, bwSecret, violations, authTokenVersion)
 		}
 
-		err = r.Get(ctx, namespacedK8sSecret, k8sSecret)
+		// Invalid key names come from the secrets in Secrets Manager, so they are retried like transient errors
+		data, err := RenderSecretData(logger, bwSecret, smSecrets)
+		if err != nil {
+			return r.HandleSyncError(logger, ctx, bwSecret, err, "Error mapping Secret Manager secrets", authTokenVersion)
+		}
 
-		//Bitwarden secret doesn't exist; need to create it
-		if err != nil && k8serrors.IsNotFound(err) {
-			k8sSecret = CreateK8sSecret(bwSecret)
+		if violations := CheckKeyCountPolicies(policies, len(data)); len(violations) > 0 {
+			return r.LogPolicyViolation(logger, ctx, bwSecret, violations, authTokenVersion)
+		}
 
-			// Set up the controller reference; Handle any error
-			if err := ctrl.SetControllerReference(bwSecret, k8sSecret, r.Scheme); err != nil {
-				logError := r.LogError(logger, ctx, bwSecret, err, "Failed to set controller reference")
-				return ctrl.Result{
-					RequeueAfter: time.Duration(r.RefreshIntervalSeconds) * time.Second,
-				}, logError
+		var currentSecretName string
+		if inject {
+			r.Delivered.Store(bwSecret, data)
+		} else if bwSecret.Spec.Versioning != nil {
+			if violations := CheckSecretNamePolicies(policies, VersionedSecretName(bwSecret.Spec.SecretName, data)); len(violations) > 0 {
+				return r.LogPolicyViolation(logger, ctx, bwSecret, violations, authTokenVersion)
 			}
+			currentSecretName, err = r.syncVersionedSecret(logger, ctx, bwSecret, data)
+			if err != nil {
+				return r.HandleSyncError(logger, ctx, bwSecret, err, fmt.Sprintf("Failed to write versioned secret for %s/%s", req.NamespacedName.Namespace, req.Name), authTokenVersion)
+			}
+		} else {
+			//Get The Bitwarden Secret from the K8s api
+			k8sSecret := &corev1.Secret{}
 
-			// Create the new Bitwarden Secret; Handle any error
-			if err := r.Create(ctx, k8sSecret); err != nil {
-				logError := r.LogError(logger, ctx, bwSecret, err, "Creation of K8s secret failed.")
-				return ctrl.Result{
-					RequeueAfter: time.Duration(r.RefreshIntervalSeconds) * time.Second,
-				}, logError
+			namespacedK8sSecret := types.NamespacedName{
+				Name:      bwSecret.Spec.SecretName,
+				Namespace: req.NamespacedName.Namespace,
 			}
 
-			r.Get(ctx, namespacedK8sSecret, k8sSecret) //Ensuring we have the latest version of the object.
+			// Secrets written before they were labelled for the cache are only found by the API reader
+			err = GetSecret(ctx, r.Client, r.APIReader, namespacedK8sSecret, k8sSecret)
 
-		}
+			//Bitwarden secret doesn't exist; need to create it
+			created := err != nil && k8serrors.IsNotFound(err)
+			if created {
+				k8sSecret = CreateK8sSecret(bwSecret, data)
 
-		secretDeepCopy := k8sSecret.DeepCopy() //Need a copy of the original
+				// Set up the controller reference; Handle any error
+				if err := ctrl.SetControllerReference(bwSecret, k8sSecret, r.Scheme); err != nil {
+					return r.HandleSyncError(logger, ctx, bwSecret, err, "Failed to set controller reference", authTokenVersion)
+				}
 
-		if k8sSecret.ObjectMeta.Labels == nil {
-			k8sSecret.ObjectMeta.Labels = map[string]string{}
-		}
-		k8sSecret.ObjectMeta.Labels[LabelBwSecret] = string(bwSecret.UID)
+				// Create the new Bitwarden Secret; Handle any error
+				if err := r.Create(ctx, k8sSecret); err != nil {
+					return r.HandleSyncError(logger, ctx, bwSecret, err, "Creation of K8s secret failed.", authTokenVersion)
+				}
+
+				GetSecret(ctx, r.Client, r.APIReader, namespacedK8sSecret, k8sSecret) //Ensuring we have the latest version of the object.
 
-		ApplySecretMap(secrets, bwSecret, k8sSecret)
+			}
 
-		err = r.SetK8sSecretAnnotations(bwSecret, k8sSecret)
+			secretDeepCopy := k8sSecret.DeepCopy() //Need a copy of the original
 
-		if err != nil {
-			r.LogWarning(logger, ctx, bwSecret, err, fmt.Sprintf("Error setting annotations for  %s/%s", req.NamespacedName.Namespace, req.Name)) //Annotation failure is not critical. Log, but don't fail the process
+			if k8sSecret.ObjectMeta.Labels == nil {
+				k8sSecret.ObjectMeta.Labels = map[string]string{}
+			}
+			k8sSecret.ObjectMeta.Labels[LabelBwSecret] = string(bwSecret.UID)
+			k8sSecret.ObjectMeta.Labels[LabelSecretRole] = SecretRoleSynced
+
+			k8sSecret.Data = data
+
+			err = r.SetK8sSecretAnnotations(bwSecret, k8sSecret)
+
+			if err != nil {
+				r.LogWarning(logger, ctx, bwSecret, err, fmt.Sprintf("Error setting annotations for  %s/%s", req.NamespacedName.Namespace, req.Name)) //Annotation failure is not critical. Log, but don't fail the process
+			}
+
+			// Changes to other secrets of the organization are reported too, and rewriting unchanged data would
+			// only churn the resource version of the secret
+			if SecretUnchanged(secretDeepCopy, k8sSecret) {
+				logger.Info(fmt.Sprintf("Data of %s/%s is unchanged.  Skipping write.", req.NamespacedName.Namespace, bwSecret.Spec.SecretName))
+			} else {
+				secretPatch := client.MergeFrom(secretDeepCopy)
+				err = r.Patch(ctx, k8sSecret, secretPatch)
+				if err != nil {
+					return r.HandleSyncError(logger, ctx, bwSecret, err, fmt.Sprintf("Failed to update  %s/%s", req.NamespacedName.Namespace, req.Name), authTokenVersion)
+				}
+
+				// Pods only start consuming a newly created secret, so only changed data restarts workloads
+				if r.Reloader != nil && !created && !maps.EqualFunc(secretDeepCopy.Data, k8sSecret.Data, bytes.Equal) {
+					if _, err := r.Reloader.Reload(ctx, bwSecret, k8sSecret); err != nil {
+						r.LogWarning(logger, ctx, bwSecret, err, fmt.Sprintf("Error restarting the workloads consuming %s/%s", req.NamespacedName.Namespace, bwSecret.Spec.SecretName)) //The secret is synced, so this does not fail the sync
+					}
+				}
+			}
 		}
 
-		secretPatch := client.MergeFrom(secretDeepCopy)
-		err = r.Patch(ctx, k8sSecret, secretPatch)
-		if err != nil {
-			logError := r.LogError(logger, ctx, bwSecret, err, fmt.Sprintf("Failed to update  %s/%s", req.NamespacedName.Namespace, req.Name))
-			return ctrl.Result{
-				RequeueAfter: time.Duration(r.RefreshIntervalSeconds) * time.Second,
-			}, logError
+		if err := r.setCurrentSecretAnnotation(ctx, bwSecret, currentSecretName); err != nil {
+			return r.HandleSyncError(logger, ctx, bwSecret, err, fmt.Sprintf("Failed to annotate %s/%s with its current secret", req.NamespacedName.Namespace, req.Name), authTokenVersion)
 		}
 
-		if logError := r.LogCompletion(logger, ctx, bwSecret, fmt.Sprintf("Completed sync for %s/%s", req.NamespacedName.Namespace, req.Name)); logError != nil {
-			return ctrl.Result{
-				RequeueAfter: time.Duration(r.RefreshIntervalSeconds) * time.Second,
-			}, logError
+		if logError := r.LogCompletion(logger, ctx, bwSecret, fmt.Sprintf("Completed sync for %s/%s", req.NamespacedName.Namespace, req.Name), missingSecrets, currentSecretName); logError != nil {
+			// Failing to record the sync is retried by the default rate limiter
+			return ctrl.Result{}, logError
 		}
 	} else {
 		logger.Info(fmt.Sprintf("No changes to %s/%s.  Skipping sync.", req.NamespacedName.Namespace, req.Name))
+		r.recordChecked(logger, ctx, bwSecret)
 	}
 
+	if r.Consumers != nil && !inject {
+		r.recordConsumers(logger, ctx, bwSecret)
+	}
+
+	now := time.Now().UTC()
 	return ctrl.Result{
-		RequeueAfter: time.Duration(r.RefreshIntervalSeconds) * time.Second,
+		RequeueAfter: NextSyncTime(bwSecret.UID, r.refreshInterval(), now).Sub(now),
 	}, nil
 }
 
+func (r *BitwardenSecretReconciler) refreshInterval() time.Duration {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+
+	return time.Duration(r.RefreshIntervalSeconds) * time.Second
+}
+
+// SetRefreshInterval changes how often BitwardenSecrets are synced, starting with their next sync.
+func (r *BitwardenSecretReconciler) SetRefreshInterval(seconds int) {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	r.RefreshIntervalSeconds = seconds
+}
+
+// SetRedactIdentifiers changes whether organization and secret IDs are redacted from log messages.
+func (r *BitwardenSecretReconciler) SetRedactIdentifiers(redact bool) {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+
+	r.RedactIdentifiers = redact
+}
+
+// redact returns the identifier, or a short hash of it when identifiers are redacted from log messages.
+func (r *BitwardenSecretReconciler) redact(identifier string) string {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+
+	if !r.RedactIdentifiers || identifier == "" {
+		return identifier
+	}
+	return "redacted:" + HashAuthToken(identifier)[:12]
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *BitwardenSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	if r.SetK8sSecretAnnotations == nil {
 		r.SetK8sSecretAnnotations = SetK8sSecretAnnotations
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&operatorsv1.BitwardenSecret{}).
-		Complete(r)
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &operatorsv1.BitwardenSecret{}, authTokenSecretIndex, func(obj client.Object) []string {
+		return []string{obj.(*operatorsv1.BitwardenSecret).Spec.AuthToken.SecretName}
+	}); err != nil {
+		return err
+	}
+
+	if r.Consumers != nil {
+		if err := IndexConsumers(context.Background(), mgr.GetFieldIndexer()); err != nil {
+			return err
+		}
+	}
+
+	maxConcurrentReconciles := r.MaxConcurrentReconciles
+	if maxConcurrentReconciles < 1 {
+		maxConcurrentReconciles = 1
+	}
+
+	options := controller.Options{
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		RateLimiter:             NewReconcileRateLimiter(r.refreshInterval()),
+	}
+
+	// Status updates do not change the generation, so recording a failure does not trigger another attempt
+	bldr := ctrl.NewControllerManagedBy(mgr).
+		For(&operatorsv1.BitwardenSecret{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&operatorsv1.BitwardenSecretPolicy{}, handler.EnqueueRequestsFromMapFunc(r.mapPolicyToBitwardenSecrets)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapAuthTokenSecretToBitwardenSecrets), builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}))
+
+	if r.Shards != nil {
+		// Every replica runs the controller, and the BitwardenSecrets of a shard are synced once it is acquired
+		options.NeedLeaderElection = ptr.To(false)
+		acquired := make(chan event.TypedGenericEvent[*operatorsv1.BitwardenSecret])
+		r.Shards.OnAcquire = func(ctx context.Context, shard int) {
+			r.enqueueShard(ctx, acquired, shard)
+		}
+		bldr = bldr.WatchesRawSource(source.Channel(acquired, &handler.TypedEnqueueRequestForObject[*operatorsv1.BitwardenSecret]{}))
+	}
+
+	return bldr.WithOptions(options).Complete(r)
+}
+
+// enqueueShard enqueues the BitwardenSecrets of a shard acquired by this replica, so that those that fell due
+// while another replica held the shard are synced right away.
+func (r *BitwardenSecretReconciler) enqueueShard(ctx context.Context, events chan<- event.TypedGenericEvent[*operatorsv1.BitwardenSecret], shard int) {
+	bwSecrets := &operatorsv1.BitwardenSecretList{}
+	if err := r.List(ctx, bwSecrets); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list BitwardenSecrets of acquired shard", "shard", shard)
+		return
+	}
+
+	for i := range bwSecrets.Items {
+		if ShardFor(bwSecrets.Items[i].UID, r.Shards.Shards) == shard {
+			select {
+			case events <- event.TypedGenericEvent[*operatorsv1.BitwardenSecret]{Object: &bwSecrets.Items[i]}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// mapAuthTokenSecretToBitwardenSecrets enqueues the BitwardenSecrets using a changed secret as their auth token,
+// so that syncs that failed to authenticate are retried once the token is rotated.
+func (r *BitwardenSecretReconciler) mapAuthTokenSecretToBitwardenSecrets(ctx context.Context, obj client.Object) []reconcile.Request {
+	bwSecrets := &operatorsv1.BitwardenSecretList{}
+	if err := r.List(ctx, bwSecrets, client.InNamespace(obj.GetNamespace()), client.MatchingFields{authTokenSecretIndex: obj.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list BitwardenSecrets for auth token secret", "secret", obj.GetName(), "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, bwSecret := range bwSecrets.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: bwSecret.Name, Namespace: bwSecret.Namespace},
+		})
+	}
+
+	return requests
+}
+
+// mapPolicyToBitwardenSecrets enqueues the BitwardenSecrets in the namespaces selected by a changed policy.
+func (r *BitwardenSecretReconciler) mapPolicyToBitwardenSecrets(ctx context.Context, obj client.Object) []reconcile.Request {
+	logger := log.FromContext(ctx)
+
+	policy, ok := obj.(*operatorsv1.BitwardenSecretPolicy)
+	if !ok {
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.NamespaceSelector)
+	if err != nil {
+		logger.Error(err, "Invalid namespace selector in BitwardenSecretPolicy", "policy", policy.Name)
+		return nil
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		logger.Error(err, "Failed to list namespaces for BitwardenSecretPolicy", "policy", policy.Name)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ns := range namespaces.Items {
+		// Listing a namespace that is not cached fails
+		if len(r.WatchNamespaces) > 0 && !slices.Contains(r.WatchNamespaces, ns.Name) {
+			continue
+		}
+
+		bwSecrets := &operatorsv1.BitwardenSecretList{}
+		if err := r.List(ctx, bwSecrets, client.InNamespace(ns.Name)); err != nil {
+			logger.Error(err, "Failed to list BitwardenSecrets for BitwardenSecretPolicy", "policy", policy.Name, "namespace", ns.Name)
+			continue
+		}
+
+		for _, bwSecret := range bwSecrets.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: bwSecret.Name, Namespace: bwSecret.Namespace},
+			})
+		}
+	}
+
+	return requests
 }
 
 func (r *BitwardenSecretReconciler) LogWarning(logger logr.Logger, ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, err error, message string) {
 	logger.Error(err, message) // Log as warning or error
 }
 
-func (r *BitwardenSecretReconciler) LogError(logger logr.Logger, ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, err error, message string) error {
-	logger.Error(err, message)
+// HandleSyncError records a failed sync in the status of the BitwardenSecret and decides when to retry it.
+// Transient errors are requeued with jittered exponential backoff, capped at the refresh interval. Auth and
+// permanent errors are not requeued; the BitwardenSecret is reconciled again once its auth token secret or
+// its spec changes. Auth errors are retried at the next refresh when the auth token secret is not watched.
+func (r *BitwardenSecretReconciler) HandleSyncError(logger logr.Logger, ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, err error, message string, authTokenVersion string) (ctrl.Result, error) {
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) {
+		logger.Error(err, message)
+		return r.recordFailure(logger, ctx, bwSecret, err, fmt.Sprintf("%s - %s", message, err.Error()), authTokenVersion)
+	}
+
+	// The circuit breaker logs when it opens, so skipped syncs are not logged as errors again
+	logger.V(1).Info("Skipping sync while the Bitwarden API is unavailable", "retryAfter", circuitErr.RetryAfter)
+	return r.recordFailure(logger, ctx, bwSecret, err, fmt.Sprintf("%s - %s", message, err.Error()), authTokenVersion, metav1.Condition{
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonCircuitOpen,
+		Message: err.Error(),
+		Type:    ConditionBitwardenUnavailable,
+	})
+}
+
+// LogPolicyViolation records that the BitwardenSecret violates a BitwardenSecretPolicy and was not synced.
+// The BitwardenSecret is reconciled again once it or one of the policies changes.
+func (r *BitwardenSecretReconciler) LogPolicyViolation(logger logr.Logger, ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, violations []string, authTokenVersion string) (ctrl.Result, error) {
+	err := NewPermanentError(fmt.Errorf("BitwardenSecretPolicy violations: %s", strings.Join(violations, "; ")))
+	logger.Error(err, "BitwardenSecret violates namespace policy")
+
+	return r.recordFailure(logger, ctx, bwSecret, err, err.Error(), authTokenVersion, metav1.Condition{
+		Status:  metav1.ConditionTrue,
+		Reason:  "PolicyViolated",
+		Message: strings.Join(violations, "; "),
+		Type:    ConditionPolicyViolation,
+	})
+}
 
+func (r *BitwardenSecretReconciler) recordFailure(logger logr.Logger, ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, err error, message string, authTokenVersion string, conditions ...metav1.Condition) (ctrl.Result, error) {
 	// Re-fetch to get the latest version before status update to avoid conflict errors
 	if fetchErr := r.Get(ctx, types.NamespacedName{
 		Name:      bwSecret.Name,
 		Namespace: bwSecret.Namespace,
 	}, bwSecret); fetchErr != nil {
 		logger.Error(fetchErr, "Failed to re-fetch BitwardenSecret before status update")
-		return fetchErr
+		return ctrl.Result{}, fetchErr
 	}
 
-	errorCondition := metav1.Condition{
+	for _, condition := range conditions {
+		apimeta.SetStatusCondition(&bwSecret.Status.Conditions, condition)
+	}
+	reason := "ReconciliationFailed"
+	if IsTimeoutError(err) {
+		reason = ReasonBitwardenTimeout
+	} else if IsCircuitOpenError(err) {
+		reason = ReasonCircuitOpen
+	}
+	apimeta.SetStatusCondition(&bwSecret.Status.Conditions, metav1.Condition{
 		Status:  metav1.ConditionFalse,
-		Reason:  "ReconciliationFailed",
-		Message: fmt.Sprintf("%s - %s", message, err.Error()),
+		Reason:  reason,
+		Message: message,
 		Type:    "FailedSync",
+	})
+
+	class := ClassifyError(err)
+	now := time.Now().UTC()
+	backoff, delay := NextSyncBackoff(bwSecret, class, authTokenVersion, r.refreshInterval(), now)
+
+	// There is no point in retrying before the circuit breaker lets the next probe through
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) && circuitErr.RetryAfter > delay {
+		delay = circuitErr.RetryAfter
+		backoff.NextRetryTime = &metav1.Time{Time: now.Add(delay)}
 	}
+	bwSecret.Status.Backoff = backoff
 
-	apimeta.SetStatusCondition(&bwSecret.Status.Conditions, errorCondition)
 	if updateErr := r.Status().Update(ctx, bwSecret); updateErr != nil {
 		logger.Error(updateErr, "Failed to update BitwardenSecret status")
-		return updateErr
+		return ctrl.Result{}, updateErr
+	}
+
+	if class == ErrorClassTransient {
+		logger.Info("Retrying failed sync", "consecutiveFailures", backoff.ConsecutiveFailures, "retryAfter", delay)
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+
+	if class == ErrorClassAuth && !r.authTokenWatched(ctx, bwSecret) {
+		// A missing or invalid auth token secret outside of the cache would otherwise never be checked again
+		logger.Info("Retrying failed sync at the next refresh, since the auth token secret is not watched", "retryAfter", r.refreshInterval())
+		return ctrl.Result{RequeueAfter: r.refreshInterval()}, nil
 	}
 
-	return err
+	logger.Info("Not retrying failed sync until the BitwardenSecret or its auth token changes", "errorClass", class)
+	return ctrl.Result{}, reconcile.TerminalError(err)
 }
 
-func (r *BitwardenSecretReconciler) LogCompletion(logger logr.Logger, ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, message string) error {
+// authTokenWatched reports whether a change to the auth token secret of the BitwardenSecret triggers a sync.
+// Only the secrets in the cache are watched, so an auth token secret that is not labelled for it, or that
+// does not exist yet, has to be checked again periodically.
+func (r *BitwardenSecretReconciler) authTokenWatched(ctx context.Context, bwSecret *operatorsv1.BitwardenSecret) bool {
+	if r.APIReader == nil {
+		return true
+	}
+	key := types.NamespacedName{Namespace: bwSecret.Namespace, Name: bwSecret.Spec.AuthToken.SecretName}
+	return r.Get(ctx, key, &corev1.Secret{}) == nil
+}
+
+func (r *BitwardenSecretReconciler) LogCompletion(logger logr.Logger, ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, message string, missingSecrets []operatorsv1.MissingSecret, currentSecretName string) error {
 	logger.Info(message)
 
 	// Re-fetch to get the latest version before status update to avoid conflict errors
@@ -280,9 +642,30 @@ func (r *BitwardenSecretReconciler) LogCompletion(logger logr.Logger, ctx contex
 		Type:    "SuccessfulSync",
 	}
 
-	bwSecret.Status.LastSuccessfulSyncTime = metav1.Time{Time: time.Now().UTC()}
+	now := metav1.NewTime(time.Now().UTC())
+	bwSecret.Status.LastSuccessfulSyncTime = now
+	bwSecret.Status.LastCheckedTime = &now
 
 	apimeta.SetStatusCondition(&bwSecret.Status.Conditions, completeCondition)
+	bwSecret.Status.MissingSecrets = missingSecrets
+	bwSecret.Status.CurrentSecretName = currentSecretName
+	bwSecret.Status.Backoff = nil
+	if apimeta.FindStatusCondition(bwSecret.Status.Conditions, ConditionPolicyViolation) != nil {
+		apimeta.SetStatusCondition(&bwSecret.Status.Conditions, metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "PolicyCompliant",
+			Message: "The BitwardenSecret complies with all applicable BitwardenSecretPolicies",
+			Type:    ConditionPolicyViolation,
+		})
+	}
+	if apimeta.FindStatusCondition(bwSecret.Status.Conditions, ConditionBitwardenUnavailable) != nil {
+		apimeta.SetStatusCondition(&bwSecret.Status.Conditions, metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "BitwardenAvailable",
+			Message: "The Bitwarden API is reachable",
+			Type:    ConditionBitwardenUnavailable,
+		})
+	}
 	if updateErr := r.Status().Update(ctx, bwSecret); updateErr != nil {
 		logger.Error(updateErr, "Failed to update BitwardenSecret status")
 		return updateErr
@@ -291,6 +674,15 @@ func (r *BitwardenSecretReconciler) LogCompletion(logger logr.Logger, ctx contex
 	return nil
 }
 
+// recordChecked records that the Kubernetes secret was found up to date. Failing to record it does not fail the sync.
+func (r *BitwardenSecretReconciler) recordChecked(logger logr.Logger, ctx context.Context, bwSecret *operatorsv1.BitwardenSecret) {
+	original := bwSecret.DeepCopy()
+	bwSecret.Status.LastCheckedTime = &metav1.Time{Time: time.Now().UTC()}
+	if err := r.Status().Patch(ctx, bwSecret, client.MergeFrom(original)); err != nil {
+		logger.Error(err, "Failed to record the check of BitwardenSecret")
+	}
+}
+
 // ValidateK8sSecretKeyName validates that a secret key name conforms to Kubernetes requirements.
 // Kubernetes secret data keys must match the regex [-._a-zA-Z0-9]+
 // See: https://kubernetes.io/docs/concepts/configuration/secret/#restriction-names-data
@@ -344,45 +736,49 @@ func ValidateSecretKeyName(key string) error {
 	return nil
 }
 
-// This function will determine if any secrets have been updated and return all secrets assigned to the machine account if so.
-// First returned value is a boolean stating if something changed or not.
-// The second returned value is a mapping of secret IDs (or names if useSecretNames is true) and their values from Secrets Manager
-func (r *BitwardenSecretReconciler) PullSecretManagerSecretDeltas(logger logr.Logger, orgId string, authToken string, lastSync time.Time, useSecretNames bool) (bool, map[string][]byte, error) {
-	bitwardenClient, err := r.BitwardenClientFactory.GetBitwardenClient()
-	if err != nil {
-		logger.Error(err, "Failed to create client")
-		return false, nil, err
-	}
-
-	err = bitwardenClient.AccessTokenLogin(authToken, &r.StatePath)
-	if err != nil {
-		logger.Error(err, "Failed to authenticate")
-		return false, nil, err
-	}
+// PullSecretManagerSecretDeltas syncs the secrets of the organization changed since lastSync. See
+// SecretPuller.PullSecretManagerSecretDeltas.
+func (r *BitwardenSecretReconciler) PullSecretManagerSecretDeltas(logger logr.Logger, orgId string, authToken string, lastSync time.Time) (bool, []sdk.SecretResponse, error) {
+	return r.puller().PullSecretManagerSecretDeltas(logger, orgId, authToken, lastSync)
+}
 
-	secrets := map[string][]byte{}
+// PullMappedSecrets fetches only the secrets listed in the map of the BitwardenSecret. See
+// SecretPuller.PullMappedSecrets.
+func (r *BitwardenSecretReconciler) PullMappedSecrets(logger logr.Logger, bwSecret *operatorsv1.BitwardenSecret, authToken string, lastSync time.Time) (bool, []sdk.SecretResponse, []operatorsv1.MissingSecret, error) {
+	return r.puller().PullMappedSecrets(logger, bwSecret, authToken, lastSync)
+}
 
-	smSecretResponse, err := bitwardenClient.Secrets().Sync(orgId, &lastSync)
+// SyncSecrets logs in with the auth token and syncs the secrets of the organization changed since lastSync.
+func (r *BitwardenSecretReconciler) SyncSecrets(logger logr.Logger, orgId string, authToken string, lastSync *time.Time) (*sdk.SecretsSyncResponse, error) {
+	return r.puller().SyncSecrets(logger, orgId, authToken, lastSync)
+}
 
-	if err != nil {
-		logger.Error(err, "Failed to get secrets since last sync.")
-		return false, nil, err
-	}
+// WithBitwardenClient runs call with a Bitwarden client logged in with the auth token. See
+// SecretPuller.WithBitwardenClient.
+func (r *BitwardenSecretReconciler) WithBitwardenClient(logger logr.Logger, authToken string, call func(sdk.BitwardenClientInterface) error) error {
+	return r.puller().WithBitwardenClient(logger, authToken, call)
+}
 
-	if smSecretResponse == nil {
-		logger.Info("No secret response from Bitwarden")
-		return false, nil, nil
+// puller returns the puller of the secrets, which redacts identifiers as currently configured.
+func (r *BitwardenSecretReconciler) puller() *SecretPuller {
+	return &SecretPuller{
+		BitwardenClientFactory: r.BitwardenClientFactory,
+		StateStore:             r.StateStore,
+		SyncCache:              r.SyncCache,
+		Redact:                 r.redact,
 	}
+}
 
-	smSecretVals := smSecretResponse.Secrets
+// BuildSecretsData returns a mapping of secret IDs (or names if useSecretNames is true) and their values from Secrets Manager
+func BuildSecretsData(logger logr.Logger, smSecretVals []sdk.SecretResponse, useSecretNames bool) (map[string][]byte, error) {
+	secrets := map[string][]byte{}
 
 	// Use UUIDs as keys
 	if !useSecretNames {
 		for _, smSecretVal := range smSecretVals {
 			secrets[smSecretVal.ID] = []byte(smSecretVal.Value)
 		}
-		defer bitwardenClient.Close()
-		return smSecretResponse.HasChanges, secrets, nil
+		return secrets, nil
 	}
 
 	// Use secret names with validation and duplicate detection
@@ -420,8 +816,7 @@ func (r *BitwardenSecretReconciler) PullSecretManagerSecretDeltas(logger logr.Lo
 		}
 		errMsg += "\nKubernetes secret data keys must consist of alphanumeric characters, '-', '_', or '.'"
 
-		defer bitwardenClient.Close()
-		return false, nil, errors.New(errMsg)
+		return nil, errors.New(errMsg)
 	}
 
 	// Check for duplicates
@@ -441,8 +836,7 @@ func (r *BitwardenSecretReconciler) PullSecretManagerSecretDeltas(logger logr.Lo
 		}
 		errMsg += "\nMultiple secrets with the same name. Use unique names for secrets or disable useSecretNames."
 
-		defer bitwardenClient.Close()
-		return false, nil, errors.New(errMsg)
+		return nil, errors.New(errMsg)
 	}
 
 	// Second pass: build the secrets map using names
@@ -450,24 +844,53 @@ func (r *BitwardenSecretReconciler) PullSecretManagerSecretDeltas(logger logr.Lo
 		secrets[smSecretVal.Key] = []byte(smSecretVal.Value)
 	}
 
-	defer bitwardenClient.Close()
-	return smSecretResponse.HasChanges, secrets, nil
+	return secrets, nil
 }
 
-func CreateK8sSecret(bwSecret *operatorsv1.BitwardenSecret) *corev1.Secret {
+// CreateK8sSecret builds the secret written for a BitwardenSecret. The data is part of the created secret, since
+// the API server validates the keys of typed secrets such as kubernetes.io/tls on creation.
+func CreateK8sSecret(bwSecret *operatorsv1.BitwardenSecret, data map[string][]byte) *corev1.Secret {
+	if data == nil {
+		data = map[string][]byte{}
+	}
+
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        bwSecret.Spec.SecretName,
 			Namespace:   bwSecret.Namespace,
-			Labels:      map[string]string{},
+			Labels:      map[string]string{LabelSecretRole: SecretRoleSynced},
 			Annotations: map[string]string{},
 		},
 		Type: corev1.SecretTypeOpaque,
-		Data: map[string][]byte{},
+		Data: data,
 	}
+
+	if bwSecret.Spec.SecretType != "" {
+		secret.Type = bwSecret.Spec.SecretType
+	}
+
 	return secret
 }
 
+// SecretUnchanged reports whether writing the desired secret would change nothing but the sync time annotation
+// of the original secret.
+func SecretUnchanged(original *corev1.Secret, desired *corev1.Secret) bool {
+	if SecretContentHash(original.Data) != SecretContentHash(desired.Data) || !maps.Equal(original.Labels, desired.Labels) {
+		return false
+	}
+
+	annotations := maps.Clone(desired.Annotations)
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if syncTime, ok := original.Annotations[AnnotationSyncTime]; ok {
+		annotations[AnnotationSyncTime] = syncTime
+	} else {
+		delete(annotations, AnnotationSyncTime)
+	}
+	return maps.Equal(original.Annotations, annotations)
+}
+
 func ApplySecretMap(secrets map[string][]byte, bwSecret *operatorsv1.BitwardenSecret, k8sSecret *corev1.Secret) {
 	k8sSecret.Data = make(map[string][]byte)
 
@@ -0,0 +1,129 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+const (
+	// LabelInject opts a pod into injection. Only pods with the label set to "true" are sent to the webhook
+	// injecting data, so that other pods are never held up by the operator.
+	LabelInject = "k8s.bitwarden.com/inject"
+	// AnnotationInject names the BitwardenSecret whose data is injected into an annotated pod
+	AnnotationInject = "k8s.bitwarden.com/inject"
+	// AnnotationInjectFormat selects how injected data is written: "files", one file per key, or "env", a
+	// single secrets.env file of shell variable assignments
+	AnnotationInjectFormat = "k8s.bitwarden.com/inject-format"
+	// AnnotationInjectPath is the directory injected data is mounted at in the containers of a pod
+	AnnotationInjectPath = "k8s.bitwarden.com/inject-path"
+)
+
+// ErrNotDelivered is returned for BitwardenSecrets whose data is not available yet, because they were not
+// synced yet or are synced by another replica.
+var ErrNotDelivered = errors.New("the data of the BitwardenSecret is not available yet")
+
+type deliveredData struct {
+	uid  types.UID
+	data map[string][]byte
+}
+
+// DeliveryCache holds the data of BitwardenSecrets delivered by injection, which is never written to a
+// Kubernetes secret. The data only lives in the memory of the replica syncing the BitwardenSecret, so it is
+// pulled again after a restart.
+type DeliveryCache struct {
+	mu      sync.RWMutex
+	entries map[types.NamespacedName]deliveredData
+}
+
+func NewDeliveryCache() *DeliveryCache {
+	return &DeliveryCache{entries: map[types.NamespacedName]deliveredData{}}
+}
+
+// Store records the data synced for a BitwardenSecret.
+func (c *DeliveryCache) Store(bwSecret *operatorsv1.BitwardenSecret, data map[string][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[client.ObjectKeyFromObject(bwSecret)] = deliveredData{uid: bwSecret.UID, data: maps.Clone(data)}
+}
+
+// Get returns the data synced for a BitwardenSecret. Data stored for an earlier BitwardenSecret of the same
+// name is not returned.
+func (c *DeliveryCache) Get(bwSecret *operatorsv1.BitwardenSecret) (map[string][]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[client.ObjectKeyFromObject(bwSecret)]
+	if !ok || entry.uid != bwSecret.UID {
+		return nil, false
+	}
+	return entry.data, true
+}
+
+// Delete forgets the data of a BitwardenSecret that was deleted or is now synced by another replica.
+func (c *DeliveryCache) Delete(key types.NamespacedName) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// DeliveredData returns the data delivered to pods for a BitwardenSecret: the data kept by the DeliveryCache
+// for injected BitwardenSecrets, and the data of the Kubernetes secret for the others. It returns
+// ErrNotDelivered when the data is not available yet.
+func DeliveredData(ctx context.Context, cached client.Reader, apiReader client.Reader, deliveryCache *DeliveryCache, bwSecret *operatorsv1.BitwardenSecret) (map[string][]byte, error) {
+	if bwSecret.Spec.Delivery == operatorsv1.DeliveryInject {
+		if data, ok := deliveryCache.Get(bwSecret); ok {
+			return data, nil
+		}
+		return nil, ErrNotDelivered
+	}
+
+	secretName := bwSecret.Spec.SecretName
+	if bwSecret.Spec.Versioning != nil {
+		secretName = bwSecret.Status.CurrentSecretName
+	}
+	if secretName == "" || !BitwardenSecretSynced(bwSecret) {
+		return nil, ErrNotDelivered
+	}
+
+	secret := &corev1.Secret{}
+	if err := GetSecret(ctx, cached, apiReader, types.NamespacedName{Namespace: bwSecret.Namespace, Name: secretName}, secret); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return nil, ErrNotDelivered
+		}
+		return nil, err
+	}
+	return secret.Data, nil
+}
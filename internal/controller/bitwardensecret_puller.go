@@ -0,0 +1,228 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"slices"
+	"time"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+// SecretPuller fetches the secrets of BitwardenSecrets from Secrets Manager. The BitwardenSecret reconciler
+// writes them to Kubernetes secrets, and the CSI provider mounts them into volumes.
+type SecretPuller struct {
+	BitwardenClientFactory BitwardenClientFactory
+	StateStore             *StateStore
+	// SyncCache shares the syncs of an organization between BitwardenSecrets. Every sync calls Secrets Manager when nil.
+	SyncCache *SyncCache
+	// Redact replaces organization and secret IDs in log messages. IDs are logged as they are when nil.
+	Redact func(string) string
+}
+
+func (p *SecretPuller) redact(identifier string) string {
+	if p.Redact == nil {
+		return identifier
+	}
+	return p.Redact(identifier)
+}
+
+// PullSecretManagerSecretDeltas determines if any secrets have been updated and returns all secrets assigned to the machine account if so.
+// First returned value is a boolean stating if something changed or not.
+// The second returned value is the list of secrets from Secrets Manager
+func (p *SecretPuller) PullSecretManagerSecretDeltas(logger logr.Logger, orgId string, authToken string, lastSync time.Time) (bool, []sdk.SecretResponse, error) {
+	if p.SyncCache != nil {
+		// Cached syncs are shared between BitwardenSecrets with different last sync times, so they always
+		// contain every secret, and whether they changed since lastSync is decided here
+		smSecretResponse, err := p.SyncCache.Sync(orgId, authToken, func() (*sdk.SecretsSyncResponse, error) {
+			return p.SyncSecrets(logger, orgId, authToken, nil)
+		})
+		if err != nil {
+			return false, nil, err
+		}
+
+		if smSecretResponse == nil {
+			logger.Info("No secret response from Bitwarden")
+			return false, nil, nil
+		}
+
+		// The sync served at lastSync may have been cached for up to the TTL, so changes made shortly
+		// before lastSync may not have been part of it
+		since := lastSync.Add(-p.SyncCache.TTL)
+		refresh := lastSync.IsZero() || p.SyncCache.SecretsChangedSince(orgId, authToken, since)
+		for _, smSecret := range smSecretResponse.Secrets {
+			if smSecret.RevisionDate.After(since) {
+				refresh = true
+			}
+		}
+
+		return refresh, smSecretResponse.Secrets, nil
+	}
+
+	smSecretResponse, err := p.SyncSecrets(logger, orgId, authToken, &lastSync)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if smSecretResponse == nil {
+		logger.Info("No secret response from Bitwarden")
+		return false, nil, nil
+	}
+
+	return smSecretResponse.HasChanges, smSecretResponse.Secrets, nil
+}
+
+// PullMappedSecrets fetches only the secrets listed in the map of the BitwardenSecret.
+// First returned value is a boolean stating if something changed since lastSync, based on the revision dates of the secrets.
+// The second returned value is the list of fetched secrets and the third lists the mapped secrets that could not be fetched.
+func (p *SecretPuller) PullMappedSecrets(logger logr.Logger, bwSecret *operatorsv1.BitwardenSecret, authToken string, lastSync time.Time) (bool, []sdk.SecretResponse, []operatorsv1.MissingSecret, error) {
+	var secretIds []string
+	for _, mapping := range bwSecret.Spec.SecretMap {
+		if !slices.Contains(secretIds, mapping.BwSecretId) {
+			secretIds = append(secretIds, mapping.BwSecretId)
+		}
+	}
+
+	if len(secretIds) == 0 {
+		return lastSync.IsZero(), nil, nil, nil
+	}
+
+	var smSecretsResponse *sdk.SecretsResponse
+	err := p.WithBitwardenClient(logger, authToken, func(bitwardenClient sdk.BitwardenClientInterface) error {
+		var err error
+		smSecretsResponse, err = bitwardenClient.Secrets().GetByIDS(secretIds)
+		if err != nil {
+			logger.Error(err, "Failed to get mapped secrets.")
+		}
+		return err
+	})
+	if err != nil {
+		return false, nil, nil, err
+	}
+
+	var smSecrets []sdk.SecretResponse
+	if smSecretsResponse != nil {
+		smSecrets = smSecretsResponse.Data
+	}
+
+	fetched := map[string]bool{}
+	refresh := lastSync.IsZero()
+	for _, smSecret := range smSecrets {
+		fetched[smSecret.ID] = true
+		if smSecret.RevisionDate.After(lastSync) {
+			refresh = true
+		}
+	}
+
+	var missingSecrets []operatorsv1.MissingSecret
+	for _, secretId := range secretIds {
+		if !fetched[secretId] {
+			logger.Info("Mapped secret was not returned by Secrets Manager", "bwSecretId", p.redact(secretId))
+			missingSecrets = append(missingSecrets, operatorsv1.MissingSecret{
+				BwSecretId: secretId,
+				Reason:     "The secret does not exist or the machine account has no access to it",
+			})
+		}
+	}
+
+	// Secrets that went missing or came back do not change any revision date
+	if len(missingSecrets) > 0 || len(bwSecret.Status.MissingSecrets) > 0 {
+		refresh = true
+	}
+
+	return refresh, smSecrets, missingSecrets, nil
+}
+
+// SyncSecrets logs in with the auth token and syncs the secrets of the organization changed since lastSync.
+func (p *SecretPuller) SyncSecrets(logger logr.Logger, orgId string, authToken string, lastSync *time.Time) (*sdk.SecretsSyncResponse, error) {
+	var smSecretResponse *sdk.SecretsSyncResponse
+	err := p.WithBitwardenClient(logger, authToken, func(bitwardenClient sdk.BitwardenClientInterface) error {
+		var err error
+		smSecretResponse, err = bitwardenClient.Secrets().Sync(orgId, lastSync)
+		if err != nil {
+			logger.Error(err, "Failed to get secrets since last sync.")
+		}
+		return err
+	})
+
+	return smSecretResponse, err
+}
+
+// WithBitwardenClient runs call with a Bitwarden client logged in with the auth token.
+// When a call times out, WithBitwardenClient returns right away while the abandoned call may still be running;
+// its client is discarded and the state released once the call returns, so that the next session for the
+// token does not share the state with it.
+func (p *SecretPuller) WithBitwardenClient(logger logr.Logger, authToken string, call func(sdk.BitwardenClientInterface) error) error {
+	return withBitwardenClient(logger, p.BitwardenClientFactory, p.StateStore, authToken, call)
+}
+
+func withBitwardenClient(logger logr.Logger, factory BitwardenClientFactory, stateStore *StateStore, authToken string, call func(sdk.BitwardenClientInterface) error) error {
+	statePath, releaseState, err := stateStore.Acquire(authToken)
+	if err != nil {
+		logger.Error(err, "Failed to prepare state file")
+		return err
+	}
+	release := func() {
+		if err := releaseState(); err != nil {
+			logger.Error(err, "Failed to release state file")
+		}
+	}
+
+	bitwardenClient, err := factory.GetBitwardenClient()
+	if err != nil {
+		release()
+		logger.Error(err, "Failed to create client")
+		return err
+	}
+	// The state is only released after the client has been closed, and after an abandoned call returned
+	defer func() {
+		bitwardenClient.Close()
+		afterClose(bitwardenClient, release)
+	}()
+
+	err = bitwardenClient.AccessTokenLogin(authToken, &statePath)
+	if err != nil {
+		if IsCircuitOpenError(err) {
+			return err
+		}
+		logger.Error(err, "Failed to authenticate")
+		return err
+	}
+
+	return call(bitwardenClient)
+}
+
+// RenderSecretData maps the secrets of Secrets Manager to the keys of the data written for a BitwardenSecret,
+// following its map and its onlyMappedSecrets and useSecretNames options.
+func RenderSecretData(logger logr.Logger, bwSecret *operatorsv1.BitwardenSecret, smSecrets []sdk.SecretResponse) (map[string][]byte, error) {
+	secrets, err := BuildSecretsData(logger, smSecrets, bwSecret.Spec.UseSecretNames)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := &corev1.Secret{}
+	ApplySecretMap(secrets, bwSecret, rendered)
+	return rendered.Data, nil
+}
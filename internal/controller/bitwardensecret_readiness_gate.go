@@ -0,0 +1,194 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+const (
+	// Readiness gate added to pods that reference the secrets of BitwardenSecrets
+	PodConditionSecretsSynced corev1.PodConditionType = "k8s.bitwarden.com/secrets-synced"
+	ReasonSecretsSynced                               = "SecretsSynced"
+	ReasonSecretsPending                              = "SecretsPending"
+
+	// LabelReadinessGate opts a pod into the readiness gate. Only pods with the label set to "true" are sent
+	// to the webhook adding it.
+	LabelReadinessGate = "k8s.bitwarden.com/readiness-gate"
+)
+
+// BitwardenSecretSynced reports whether a BitwardenSecret has written its Kubernetes secret at least once.
+func BitwardenSecretSynced(bwSecret *operatorsv1.BitwardenSecret) bool {
+	return apimeta.IsStatusConditionTrue(bwSecret.Status.Conditions, "SuccessfulSync")
+}
+
+// ReferencedBitwardenSecrets returns the BitwardenSecrets whose Kubernetes secret a pod spec references.
+func ReferencedBitwardenSecrets(spec *corev1.PodSpec, bwSecrets []operatorsv1.BitwardenSecret) []*operatorsv1.BitwardenSecret {
+	refs := SecretReferences(spec)
+
+	var referenced []*operatorsv1.BitwardenSecret
+	for i := range bwSecrets {
+		_, specRef := refs[bwSecrets[i].Spec.SecretName]
+		_, currentRef := refs[bwSecrets[i].Status.CurrentSecretName]
+		if specRef || (currentRef && bwSecrets[i].Status.CurrentSecretName != "") {
+			referenced = append(referenced, &bwSecrets[i])
+		}
+	}
+	return referenced
+}
+
+// HasSecretsSyncedGate reports whether a pod carries the readiness gate set by the PodReadinessReconciler.
+func HasSecretsSyncedGate(pod *corev1.Pod) bool {
+	return slices.ContainsFunc(pod.Spec.ReadinessGates, func(gate corev1.PodReadinessGate) bool {
+		return gate.ConditionType == PodConditionSecretsSynced
+	})
+}
+
+func secretsSyncedConditionTrue(pod *corev1.Pod) bool {
+	return slices.ContainsFunc(pod.Status.Conditions, func(condition corev1.PodCondition) bool {
+		return condition.Type == PodConditionSecretsSynced && condition.Status == corev1.ConditionTrue
+	})
+}
+
+// PodReadinessReconciler sets the k8s.bitwarden.com/secrets-synced condition of the pods carrying that
+// readiness gate, so that they only become ready once every BitwardenSecret whose secret they reference has
+// been synced. Pods started before their secret exists would otherwise crash-loop until it is created.
+//
+// The condition only turns true once. Later failed syncs leave the secret, and the pods using it, as they are.
+type PodReadinessReconciler struct {
+	client.Client
+}
+
+//+kubebuilder:rbac:groups=core,resources=pods/status,verbs=patch
+
+// Reconcile sets the secrets-synced condition of a pod.
+func (r *PodReadinessReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !HasSecretsSyncedGate(pod) || secretsSyncedConditionTrue(pod) {
+		return ctrl.Result{}, nil
+	}
+
+	bwSecrets := &operatorsv1.BitwardenSecretList{}
+	if err := r.List(ctx, bwSecrets, client.InNamespace(pod.Namespace)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var pending []string
+	for _, bwSecret := range ReferencedBitwardenSecrets(&pod.Spec, bwSecrets.Items) {
+		if !BitwardenSecretSynced(bwSecret) {
+			pending = append(pending, bwSecret.Name)
+		}
+	}
+
+	condition := corev1.PodCondition{
+		Type:               PodConditionSecretsSynced,
+		Status:             corev1.ConditionTrue,
+		Reason:             ReasonSecretsSynced,
+		Message:            "All referenced BitwardenSecrets are synced",
+		LastTransitionTime: metav1.Now(),
+	}
+	if len(pending) > 0 {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = ReasonSecretsPending
+		condition.Message = fmt.Sprintf("Waiting for BitwardenSecrets %s to be synced", strings.Join(pending, ", "))
+	}
+
+	index := slices.IndexFunc(pod.Status.Conditions, func(c corev1.PodCondition) bool { return c.Type == PodConditionSecretsSynced })
+	if index >= 0 && pod.Status.Conditions[index].Status == condition.Status && pod.Status.Conditions[index].Message == condition.Message {
+		return ctrl.Result{}, nil
+	}
+
+	original := pod.DeepCopy()
+	if index >= 0 {
+		pod.Status.Conditions[index] = condition
+	} else {
+		pod.Status.Conditions = append(pod.Status.Conditions, condition)
+	}
+	// A strategic merge patch only replaces this condition, leaving those maintained by the kubelet alone
+	if err := r.Status().Patch(ctx, pod, client.StrategicMergeFrom(original)); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	logger.Info("Updated the secrets-synced condition of pod", "pod", req.NamespacedName, "status", condition.Status)
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PodReadinessReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	gated := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		pod, ok := obj.(*corev1.Pod)
+		return ok && HasSecretsSyncedGate(pod) && !secretsSyncedConditionTrue(pod)
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("pod-readiness-gate").
+		For(&corev1.Pod{}, builder.WithPredicates(gated)).
+		Watches(&operatorsv1.BitwardenSecret{}, handler.EnqueueRequestsFromMapFunc(r.mapBitwardenSecretToPods)).
+		Complete(r)
+}
+
+// mapBitwardenSecretToPods enqueues the gated pods waiting for a BitwardenSecret when it changes, including
+// when it is deleted so that they stop waiting for it.
+func (r *PodReadinessReconciler) mapBitwardenSecretToPods(ctx context.Context, obj client.Object) []reconcile.Request {
+	bwSecret, ok := obj.(*operatorsv1.BitwardenSecret)
+	if !ok {
+		return nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(bwSecret.Namespace)); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list the pods waiting for BitwardenSecret", "bitwardenSecret", bwSecret.Name)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !HasSecretsSyncedGate(pod) || secretsSyncedConditionTrue(pod) {
+			continue
+		}
+		if len(ReferencedBitwardenSecrets(&pod.Spec, []operatorsv1.BitwardenSecret{*bwSecret})) > 0 {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(pod)})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,243 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+const (
+	// AnnotationReload lists the secrets, comma separated, whose changes restart an annotated workload
+	AnnotationReload = "k8s.bitwarden.com/reload"
+	// Prefix of the pod template annotations holding the content hash of each secret a workload consumes
+	AnnotationSecretHashPrefix = "secret-hash.k8s.bitwarden.com/"
+
+	ReasonWorkloadRestarted  = "WorkloadRestarted"
+	ReasonWorkloadsRestarted = "WorkloadsRestarted"
+	ReasonReloadFailed       = "ReloadFailed"
+)
+
+// SecretContentHash returns a hash of the keys and values of a secret.
+func SecretContentHash(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	// Lengths are hashed as well, so that moving bytes between keys and values changes the hash
+	hash := sha256.New()
+	for _, key := range keys {
+		binary.Write(hash, binary.BigEndian, uint64(len(key)))
+		hash.Write([]byte(key))
+		binary.Write(hash, binary.BigEndian, uint64(len(data[key])))
+		hash.Write(data[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// SecretHashAnnotation returns the pod template annotation holding the content hash of a secret. Secret names
+// that are too long for the name part of an annotation are shortened and made unique with a hash.
+func SecretHashAnnotation(secretName string) string {
+	if len(secretName) > validation.LabelValueMaxLength {
+		sum := sha256.Sum256([]byte(secretName))
+		secretName = secretName[:validation.LabelValueMaxLength-9] + "-" + hex.EncodeToString(sum[:4])
+	}
+	return AnnotationSecretHashPrefix + secretName
+}
+
+// Reloader restarts the workloads consuming a secret when the operator changes its data, since pods only read
+// secrets exposed as environment variables when they start.
+//
+// A Deployment, StatefulSet or DaemonSet consumes a secret when it lists the secret in its AnnotationReload
+// annotation, or when its pod template references the secret in a volume or in the environment of a container.
+// Its pod template is annotated with the content hash of the secret, which rolls the workload out.
+type Reloader struct {
+	Client client.Client
+	// Reader lists the workloads, which are not kept in the cache
+	Reader   client.Reader
+	Recorder events.EventRecorder
+}
+
+// Reload restarts the workloads consuming the secret written for a BitwardenSecret, unless their pod template
+// already carries the current content hash of the secret. It returns the restarted workloads, as Kind/name.
+// A workload that fails to restart does not keep the others from being restarted.
+func (rl *Reloader) Reload(ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, secret *corev1.Secret) ([]string, error) {
+	logger := log.FromContext(ctx).WithName("reloader")
+
+	workloads, err := rl.workloads(ctx, secret.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	annotation := SecretHashAnnotation(secret.Name)
+	hash := SecretContentHash(secret.Data)
+
+	var restarted []string
+	var errs []error
+	for _, workload := range workloads {
+		template := podTemplate(workload)
+		if !ConsumesSecret(workload.GetAnnotations(), &template.Spec, secret.Name) || template.Annotations[annotation] == hash {
+			continue
+		}
+
+		name := workloadKind(workload) + "/" + workload.GetName()
+		original := workload.DeepCopyObject().(client.Object)
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[annotation] = hash
+
+		if err := rl.Client.Patch(ctx, workload, client.MergeFrom(original)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restart %s: %w", name, err))
+			continue
+		}
+
+		logger.Info("Restarted workload to pick up the changed secret", "workload", name, "namespace", secret.Namespace, "secret", secret.Name)
+		if rl.Recorder != nil {
+			rl.Recorder.Eventf(workload, bwSecret, corev1.EventTypeNormal, ReasonWorkloadRestarted, "Restart",
+				"Restarted to pick up the changed data of secret %s", secret.Name)
+		}
+		restarted = append(restarted, name)
+	}
+
+	if rl.Recorder != nil {
+		if len(restarted) > 0 {
+			rl.Recorder.Eventf(bwSecret, nil, corev1.EventTypeNormal, ReasonWorkloadsRestarted, "Restart",
+				"Restarted %s to pick up the changed data of secret %s", strings.Join(restarted, ", "), secret.Name)
+		}
+		if len(errs) > 0 {
+			rl.Recorder.Eventf(bwSecret, nil, corev1.EventTypeWarning, ReasonReloadFailed, "Restart", "%s", errors.Join(errs...).Error())
+		}
+	}
+
+	return restarted, errors.Join(errs...)
+}
+
+func (rl *Reloader) workloads(ctx context.Context, namespace string) ([]client.Object, error) {
+	var workloads []client.Object
+
+	deployments := &appsv1.DeploymentList{}
+	if err := rl.Reader.List(ctx, deployments, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		workloads = append(workloads, &deployments.Items[i])
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := rl.Reader.List(ctx, statefulSets, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range statefulSets.Items {
+		workloads = append(workloads, &statefulSets.Items[i])
+	}
+
+	daemonSets := &appsv1.DaemonSetList{}
+	if err := rl.Reader.List(ctx, daemonSets, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range daemonSets.Items {
+		workloads = append(workloads, &daemonSets.Items[i])
+	}
+
+	return workloads, nil
+}
+
+// ConsumesSecret reports whether a workload lists the secret in its AnnotationReload annotation or references
+// it in its pod spec.
+func ConsumesSecret(annotations map[string]string, spec *corev1.PodSpec, secretName string) bool {
+	for _, name := range strings.Split(annotations[AnnotationReload], ",") {
+		if strings.TrimSpace(name) == secretName {
+			return true
+		}
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil && volume.Secret.SecretName == secretName {
+			return true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil && source.Secret.Name == secretName {
+					return true
+				}
+			}
+		}
+	}
+
+	containers := slices.Concat(spec.InitContainers, spec.Containers)
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil && envFrom.SecretRef.Name == secretName {
+				return true
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && env.ValueFrom.SecretKeyRef.Name == secretName {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func podTemplate(workload client.Object) *corev1.PodTemplateSpec {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template
+	case *appsv1.StatefulSet:
+		return &w.Spec.Template
+	case *appsv1.DaemonSet:
+		return &w.Spec.Template
+	}
+	panic(fmt.Sprintf("unsupported workload %T", workload))
+}
+
+// workloadKind returns the kind of a workload, since typed objects read from the API server carry no TypeMeta.
+func workloadKind(workload client.Object) string {
+	switch workload.(type) {
+	case *appsv1.Deployment:
+		return "Deployment"
+	case *appsv1.StatefulSet:
+		return "StatefulSet"
+	case *appsv1.DaemonSet:
+		return "DaemonSet"
+	}
+	return fmt.Sprintf("%T", workload)
+}
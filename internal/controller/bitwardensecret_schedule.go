@@ -0,0 +1,75 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"hash/fnv"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// Delay before the first retry of a reconcile that returned an error. It doubles with every consecutive error.
+	minRateLimitDelay = time.Second
+	// Overall number of rate limited retries per second, and the burst allowed on top of it
+	rateLimitQPS   = 10
+	rateLimitBurst = 100
+)
+
+// NextSyncTime returns when a BitwardenSecret that last synced at lastSync is due to sync again.
+//
+// Every BitwardenSecret is assigned a fixed offset within the refresh interval, derived from its UID, and syncs
+// at that offset in every interval. Syncs are therefore spread evenly across the interval instead of all being
+// due at once after the operator restarts. Consecutive syncs are kept at least half an interval apart.
+func NextSyncTime(uid types.UID, interval time.Duration, lastSync time.Time) time.Time {
+	if interval <= 0 {
+		return lastSync
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(uid))
+	offset := int64(hash.Sum64() % uint64(interval))
+
+	phase := (lastSync.UnixNano() - offset) % int64(interval)
+	if phase < 0 {
+		phase += int64(interval)
+	}
+
+	next := lastSync.Add(interval - time.Duration(phase))
+	if next.Sub(lastSync) < interval/2 {
+		next = next.Add(interval)
+	}
+	return next
+}
+
+// NewReconcileRateLimiter returns the rate limiter for reconciles that return an error. Retries start after a
+// second and back off exponentially up to maxDelay, instead of the controller-runtime default of 5ms to
+// over 16 minutes, and the overall retry rate is bounded so that a wide outage does not flood the API.
+func NewReconcileRateLimiter(maxDelay time.Duration) workqueue.TypedRateLimiter[reconcile.Request] {
+	return workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](minRateLimitDelay, max(maxDelay, minRateLimitDelay)),
+		&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(rateLimitQPS), rateLimitBurst)},
+	)
+}
@@ -0,0 +1,385 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// LabelShardMember marks the leases announcing the replicas that take part in sharding
+const LabelShardMember = "k8s.bitwarden.com/shard-member"
+
+const (
+	DefaultShardLeaseDuration = 15 * time.Second
+	DefaultShardRenewInterval = 5 * time.Second
+)
+
+// ShardFor returns the shard a BitwardenSecret belongs to.
+func ShardFor(uid types.UID, shards int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(uid))
+	return int(hash.Sum32() % uint32(shards))
+}
+
+// ShardManager splits the BitwardenSecrets between the replicas of the operator.
+//
+// Every BitwardenSecret belongs to one of a fixed number of shards. Each replica announces itself with a
+// member lease and the shards are assigned to the live members by rendezvous hashing, so only the shards of
+// a replica that comes or goes move. A replica only syncs the BitwardenSecrets of the shards it holds the
+// lease of. It releases a shard as soon as the shard is assigned to another member, which takes the lease
+// over once it is released or has expired. A replica that cannot renew a lease stops syncing its shard
+// before the lease expires.
+type ShardManager struct {
+	Client client.Client
+	// APIReader reads the leases, which are not kept in the cache
+	APIReader client.Reader
+	Namespace string
+	// Name prefixes the names of the leases
+	Name     string
+	Identity string
+	Shards   int
+
+	LeaseDuration time.Duration
+	RenewInterval time.Duration
+
+	// OnAcquire is called with a shard once the replica holds its lease. It runs in its own goroutine.
+	OnAcquire func(ctx context.Context, shard int)
+
+	mu sync.RWMutex
+	// Time of the last renewal of each held shard lease
+	held map[int]time.Time
+}
+
+func NewShardManager(c client.Client, apiReader client.Reader, namespace string, name string, identity string, shards int) *ShardManager {
+	return &ShardManager{
+		Client:        c,
+		APIReader:     apiReader,
+		Namespace:     namespace,
+		Name:          name,
+		Identity:      identity,
+		Shards:        shards,
+		LeaseDuration: DefaultShardLeaseDuration,
+		RenewInterval: DefaultShardRenewInterval,
+		held:          map[int]time.Time{},
+	}
+}
+
+// Owns reports whether the BitwardenSecret with the UID belongs to a shard held by this replica.
+// Every BitwardenSecret is owned when sharding is disabled, i.e. on a nil ShardManager.
+func (m *ShardManager) Owns(uid types.UID) bool {
+	if m == nil {
+		return true
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	renewed, ok := m.held[ShardFor(uid, m.Shards)]
+	return ok && time.Since(renewed) < m.LeaseDuration
+}
+
+// HeldShards returns the shards held by this replica in ascending order.
+func (m *ShardManager) HeldShards() []int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var shards []int
+	for shard, renewed := range m.held {
+		if time.Since(renewed) < m.LeaseDuration {
+			shards = append(shards, shard)
+		}
+	}
+	slices.Sort(shards)
+	return shards
+}
+
+// Start implements manager.Runnable. The leases are released when the context is cancelled, so that the
+// other replicas take the shards over without waiting for the leases to expire.
+func (m *ShardManager) Start(ctx context.Context) error {
+	ticker := time.NewTicker(m.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		m.Sync(ctx)
+
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), m.RenewInterval)
+			defer cancel()
+			m.Release(releaseCtx)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Every replica takes part in sharding.
+func (m *ShardManager) NeedLeaderElection() bool {
+	return false
+}
+
+// Sync renews the membership of this replica, then acquires or renews the leases of the shards assigned to it
+// and releases the others.
+func (m *ShardManager) Sync(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("shard-manager")
+
+	members, err := m.renewMembership(ctx)
+	if err != nil {
+		// The held shards are dropped once their leases would have expired
+		logger.Error(err, "Failed to renew the shard membership")
+		return
+	}
+
+	for shard := range m.Shards {
+		if assignShard(shard, members) != m.Identity {
+			if m.holds(shard) {
+				m.releaseShard(ctx, shard)
+				logger.Info("Released shard to another replica", "shard", shard)
+			}
+			continue
+		}
+
+		acquired, err := m.acquireShard(ctx, shard)
+		if err != nil {
+			logger.Error(err, "Failed to acquire or renew shard lease", "shard", shard)
+			continue
+		}
+		if acquired {
+			logger.Info("Acquired shard", "shard", shard, "members", len(members))
+			if m.OnAcquire != nil {
+				// A slow callback must not hold up the renewal of the leases
+				go m.OnAcquire(ctx, shard)
+			}
+		}
+	}
+}
+
+// Release gives up the leases of all held shards and the membership of this replica.
+func (m *ShardManager) Release(ctx context.Context) {
+	for shard := range m.Shards {
+		if m.holds(shard) {
+			m.releaseShard(ctx, shard)
+		}
+	}
+
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Name: m.memberLeaseName(), Namespace: m.Namespace}}
+	if err := m.Client.Delete(ctx, lease); err != nil && !k8serrors.IsNotFound(err) {
+		log.FromContext(ctx).WithName("shard-manager").Error(err, "Failed to remove shard membership")
+	}
+}
+
+func (m *ShardManager) holds(shard int) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.held[shard]
+	return ok
+}
+
+// renewMembership renews the member lease of this replica and returns the identities of the live members.
+// Expired member leases of replicas that went away without releasing them are removed.
+func (m *ShardManager) renewMembership(ctx context.Context) ([]string, error) {
+	now := metav1.NowMicro()
+
+	lease := &coordinationv1.Lease{}
+	err := m.APIReader.Get(ctx, types.NamespacedName{Name: m.memberLeaseName(), Namespace: m.Namespace}, lease)
+	switch {
+	case k8serrors.IsNotFound(err):
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      m.memberLeaseName(),
+				Namespace: m.Namespace,
+				Labels:    map[string]string{LabelShardMember: m.Name},
+			},
+			Spec: m.leaseSpec(now),
+		}
+		err = m.Client.Create(ctx, lease)
+	case err == nil:
+		lease.Spec = m.leaseSpec(now)
+		err = m.Client.Update(ctx, lease)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	leases := &coordinationv1.LeaseList{}
+	if err := m.APIReader.List(ctx, leases, client.InNamespace(m.Namespace), client.MatchingLabels{LabelShardMember: m.Name}); err != nil {
+		return nil, err
+	}
+
+	members := []string{m.Identity}
+	for i := range leases.Items {
+		member := &leases.Items[i]
+		if member.Name == m.memberLeaseName() {
+			continue
+		}
+		if leaseExpired(member, now.Time) {
+			if err := m.Client.Delete(ctx, member, client.Preconditions{ResourceVersion: &member.ResourceVersion}); err != nil && !k8serrors.IsNotFound(err) && !k8serrors.IsConflict(err) {
+				return nil, err
+			}
+			continue
+		}
+		if member.Spec.HolderIdentity != nil && !slices.Contains(members, *member.Spec.HolderIdentity) {
+			members = append(members, *member.Spec.HolderIdentity)
+		}
+	}
+
+	return members, nil
+}
+
+// acquireShard acquires or renews the lease of a shard. It reports whether the lease was newly acquired.
+// A lease held by another replica is only taken over once it has been released or has expired.
+func (m *ShardManager) acquireShard(ctx context.Context, shard int) (bool, error) {
+	now := metav1.NowMicro()
+	name := m.shardLeaseName(shard)
+
+	lease := &coordinationv1.Lease{}
+	err := m.APIReader.Get(ctx, types.NamespacedName{Name: name, Namespace: m.Namespace}, lease)
+	if k8serrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: m.Namespace},
+			Spec:       m.leaseSpec(now),
+		}
+		lease.Spec.AcquireTime = &now
+		if err := m.Client.Create(ctx, lease); err != nil {
+			return false, err
+		}
+		return m.markHeld(shard, now.Time), nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	holder := ptr.Deref(lease.Spec.HolderIdentity, "")
+	if holder != m.Identity && holder != "" && !leaseExpired(lease, now.Time) {
+		// Wait for the previous owner to release the shard
+		m.dropHeld(shard)
+		return false, nil
+	}
+
+	transitions := ptr.Deref(lease.Spec.LeaseTransitions, 0)
+	acquireTime := lease.Spec.AcquireTime
+	if holder != m.Identity {
+		transitions++
+		acquireTime = &now
+	}
+	lease.Spec = m.leaseSpec(now)
+	lease.Spec.AcquireTime = acquireTime
+	lease.Spec.LeaseTransitions = &transitions
+
+	// The update fails on a conflict if another replica changed the lease since it was read
+	if err := m.Client.Update(ctx, lease); err != nil {
+		m.dropHeld(shard)
+		return false, err
+	}
+	return m.markHeld(shard, now.Time), nil
+}
+
+// releaseShard stops syncing the shard before clearing the holder of its lease.
+func (m *ShardManager) releaseShard(ctx context.Context, shard int) {
+	m.dropHeld(shard)
+
+	lease := &coordinationv1.Lease{}
+	if err := m.APIReader.Get(ctx, types.NamespacedName{Name: m.shardLeaseName(shard), Namespace: m.Namespace}, lease); err != nil {
+		return
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != m.Identity {
+		return
+	}
+
+	lease.Spec.HolderIdentity = nil
+	if err := m.Client.Update(ctx, lease); err != nil && !k8serrors.IsConflict(err) {
+		log.FromContext(ctx).WithName("shard-manager").Error(err, "Failed to release shard lease", "shard", shard)
+	}
+}
+
+// markHeld records the renewal of a shard lease and reports whether the shard was not held before.
+func (m *ShardManager) markHeld(shard int, renewed time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous, ok := m.held[shard]
+	m.held[shard] = renewed
+	return !ok || renewed.Sub(previous) >= m.LeaseDuration
+}
+
+func (m *ShardManager) dropHeld(shard int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.held, shard)
+}
+
+func (m *ShardManager) leaseSpec(now metav1.MicroTime) coordinationv1.LeaseSpec {
+	return coordinationv1.LeaseSpec{
+		HolderIdentity:       ptr.To(m.Identity),
+		LeaseDurationSeconds: ptr.To(int32(m.LeaseDuration / time.Second)),
+		RenewTime:            &now,
+	}
+}
+
+func (m *ShardManager) shardLeaseName(shard int) string {
+	return fmt.Sprintf("%s-shard-%d", m.Name, shard)
+}
+
+// memberLeaseName derives a valid object name from the identity, which may contain any characters.
+func (m *ShardManager) memberLeaseName() string {
+	hash := fnv.New32a()
+	hash.Write([]byte(m.Identity))
+	return fmt.Sprintf("%s-member-%08x", m.Name, hash.Sum32())
+}
+
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second).Before(now)
+}
+
+// assignShard picks the member with the highest hash of the member and shard, so that each member keeps
+// its shards when others come or go.
+func assignShard(shard int, members []string) string {
+	var owner string
+	var highest uint64
+	for _, member := range members {
+		// FNV hashes of identities that only differ in a few characters are too similar to spread the shards
+		sum := sha256.Sum256(fmt.Appendf(nil, "%s/%d", member, shard))
+		if score := binary.BigEndian.Uint64(sum[:8]); owner == "" || score > highest {
+			owner, highest = member, score
+		}
+	}
+	return owner
+}
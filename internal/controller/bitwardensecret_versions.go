@@ -0,0 +1,172 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+const (
+	// AnnotationCurrentSecret points from a BitwardenSecret to its current versioned secret
+	AnnotationCurrentSecret = "k8s.bitwarden.com/current-secret"
+	// LabelSecretVersion labels the versioned secrets with the hash of their data
+	LabelSecretVersion = "k8s.bitwarden.com/secret-version"
+)
+
+// Length of the data hash appended to the names of versioned secrets
+const secretVersionLength = 10
+
+// VersionedSecretName returns the name of the versioned secret holding the data. Long secret names are
+// truncated, so that the name with the hash appended is still a valid name of a secret.
+func VersionedSecretName(secretName string, data map[string][]byte) string {
+	base := secretName
+	if maxLength := validation.DNS1123SubdomainMaxLength - 1 - secretVersionLength; len(base) > maxLength {
+		// The part of a name before the hash has to end with an alphanumeric character
+		base = strings.TrimRight(base[:maxLength], ".-")
+	}
+	return base + "-" + SecretContentHash(data)[:secretVersionLength]
+}
+
+// CreateVersionedK8sSecret builds the immutable secret holding a version of the data of a BitwardenSecret.
+func CreateVersionedK8sSecret(bwSecret *operatorsv1.BitwardenSecret, data map[string][]byte) *corev1.Secret {
+	secret := CreateK8sSecret(bwSecret, data)
+	secret.Name = VersionedSecretName(bwSecret.Spec.SecretName, data)
+	secret.Labels[LabelBwSecret] = string(bwSecret.UID)
+	secret.Labels[LabelSecretVersion] = SecretContentHash(data)[:secretVersionLength]
+	secret.Immutable = ptr.To(true)
+	return secret
+}
+
+// syncVersionedSecret writes the data to its versioned secret and deletes the versions beyond the revision
+// history limit. It returns the name of the versioned secret, which is the current version from now on.
+//
+// When the data returns to that of a version that is still kept, the version is reused. Its data cannot change,
+// but its sync time is updated, since the versions that were synced last are the ones kept.
+func (r *BitwardenSecretReconciler) syncVersionedSecret(logger logr.Logger, ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, data map[string][]byte) (string, error) {
+	secret := CreateVersionedK8sSecret(bwSecret, data)
+	if err := r.SetK8sSecretAnnotations(bwSecret, secret); err != nil {
+		r.LogWarning(logger, ctx, bwSecret, err, fmt.Sprintf("Error setting annotations for  %s/%s", secret.Namespace, secret.Name)) //Annotation failure is not critical. Log, but don't fail the process
+	}
+
+	existing := &corev1.Secret{}
+	err := GetSecret(ctx, r.Client, r.APIReader, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, existing)
+	switch {
+	case k8serrors.IsNotFound(err):
+		if err := ctrl.SetControllerReference(bwSecret, secret, r.Scheme); err != nil {
+			return "", err
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			return "", err
+		}
+	case err != nil:
+		return "", err
+	case existing.Labels[LabelBwSecret] != string(bwSecret.UID):
+		return "", NewPermanentError(fmt.Errorf("secret %s/%s already exists and is not a version of this BitwardenSecret", secret.Namespace, secret.Name))
+	case bwSecret.Status.CurrentSecretName == secret.Name:
+		// The current version is up to date
+	default:
+		original := existing.DeepCopy()
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		existing.Annotations[AnnotationSyncTime] = secret.Annotations[AnnotationSyncTime]
+		if err := r.Patch(ctx, existing, client.MergeFrom(original)); err != nil {
+			return "", err
+		}
+	}
+
+	return secret.Name, r.pruneSecretVersions(ctx, bwSecret, secret.Name)
+}
+
+// pruneSecretVersions deletes the versioned secrets of a BitwardenSecret that were synced before the most recent
+// ones kept by its revision history limit. The current version is always kept.
+func (r *BitwardenSecretReconciler) pruneSecretVersions(ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, current string) error {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.InNamespace(bwSecret.Namespace), client.MatchingLabels{LabelBwSecret: string(bwSecret.UID)}); err != nil {
+		return err
+	}
+
+	var previous []corev1.Secret
+	for _, secret := range secrets.Items {
+		if _, ok := secret.Labels[LabelSecretVersion]; ok && secret.Name != current {
+			previous = append(previous, secret)
+		}
+	}
+
+	limit := int(bwSecret.Spec.Versioning.RevisionHistoryLimit)
+	if len(previous) <= limit {
+		return nil
+	}
+
+	slices.SortFunc(previous, func(a, b corev1.Secret) int {
+		return secretSyncTime(&b).Compare(secretSyncTime(&a))
+	})
+	for i := range previous[limit:] {
+		if err := r.Delete(ctx, &previous[limit+i]); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setCurrentSecretAnnotation points the BitwardenSecret at its current versioned secret, or removes the pointer
+// when versioning is disabled.
+func (r *BitwardenSecretReconciler) setCurrentSecretAnnotation(ctx context.Context, bwSecret *operatorsv1.BitwardenSecret, current string) error {
+	if bwSecret.Annotations[AnnotationCurrentSecret] == current {
+		return nil
+	}
+
+	original := bwSecret.DeepCopy()
+	if current == "" {
+		delete(bwSecret.Annotations, AnnotationCurrentSecret)
+	} else {
+		if bwSecret.Annotations == nil {
+			bwSecret.Annotations = map[string]string{}
+		}
+		bwSecret.Annotations[AnnotationCurrentSecret] = current
+	}
+
+	return r.Patch(ctx, bwSecret, client.MergeFrom(original))
+}
+
+// secretSyncTime returns when a versioned secret was last synced, falling back to its creation time.
+func secretSyncTime(secret *corev1.Secret) time.Time {
+	if syncTime, err := time.Parse(time.RFC3339Nano, secret.Annotations[AnnotationSyncTime]); err == nil {
+		return syncTime
+	}
+	return secret.CreationTimestamp.Time
+}
@@ -0,0 +1,227 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+const ConditionPolicyViolation = "PolicyViolation"
+
+// GetApplicablePolicies returns the BitwardenSecretPolicies whose namespace selector matches the given namespace.
+func GetApplicablePolicies(ctx context.Context, reader client.Reader, namespace string) ([]operatorsv1.BitwardenSecretPolicy, error) {
+	policies := &operatorsv1.BitwardenSecretPolicyList{}
+	if err := reader.List(ctx, policies); err != nil {
+		return nil, err
+	}
+
+	if len(policies.Items) == 0 {
+		return nil, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := reader.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return nil, err
+	}
+
+	var applicable []operatorsv1.BitwardenSecretPolicy
+	for _, policy := range policies.Items {
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector in BitwardenSecretPolicy %s: %w", policy.Name, err)
+		}
+
+		if selector.Matches(labels.Set(ns.Labels)) {
+			applicable = append(applicable, policy)
+		}
+	}
+
+	return applicable, nil
+}
+
+// CheckSpecPolicies returns the policy violations that can be determined from the BitwardenSecret spec alone.
+//
+// The names of versioned secrets depend on their data, so they are checked with the name of a version of
+// empty data here, and the name of each version is checked again before it is written.
+func CheckSpecPolicies(policies []operatorsv1.BitwardenSecretPolicy, bwSecret *operatorsv1.BitwardenSecret) []string {
+	secretName := bwSecret.Spec.SecretName
+	if bwSecret.Spec.Versioning != nil {
+		secretName = VersionedSecretName(secretName, nil)
+	}
+	violations := CheckSecretNamePolicies(policies, secretName)
+
+	secretType := bwSecret.Spec.SecretType
+	if secretType == "" {
+		secretType = corev1.SecretTypeOpaque
+	}
+
+	for _, policy := range policies {
+		spec := policy.Spec
+
+		violations = append(violations, checkOrganizationPolicy(policy, bwSecret.Spec.OrganizationId)...)
+		violations = append(violations, checkSecretTypePolicy(policy, secretType)...)
+
+		// The number of keys is only known up front when the output is restricted to the mapped secrets
+		if spec.MaxKeys != nil && bwSecret.Spec.OnlyMappedSecrets && !bwSecret.Spec.UseSecretNames && len(bwSecret.Spec.SecretMap) > int(*spec.MaxKeys) {
+			violations = append(violations,
+				fmt.Sprintf("policy %s allows at most %d keys, but %d secrets are mapped", policy.Name, *spec.MaxKeys, len(bwSecret.Spec.SecretMap)))
+		}
+	}
+
+	return violations
+}
+
+// CheckPushSecretPolicies returns the policy violations of a BitwardenPushSecret, which are those of the
+// organization and project its secrets are created in.
+func CheckPushSecretPolicies(policies []operatorsv1.BitwardenSecretPolicy, pushSecret *operatorsv1.BitwardenPushSecret) []string {
+	var violations []string
+
+	for _, policy := range policies {
+		violations = append(violations, checkOrganizationPolicy(policy, pushSecret.Spec.OrganizationId)...)
+		violations = append(violations, checkProjectPolicy(policy, pushSecret.Spec.ProjectId)...)
+	}
+
+	return violations
+}
+
+// CheckGeneratedSecretPolicies returns the policy violations of a BitwardenGeneratedSecret: those of the
+// organization and project its secret is created in, and of the name and type of the Kubernetes secret the
+// password is synced to.
+func CheckGeneratedSecretPolicies(policies []operatorsv1.BitwardenSecretPolicy, generated *operatorsv1.BitwardenGeneratedSecret) []string {
+	violations := CheckSecretNamePolicies(policies, generated.Spec.SecretName)
+
+	for _, policy := range policies {
+		violations = append(violations, checkOrganizationPolicy(policy, generated.Spec.OrganizationId)...)
+		violations = append(violations, checkProjectPolicy(policy, generated.Spec.ProjectId)...)
+		violations = append(violations, checkSecretTypePolicy(policy, corev1.SecretTypeOpaque)...)
+	}
+
+	return violations
+}
+
+func checkOrganizationPolicy(policy operatorsv1.BitwardenSecretPolicy, organizationId string) []string {
+	if len(policy.Spec.AllowedOrganizationIds) == 0 || slices.Contains(policy.Spec.AllowedOrganizationIds, organizationId) {
+		return nil
+	}
+	return []string{fmt.Sprintf("policy %s does not allow organization %s", policy.Name, organizationId)}
+}
+
+func checkProjectPolicy(policy operatorsv1.BitwardenSecretPolicy, projectId string) []string {
+	if len(policy.Spec.AllowedProjectIds) == 0 || slices.Contains(policy.Spec.AllowedProjectIds, projectId) {
+		return nil
+	}
+	return []string{fmt.Sprintf("policy %s does not allow project %s", policy.Name, projectId)}
+}
+
+func checkSecretTypePolicy(policy operatorsv1.BitwardenSecretPolicy, secretType corev1.SecretType) []string {
+	if len(policy.Spec.AllowedSecretTypes) == 0 || slices.Contains(policy.Spec.AllowedSecretTypes, secretType) {
+		return nil
+	}
+	return []string{fmt.Sprintf("policy %s does not allow secret type %s", policy.Name, secretType)}
+}
+
+// CheckSecretNamePolicies returns a violation for every policy whose secret name patterns do not match the name
+// of a written secret.
+func CheckSecretNamePolicies(policies []operatorsv1.BitwardenSecretPolicy, secretName string) []string {
+	var violations []string
+
+	for _, policy := range policies {
+		if len(policy.Spec.AllowedSecretNamePatterns) == 0 {
+			continue
+		}
+
+		matched, err := matchesAnyPattern(policy.Spec.AllowedSecretNamePatterns, secretName)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("policy %s has an invalid secret name pattern: %s", policy.Name, err.Error()))
+		} else if !matched {
+			violations = append(violations,
+				fmt.Sprintf("policy %s does not allow secret name %s (allowed patterns: %s)", policy.Name, secretName, strings.Join(policy.Spec.AllowedSecretNamePatterns, ", ")))
+		}
+	}
+
+	return violations
+}
+
+// CheckProjectPolicies returns a violation for every secret that belongs to a project not allowed by the policies.
+func CheckProjectPolicies(policies []operatorsv1.BitwardenSecretPolicy, smSecrets []sdk.SecretResponse) []string {
+	var violations []string
+
+	for _, policy := range policies {
+		if len(policy.Spec.AllowedProjectIds) == 0 {
+			continue
+		}
+
+		for _, smSecret := range smSecrets {
+			projectId := ""
+			if smSecret.ProjectID != nil {
+				projectId = *smSecret.ProjectID
+			}
+
+			if !slices.Contains(policy.Spec.AllowedProjectIds, projectId) {
+				violations = append(violations,
+					fmt.Sprintf("policy %s does not allow secret %s from project '%s'", policy.Name, smSecret.ID, projectId))
+			}
+		}
+	}
+
+	return violations
+}
+
+// CheckKeyCountPolicies returns a violation for every policy whose key limit is exceeded by the rendered secret.
+func CheckKeyCountPolicies(policies []operatorsv1.BitwardenSecretPolicy, keyCount int) []string {
+	var violations []string
+
+	for _, policy := range policies {
+		if policy.Spec.MaxKeys != nil && keyCount > int(*policy.Spec.MaxKeys) {
+			violations = append(violations,
+				fmt.Sprintf("policy %s allows at most %d keys, but the secret would contain %d", policy.Name, *policy.Spec.MaxKeys, keyCount))
+		}
+	}
+
+	return violations
+}
+
+func matchesAnyPattern(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return false, fmt.Errorf("'%s': %w", pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
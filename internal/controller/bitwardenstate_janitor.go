@@ -0,0 +1,152 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+)
+
+// StateJanitor periodically deletes the SDK state of machine account tokens that are no longer referenced
+// by any BitwardenSecret, BitwardenPushSecret or BitwardenGeneratedSecret.
+//
+// Without a Client, as in the CSI provider, which does not watch the cluster, the janitor deletes the state
+// of the tokens that no session used for UnusedTTL instead.
+type StateJanitor struct {
+	Client client.Reader
+	// APIReader reads the auth token secrets that are not kept in the cache, if set
+	APIReader  client.Reader
+	StateStore *StateStore
+	// Interval between cleanups. State files are also kept for at least this long after their last write,
+	// so that the state of a token that was just added is not removed before the resource using it is listed.
+	Interval time.Duration
+	// UnusedTTL is how long the state of a token is kept after its last use when there is no Client
+	UnusedTTL time.Duration
+}
+
+// Start runs the janitor until the context is cancelled.
+func (j *StateJanitor) Start(ctx context.Context) error {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			j.Cleanup(ctx)
+		}
+	}
+}
+
+// NeedLeaderElection returns false because every replica keeps its own state files.
+func (j *StateJanitor) NeedLeaderElection() bool {
+	return false
+}
+
+// Cleanup deletes the state files of unreferenced tokens once.
+func (j *StateJanitor) Cleanup(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("state-janitor")
+
+	if j.Client == nil {
+		removed, err := j.StateStore.Remove(j.StateStore.UsedWithin(j.UnusedTTL), j.UnusedTTL)
+		if err != nil {
+			logger.Error(err, "Failed to remove some unused state files")
+		}
+		if len(removed) > 0 {
+			logger.Info("Removed state of unused auth tokens", "count", len(removed))
+		}
+		return
+	}
+
+	referenced, err := j.referencedTokenHashes(ctx)
+	if err != nil {
+		// Without a complete picture of the referenced tokens nothing can be safely removed
+		logger.Error(err, "Failed to determine the referenced auth tokens. Skipping state cleanup.")
+		return
+	}
+
+	removed, err := j.StateStore.Remove(referenced, j.Interval)
+	if err != nil {
+		logger.Error(err, "Failed to remove some unreferenced state files")
+	}
+	if len(removed) > 0 {
+		logger.Info("Removed state of unreferenced auth tokens", "count", len(removed))
+	}
+}
+
+func (j *StateJanitor) referencedTokenHashes(ctx context.Context) (map[string]bool, error) {
+	type authTokenRef struct {
+		namespace string
+		authToken operatorsv1.AuthToken
+	}
+	var refs []authTokenRef
+
+	bwSecrets := &operatorsv1.BitwardenSecretList{}
+	if err := j.Client.List(ctx, bwSecrets); err != nil {
+		return nil, err
+	}
+	for _, bwSecret := range bwSecrets.Items {
+		refs = append(refs, authTokenRef{bwSecret.Namespace, bwSecret.Spec.AuthToken})
+	}
+
+	pushSecrets := &operatorsv1.BitwardenPushSecretList{}
+	if err := j.Client.List(ctx, pushSecrets); err != nil {
+		return nil, err
+	}
+	for _, pushSecret := range pushSecrets.Items {
+		refs = append(refs, authTokenRef{pushSecret.Namespace, pushSecret.Spec.AuthToken})
+	}
+
+	generatedSecrets := &operatorsv1.BitwardenGeneratedSecretList{}
+	if err := j.Client.List(ctx, generatedSecrets); err != nil {
+		return nil, err
+	}
+	for _, generated := range generatedSecrets.Items {
+		refs = append(refs, authTokenRef{generated.Namespace, generated.Spec.AuthToken})
+	}
+
+	referenced := map[string]bool{}
+	for _, ref := range refs {
+		authK8sSecret := &corev1.Secret{}
+		err := GetSecret(ctx, j.Client, j.APIReader, types.NamespacedName{Name: ref.authToken.SecretName, Namespace: ref.namespace}, authK8sSecret)
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if data, ok := authK8sSecret.Data[ref.authToken.SecretKey]; ok {
+			referenced[HashAuthToken(string(data))] = true
+		}
+	}
+
+	return referenced, nil
+}
@@ -0,0 +1,292 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimum length of the key material used to encrypt state files
+const MinStateEncryptionKeyLength = 32
+
+const encryptedStateSuffix = ".enc"
+
+// StateStore manages the Secrets Manager SDK state files. Every machine account token gets its own state file,
+// named after a hash of the token, so sessions of different tokens cannot overwrite each other's state.
+//
+// When an encryption key is configured, state files are kept encrypted in the state directory. The SDK needs a
+// plain file while a session is open, so the state is decrypted into a scratch directory for the duration of the
+// session and encrypted back when the session is released.
+type StateStore struct {
+	Dir string
+
+	gcm        cipher.AEAD
+	scratchDir string
+
+	mu       sync.Mutex
+	locks    map[string]*sync.Mutex
+	lastUsed map[string]time.Time
+}
+
+// NewStateStore creates a StateStore keeping its files in dir. A nil key stores the state unencrypted.
+func NewStateStore(dir string, key []byte) (*StateStore, error) {
+	store := &StateStore{
+		Dir:      dir,
+		locks:    map[string]*sync.Mutex{},
+		lastUsed: map[string]time.Time{},
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create state directory %s: %w", dir, err)
+	}
+
+	if key == nil {
+		return store, nil
+	}
+
+	if len(key) < MinStateEncryptionKeyLength {
+		return nil, fmt.Errorf("state encryption key must be at least %d bytes long", MinStateEncryptionKeyLength)
+	}
+
+	// Derive a fixed size AES-256 key so that any sufficiently long random key material can be used
+	derivedKey := sha256.Sum256(key)
+	block, err := aes.NewCipher(derivedKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	store.gcm, err = cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	store.scratchDir, err = os.MkdirTemp("", "bw-sm-state-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create scratch directory for decrypted state: %w", err)
+	}
+
+	return store, nil
+}
+
+// HashAuthToken returns the identifier used to name the state of a machine account token.
+func HashAuthToken(authToken string) string {
+	hash := sha256.Sum256([]byte(authToken))
+	return hex.EncodeToString(hash[:])
+}
+
+// Encrypted reports whether state files are encrypted at rest.
+func (s *StateStore) Encrypted() bool {
+	return s.gcm != nil
+}
+
+// Acquire returns the state file path to hand to the SDK for the given token. Sessions for the same token are
+// serialized; release must be called once the SDK client has been closed.
+func (s *StateStore) Acquire(authToken string) (string, func() error, error) {
+	tokenHash := HashAuthToken(authToken)
+	lock := s.lockFor(tokenHash)
+	lock.Lock()
+	s.markUsed(tokenHash)
+
+	if !s.Encrypted() {
+		return filepath.Join(s.Dir, tokenHash), func() error {
+			lock.Unlock()
+			return nil
+		}, nil
+	}
+
+	plainPath := filepath.Join(s.scratchDir, tokenHash)
+	encryptedPath := filepath.Join(s.Dir, tokenHash+encryptedStateSuffix)
+
+	if err := s.decryptFile(encryptedPath, plainPath); err != nil {
+		lock.Unlock()
+		return "", nil, fmt.Errorf("unable to decrypt state file %s: %w", encryptedPath, err)
+	}
+
+	release := func() error {
+		defer lock.Unlock()
+		defer os.Remove(plainPath)
+
+		if err := s.encryptFile(plainPath, encryptedPath); err != nil {
+			return fmt.Errorf("unable to encrypt state file %s: %w", encryptedPath, err)
+		}
+		return nil
+	}
+
+	return plainPath, release, nil
+}
+
+// Remove deletes every state file whose token hash is not in referenced and that has not been written for
+// at least minAge. It returns the hashes whose state was deleted.
+func (s *StateStore) Remove(referenced map[string]bool, minAge time.Duration) ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		tokenHash, ok := stateFileHash(entry.Name())
+		if !ok || referenced[tokenHash] {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if time.Since(info.ModTime()) < minAge {
+			continue
+		}
+
+		lock := s.lockFor(tokenHash)
+		if !lock.TryLock() {
+			// A session is using the state right now
+			continue
+		}
+		err = os.Remove(filepath.Join(s.Dir, entry.Name()))
+		lock.Unlock()
+
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, tokenHash)
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// UsedWithin returns the hashes of the tokens whose state was acquired by this store within d.
+func (s *StateStore) UsedWithin(d time.Duration) map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used := map[string]bool{}
+	for tokenHash, lastUsed := range s.lastUsed {
+		if time.Since(lastUsed) < d {
+			used[tokenHash] = true
+		} else {
+			delete(s.lastUsed, tokenHash)
+		}
+	}
+	return used
+}
+
+func (s *StateStore) markUsed(tokenHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastUsed[tokenHash] = time.Now()
+}
+
+func (s *StateStore) lockFor(tokenHash string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.locks[tokenHash]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[tokenHash] = lock
+	}
+	return lock
+}
+
+func (s *StateStore) decryptFile(encryptedPath, plainPath string) error {
+	ciphertext, err := os.ReadFile(encryptedPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// No session has been stored for this token yet; make sure no stale plain state is picked up
+		if err := os.Remove(plainPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	nonceSize := s.gcm.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return fmt.Errorf("state file is truncated")
+	}
+
+	plaintext, err := s.gcm.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], nil)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(plainPath, plaintext, 0o600)
+}
+
+func (s *StateStore) encryptFile(plainPath, encryptedPath string) error {
+	plaintext, err := os.ReadFile(plainPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// The SDK did not write any state during the session
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, s.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	ciphertext := s.gcm.Seal(nonce, nonce, plaintext, nil)
+
+	// Write to a temporary file first so that a crash never leaves a partially written state file behind
+	tmpPath := encryptedPath + ".tmp"
+	if err := os.WriteFile(tmpPath, ciphertext, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, encryptedPath)
+}
+
+// stateFileHash returns the token hash a state file belongs to.
+func stateFileHash(fileName string) (string, bool) {
+	tokenHash := strings.TrimSuffix(fileName, encryptedStateSuffix)
+	if len(tokenHash) != sha256.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(tokenHash); err != nil {
+		return "", false
+	}
+	return tokenHash, true
+}
@@ -0,0 +1,53 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	syncCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "bitwarden_sync_cache_hits_total",
+		Help: "Number of Secrets Manager syncs served from the sync cache or from a sync already in flight",
+	})
+	syncCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "bitwarden_sync_cache_misses_total",
+		Help: "Number of Secrets Manager syncs that had to call the Bitwarden API",
+	})
+	sdkCallTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bitwarden_sdk_call_timeouts_total",
+		Help: "Number of Bitwarden SDK calls abandoned because they did not complete within their deadline",
+	}, []string{"call"})
+	circuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bitwarden_circuit_breaker_state",
+		Help: "State of the circuit breaker of a Bitwarden API URL and machine account token hash: 0 closed, 1 open, 2 half-open",
+	}, []string{"api_url", "token_hash"})
+	endpointReachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bitwarden_endpoint_reachable",
+		Help: "Outcome of the last reachability check of a Bitwarden endpoint: 1 reachable, 0 unreachable",
+	}, []string{"url"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(syncCacheHits, syncCacheMisses, sdkCallTimeouts, circuitBreakerState, endpointReachable)
+}
@@ -0,0 +1,262 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	"github.com/bitwarden/sm-kubernetes/internal/controller/test/testutils"
+)
+
+var _ = Describe("Sync Backoff Tests", func() {
+	It("should classify errors", func() {
+		Expect(controller.ClassifyError(fmt.Errorf("connection reset by peer"))).To(Equal(controller.ErrorClassTransient))
+		Expect(controller.ClassifyError(fmt.Errorf("API error: 401 Unauthorized"))).To(Equal(controller.ErrorClassAuth))
+		Expect(controller.ClassifyError(fmt.Errorf("request failed with status code 401"))).To(Equal(controller.ErrorClassAuth))
+		Expect(controller.ClassifyError(fmt.Errorf("HTTP/1.1 401"))).To(Equal(controller.ErrorClassAuth))
+		Expect(controller.ClassifyError(fmt.Errorf("secret 4f01e401-3c2b-4a01-b401-a40112ab4010 not found"))).To(Equal(controller.ErrorClassTransient))
+		Expect(controller.ClassifyError(fmt.Errorf("GET https://vault.example.com/api/secrets/401: connection reset, read 401 bytes"))).To(Equal(controller.ErrorClassTransient))
+		Expect(controller.ClassifyError(controller.NewAuthError(fmt.Errorf("auth token secret not found")))).To(Equal(controller.ErrorClassAuth))
+		Expect(controller.ClassifyError(controller.NewPermanentError(fmt.Errorf("invalid spec")))).To(Equal(controller.ErrorClassPermanent))
+		Expect(controller.ClassifyError(fmt.Errorf("wrapped: %w", controller.NewPermanentError(fmt.Errorf("invalid spec"))))).To(Equal(controller.ErrorClassPermanent))
+	})
+
+	It("should double the transient retry delay up to the maximum", func() {
+		maxDelay := 5 * time.Minute
+
+		for i := 0; i < 20; i++ {
+			Expect(controller.TransientRetryDelay(1, maxDelay)).To(BeNumerically("~", controller.MinRetryDelay*3/4, controller.MinRetryDelay/4))
+			Expect(controller.TransientRetryDelay(3, maxDelay)).To(BeNumerically("~", controller.MinRetryDelay*3, controller.MinRetryDelay))
+			Expect(controller.TransientRetryDelay(10, maxDelay)).To(BeNumerically("~", maxDelay*3/4, maxDelay/4))
+			Expect(controller.TransientRetryDelay(1000, maxDelay)).To(BeNumerically("~", maxDelay*3/4, maxDelay/4))
+		}
+	})
+
+	It("should count consecutive failures", func() {
+		now := time.Now()
+		bwSecret := &operatorsv1.BitwardenSecret{ObjectMeta: metav1.ObjectMeta{Generation: 3}}
+
+		backoff, delay := controller.NextSyncBackoff(bwSecret, controller.ErrorClassTransient, "1", time.Minute, now)
+		Expect(backoff.ErrorClass).To(Equal(string(controller.ErrorClassTransient)))
+		Expect(backoff.ConsecutiveFailures).To(Equal(int32(1)))
+		Expect(backoff.ObservedGeneration).To(Equal(int64(3)))
+		Expect(backoff.NextRetryTime.Time).To(Equal(now.Add(delay)))
+		Expect(backoff.AuthTokenResourceVersion).To(BeEmpty())
+
+		bwSecret.Status.Backoff = backoff
+		backoff, delay = controller.NextSyncBackoff(bwSecret, controller.ErrorClassAuth, "1", time.Minute, now)
+		Expect(delay).To(BeZero())
+		Expect(backoff.ConsecutiveFailures).To(Equal(int32(2)))
+		Expect(backoff.NextRetryTime).To(BeNil())
+		Expect(backoff.AuthTokenResourceVersion).To(Equal("1"))
+	})
+
+	It("should wait only for the auth token version that failed", func() {
+		bwSecret := &operatorsv1.BitwardenSecret{ObjectMeta: metav1.ObjectMeta{Generation: 1}}
+		Expect(controller.WaitingForAuthTokenRotation(bwSecret, "1")).To(BeFalse())
+
+		bwSecret.Status.Backoff, _ = controller.NextSyncBackoff(bwSecret, controller.ErrorClassAuth, "1", time.Minute, time.Now())
+		Expect(controller.WaitingForAuthTokenRotation(bwSecret, "1")).To(BeTrue())
+		Expect(controller.WaitingForAuthTokenRotation(bwSecret, "2")).To(BeFalse())
+
+		bwSecret.Generation = 2
+		Expect(controller.WaitingForAuthTokenRotation(bwSecret, "1")).To(BeFalse())
+	})
+
+	It("should check an auth token secret outside of the cache again at the next refresh", func() {
+		ctx := context.Background()
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(operatorsv1.AddToScheme(scheme)).To(Succeed())
+
+		bwSecret := &operatorsv1.BitwardenSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bw-secret", Namespace: "default"},
+			Spec: operatorsv1.BitwardenSecretSpec{
+				SecretName: "synced",
+				AuthToken:  operatorsv1.AuthToken{SecretName: "bw-auth-token", SecretKey: "token"},
+			},
+		}
+		cached := fake.NewClientBuilder().WithScheme(scheme).WithObjects(bwSecret).WithStatusSubresource(bwSecret).Build()
+		unlabelled := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bw-auth-token", Namespace: "default"},
+			Data:       map[string][]byte{"other": []byte("abc-123")},
+		}
+		reconciler := &controller.BitwardenSecretReconciler{
+			Client:                 cached,
+			APIReader:              fake.NewClientBuilder().WithScheme(scheme).Build(),
+			Scheme:                 scheme,
+			RefreshIntervalSeconds: 300,
+		}
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "bw-secret", Namespace: "default"}}
+
+		// Neither the creation of the missing secret nor a fix of its key would be watched
+		result, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(300 * time.Second))
+
+		reconciler.APIReader = fake.NewClientBuilder().WithScheme(scheme).WithObjects(unlabelled).Build()
+		result, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(300 * time.Second))
+
+		// Auth token secrets in the cache are watched instead
+		labelled := unlabelled.DeepCopy()
+		labelled.Labels = map[string]string{controller.LabelSecretRole: controller.SecretRoleAuthToken}
+		labelled.ResourceVersion = ""
+		Expect(cached.Create(ctx, labelled)).To(Succeed())
+		result, err = reconciler.Reconcile(ctx, req)
+		Expect(errors.Is(err, reconcile.TerminalError(nil))).To(BeTrue())
+		Expect(result.RequeueAfter).To(BeZero())
+	})
+})
+
+var _ = Describe("BitwardenSecret Reconciler - Backoff Tests", Ordered, func() {
+	var (
+		namespace string
+		fixture   testutils.TestFixture
+	)
+
+	BeforeEach(func() {
+		fixture = *testutils.NewTestFixture(testContext, envTestRunner)
+		namespace = fixture.CreateNamespace()
+	})
+
+	AfterAll(func() {
+		fixture.Cancel()
+	})
+
+	AfterEach(func() {
+		fixture.Teardown()
+	})
+
+	getBitwardenSecret := func() *operatorsv1.BitwardenSecret {
+		bwSecret := &operatorsv1.BitwardenSecret{}
+		Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}, bwSecret)).To(Succeed())
+		return bwSecret
+	}
+
+	It("should back off after transient failures and clear the backoff after a successful sync", func() {
+		// Expectations are matched in order, so the first two syncs fail before the default mocks succeed
+		fixture.MockSecrets.EXPECT().Sync(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("connection reset by peer")).Times(2)
+		fixture.SetupDefaultCtrlMocks(false, nil)
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fixture.CreateBitwardenSecret(testutils.BitwardenSecretName, namespace, fixture.OrgId, testutils.SynchronizedSecretName, testutils.AuthSecretName, testutils.AuthSecretKey, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+
+		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("<=", controller.MinRetryDelay))
+
+		Eventually(func(g Gomega) {
+			backoff := getBitwardenSecret().Status.Backoff
+			g.Expect(backoff).NotTo(BeNil())
+			g.Expect(backoff.ErrorClass).To(Equal(string(controller.ErrorClassTransient)))
+			g.Expect(backoff.ConsecutiveFailures).To(Equal(int32(1)))
+			g.Expect(backoff.NextRetryTime).NotTo(BeNil())
+		}).Should(Succeed())
+
+		result, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("<=", 2*controller.MinRetryDelay))
+
+		Eventually(func(g Gomega) {
+			backoff := getBitwardenSecret().Status.Backoff
+			g.Expect(backoff).NotTo(BeNil())
+			g.Expect(backoff.ConsecutiveFailures).To(Equal(int32(2)))
+		}).Should(Succeed())
+
+		result, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
+
+		Eventually(func(g Gomega) {
+			g.Expect(getBitwardenSecret().Status.Backoff).To(BeNil())
+		}).Should(Succeed())
+		Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.SynchronizedSecretName, Namespace: namespace}, &corev1.Secret{})).To(Succeed())
+	})
+
+	It("should wait for the auth token to change after an auth failure", func() {
+		fixture.MockSecrets.EXPECT().Sync(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("API error: 401 Unauthorized")).Times(1)
+		fixture.SetupDefaultCtrlMocks(false, nil)
+
+		authSecret, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fixture.CreateBitwardenSecret(testutils.BitwardenSecretName, namespace, fixture.OrgId, testutils.SynchronizedSecretName, testutils.AuthSecretName, testutils.AuthSecretKey, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+
+		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, reconcile.TerminalError(nil))).To(BeTrue())
+		Expect(result.RequeueAfter).To(BeZero())
+
+		Eventually(func(g Gomega) {
+			backoff := getBitwardenSecret().Status.Backoff
+			g.Expect(backoff).NotTo(BeNil())
+			g.Expect(backoff.ErrorClass).To(Equal(string(controller.ErrorClassAuth)))
+			g.Expect(backoff.AuthTokenResourceVersion).To(Equal(authSecret.ResourceVersion))
+		}).Should(Succeed())
+
+		// The API is not called again while the auth token is unchanged
+		result, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(getBitwardenSecret().Status.Backoff).NotTo(BeNil())
+
+		authSecret.Data[testutils.AuthSecretKey] = []byte("rotated-token")
+		Expect(fixture.K8sClient.Update(fixture.Ctx, authSecret)).To(Succeed())
+
+		Eventually(func(g Gomega) {
+			_, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(getBitwardenSecret().Status.Backoff).To(BeNil())
+		}).Should(Succeed())
+	})
+
+	It("should not retry a permanent failure", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		bwSecret, err := fixture.CreateDefaultBitwardenSecret(namespace, fixture.SecretMap)
+		Expect(err).NotTo(HaveOccurred())
+
+		bwSecret.Spec.UseSecretNames = true
+		Expect(fixture.K8sClient.Update(fixture.Ctx, bwSecret)).To(Succeed())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+
+		Eventually(func(g Gomega) {
+			result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
+			g.Expect(errors.Is(err, reconcile.TerminalError(nil))).To(BeTrue())
+			g.Expect(result.RequeueAfter).To(BeZero())
+		}).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			backoff := getBitwardenSecret().Status.Backoff
+			g.Expect(backoff).NotTo(BeNil())
+			g.Expect(backoff.ErrorClass).To(Equal(string(controller.ErrorClassPermanent)))
+			g.Expect(backoff.NextRetryTime).To(BeNil())
+		}).Should(Succeed())
+	})
+})
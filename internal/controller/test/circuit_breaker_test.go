@@ -0,0 +1,200 @@
+package controller_test
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	mocks "github.com/bitwarden/sm-kubernetes/internal/controller/test/mocks"
+)
+
+var _ = Describe("Circuit Breaker Tests", func() {
+	const (
+		token         = "0.machine-account-token"
+		otherToken    = "0.other-machine-account-token"
+		threshold     = 3
+		probeInterval = 100 * time.Millisecond
+	)
+
+	var (
+		mockCtrl    *gomock.Controller
+		mockFactory *mocks.MockBitwardenClientFactory
+		mockClient  *mocks.MockBitwardenClientInterface
+		factory     *controller.CircuitBreakerClientFactory
+		statePath   string
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockFactory = mocks.NewMockBitwardenClientFactory(mockCtrl)
+		mockClient = mocks.NewMockBitwardenClientInterface(mockCtrl)
+
+		mockFactory.EXPECT().GetApiUrl().Return("https://api.bitwarden.com").AnyTimes()
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil).AnyTimes()
+		mockClient.EXPECT().Close().AnyTimes()
+
+		factory = controller.NewCircuitBreakerClientFactory(mockFactory, threshold, probeInterval)
+		statePath = "bin"
+	})
+
+	login := func(accessToken string) error {
+		client, err := factory.GetBitwardenClient()
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		return client.AccessTokenLogin(accessToken, &statePath)
+	}
+
+	sync := func(accessToken string) error {
+		client, err := factory.GetBitwardenClient()
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		if err := client.AccessTokenLogin(accessToken, &statePath); err != nil {
+			return err
+		}
+		_, err = client.Secrets().Sync("org", nil)
+		return err
+	}
+
+	It("should open after consecutive transient failures and close after a successful probe", func() {
+		mockSecrets := mocks.NewMockSecretsInterface(mockCtrl)
+		mockClient.EXPECT().Secrets().Return(mockSecrets).AnyTimes()
+		gomock.InOrder(
+			mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(fmt.Errorf("connection refused")).Times(threshold),
+			mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(nil),
+		)
+		mockSecrets.EXPECT().Sync("org", gomock.Any()).Return(&sdk.SecretsSyncResponse{}, nil)
+
+		for i := 0; i < threshold; i++ {
+			Expect(controller.IsCircuitOpenError(login(token))).To(BeFalse())
+		}
+		Expect(factory.State(token)).To(Equal(controller.CircuitOpen))
+
+		// The API is not called while the circuit is open
+		Expect(controller.IsCircuitOpenError(login(token))).To(BeTrue())
+
+		// The login may reuse a pooled session, so only the call after it closes the circuit
+		time.Sleep(probeInterval)
+		Expect(sync(token)).To(Succeed())
+		Expect(factory.State(token)).To(Equal(controller.CircuitClosed))
+	})
+
+	It("should open after failed syncs interleaved with logins that reuse pooled sessions", func() {
+		const poolThreshold = 5
+		mockSecrets := mocks.NewMockSecretsInterface(mockCtrl)
+		mockClient.EXPECT().Secrets().Return(mockSecrets).AnyTimes()
+		mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(nil).Times(1)
+		mockSecrets.EXPECT().Sync("org", gomock.Any()).Return(nil, fmt.Errorf("error sending request: connection refused")).Times(poolThreshold)
+
+		pool := controller.NewBitwardenClientPool(mockFactory, 10, time.Hour)
+		factory = controller.NewCircuitBreakerClientFactory(pool, poolThreshold, time.Hour)
+
+		for i := 0; i < poolThreshold; i++ {
+			err := sync(token)
+			Expect(err).To(HaveOccurred())
+			Expect(controller.IsCircuitOpenError(err)).To(BeFalse())
+		}
+		Expect(factory.State(token)).To(Equal(controller.CircuitOpen))
+		Expect(controller.IsCircuitOpenError(sync(token))).To(BeTrue())
+	})
+
+	It("should reopen when the probe fails", func() {
+		mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(fmt.Errorf("connection refused")).Times(threshold + 1)
+
+		for i := 0; i < threshold; i++ {
+			Expect(login(token)).NotTo(Succeed())
+		}
+
+		time.Sleep(probeInterval)
+		err := login(token)
+		Expect(err).To(HaveOccurred())
+		Expect(controller.IsCircuitOpenError(err)).To(BeFalse())
+		Expect(factory.State(token)).To(Equal(controller.CircuitOpen))
+		Expect(controller.IsCircuitOpenError(login(token))).To(BeTrue())
+	})
+
+	It("should let a single probe through at a time", func() {
+		unblock := make(chan struct{})
+		mockSecrets := mocks.NewMockSecretsInterface(mockCtrl)
+		mockClient.EXPECT().Secrets().Return(mockSecrets).AnyTimes()
+		mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(fmt.Errorf("connection refused")).Times(threshold)
+		mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(nil)
+		mockSecrets.EXPECT().Sync("org", gomock.Any()).DoAndReturn(func(string, *time.Time) (*sdk.SecretsSyncResponse, error) {
+			<-unblock
+			return &sdk.SecretsSyncResponse{}, nil
+		})
+
+		for i := 0; i < threshold; i++ {
+			Expect(login(token)).NotTo(Succeed())
+		}
+		time.Sleep(probeInterval)
+
+		probed := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			probed <- sync(token)
+		}()
+
+		Eventually(func() controller.CircuitState { return factory.State(token) }).Should(Equal(controller.CircuitHalfOpen))
+		Expect(controller.IsCircuitOpenError(login(token))).To(BeTrue())
+
+		close(unblock)
+		Eventually(probed).Should(Receive(BeNil()))
+		Expect(factory.State(token)).To(Equal(controller.CircuitClosed))
+	})
+
+	It("should keep separate circuits per token and not count auth failures", func() {
+		mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(fmt.Errorf("connection refused")).Times(threshold)
+		mockClient.EXPECT().AccessTokenLogin(otherToken, gomock.Any()).Return(fmt.Errorf("API error: 401 Unauthorized")).Times(threshold + 1)
+
+		for i := 0; i < threshold; i++ {
+			Expect(login(token)).NotTo(Succeed())
+			Expect(login(otherToken)).NotTo(Succeed())
+		}
+
+		Expect(factory.State(token)).To(Equal(controller.CircuitOpen))
+		Expect(factory.State(otherToken)).To(Equal(controller.CircuitClosed))
+		Expect(controller.IsCircuitOpenError(login(otherToken))).To(BeFalse())
+	})
+
+	It("should not count errors the API answered with", func() {
+		mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(fmt.Errorf("API error: 404 Not Found: secret does not exist")).Times(threshold + 1)
+		mockClient.EXPECT().AccessTokenLogin(otherToken, gomock.Any()).Return(fmt.Errorf("API error: 400 Bad Request: The field Key is required.")).Times(threshold + 1)
+
+		for i := 0; i < threshold; i++ {
+			Expect(login(token)).NotTo(Succeed())
+			Expect(login(otherToken)).NotTo(Succeed())
+		}
+
+		Expect(factory.State(token)).To(Equal(controller.CircuitClosed))
+		Expect(factory.State(otherToken)).To(Equal(controller.CircuitClosed))
+		Expect(controller.IsCircuitOpenError(login(token))).To(BeFalse())
+		Expect(controller.IsCircuitOpenError(login(otherToken))).To(BeFalse())
+	})
+
+	It("should only recognize transport errors, timeouts and 5xx statuses as unavailability", func() {
+		Expect(controller.IsUnavailableError(fmt.Errorf("error sending request: connection refused"))).To(BeTrue())
+		Expect(controller.IsUnavailableError(fmt.Errorf("request failed with status code 503"))).To(BeTrue())
+		Expect(controller.IsUnavailableError(fmt.Errorf("API error: 502 Bad Gateway"))).To(BeTrue())
+		Expect(controller.IsUnavailableError(&controller.TimeoutError{Call: "sync", Timeout: time.Second})).To(BeTrue())
+		Expect(controller.IsUnavailableError(fmt.Errorf("secret 5030a2b1-0000-4500-b500-000000000500 not found"))).To(BeFalse())
+		Expect(controller.IsUnavailableError(fmt.Errorf("no access to secret"))).To(BeFalse())
+		Expect(controller.IsUnavailableError(nil)).To(BeFalse())
+	})
+
+	It("should report when the next probe is due", func() {
+		mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(fmt.Errorf("connection refused")).Times(threshold)
+		for i := 0; i < threshold; i++ {
+			Expect(login(token)).NotTo(Succeed())
+		}
+
+		var circuitErr *controller.CircuitOpenError
+		Expect(errors.As(login(token), &circuitErr)).To(BeTrue())
+		Expect(circuitErr.RetryAfter).To(BeNumerically("<=", probeInterval))
+	})
+})
@@ -0,0 +1,229 @@
+package controller_test
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	mocks "github.com/bitwarden/sm-kubernetes/internal/controller/test/mocks"
+)
+
+var _ = Describe("Bitwarden Client Pool Tests", func() {
+	const (
+		firstToken  = "0.first-machine-account-token"
+		secondToken = "0.second-machine-account-token"
+	)
+
+	var (
+		mockCtrl    *gomock.Controller
+		mockFactory *mocks.MockBitwardenClientFactory
+		statePath   string
+	)
+
+	// newMockClient returns a client whose Sync calls are answered by syncFn
+	newMockClient := func(syncFn func() (*sdk.SecretsSyncResponse, error)) *mocks.MockBitwardenClientInterface {
+		mockClient := mocks.NewMockBitwardenClientInterface(mockCtrl)
+		mockSecrets := mocks.NewMockSecretsInterface(mockCtrl)
+		mockClient.EXPECT().Secrets().Return(mockSecrets).AnyTimes()
+		mockSecrets.EXPECT().Sync(gomock.Any(), gomock.Any()).DoAndReturn(func(string, *time.Time) (*sdk.SecretsSyncResponse, error) {
+			return syncFn()
+		}).AnyTimes()
+		return mockClient
+	}
+
+	syncOK := func() (*sdk.SecretsSyncResponse, error) {
+		return &sdk.SecretsSyncResponse{HasChanges: true}, nil
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockFactory = mocks.NewMockBitwardenClientFactory(mockCtrl)
+		mockFactory.EXPECT().GetApiUrl().Return("https://api.bitwarden.com").AnyTimes()
+		statePath = "bin"
+	})
+
+	It("should reuse an authenticated session for the same token", func() {
+		mockClient := newMockClient(syncOK)
+		mockClient.EXPECT().AccessTokenLogin(firstToken, gomock.Any()).Return(nil).Times(1)
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil).Times(1)
+
+		pool := controller.NewBitwardenClientPool(mockFactory, 10, time.Hour)
+
+		for range 3 {
+			client, err := pool.GetBitwardenClient()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.AccessTokenLogin(firstToken, &statePath)).To(Succeed())
+			_, err = client.Secrets().Sync("org", nil)
+			Expect(err).NotTo(HaveOccurred())
+			client.Close()
+		}
+
+		Expect(pool.Size()).To(Equal(1))
+	})
+
+	It("should keep separate sessions per token", func() {
+		firstClient := newMockClient(syncOK)
+		firstClient.EXPECT().AccessTokenLogin(firstToken, gomock.Any()).Return(nil).Times(1)
+		secondClient := newMockClient(syncOK)
+		secondClient.EXPECT().AccessTokenLogin(secondToken, gomock.Any()).Return(nil).Times(1)
+		gomock.InOrder(
+			mockFactory.EXPECT().GetBitwardenClient().Return(firstClient, nil),
+			mockFactory.EXPECT().GetBitwardenClient().Return(secondClient, nil),
+		)
+
+		pool := controller.NewBitwardenClientPool(mockFactory, 10, time.Hour)
+
+		for _, token := range []string{firstToken, secondToken, firstToken, secondToken} {
+			client, _ := pool.GetBitwardenClient()
+			Expect(client.AccessTokenLogin(token, &statePath)).To(Succeed())
+			client.Close()
+		}
+
+		Expect(pool.Size()).To(Equal(2))
+	})
+
+	It("should evict the least recently used idle session when full", func() {
+		firstClient := newMockClient(syncOK)
+		firstClient.EXPECT().AccessTokenLogin(firstToken, gomock.Any()).Return(nil)
+		firstClient.EXPECT().Close().Times(1)
+		secondClient := newMockClient(syncOK)
+		secondClient.EXPECT().AccessTokenLogin(secondToken, gomock.Any()).Return(nil)
+		gomock.InOrder(
+			mockFactory.EXPECT().GetBitwardenClient().Return(firstClient, nil),
+			mockFactory.EXPECT().GetBitwardenClient().Return(secondClient, nil),
+		)
+
+		pool := controller.NewBitwardenClientPool(mockFactory, 1, time.Hour)
+
+		for _, token := range []string{firstToken, secondToken} {
+			client, _ := pool.GetBitwardenClient()
+			Expect(client.AccessTokenLogin(token, &statePath)).To(Succeed())
+			client.Close()
+		}
+
+		Expect(pool.Size()).To(Equal(1))
+	})
+
+	It("should close sessions that have been idle too long", func() {
+		firstClient := newMockClient(syncOK)
+		firstClient.EXPECT().AccessTokenLogin(firstToken, gomock.Any()).Return(nil)
+		firstClient.EXPECT().Close().Times(1)
+		secondClient := newMockClient(syncOK)
+		secondClient.EXPECT().AccessTokenLogin(firstToken, gomock.Any()).Return(nil)
+		gomock.InOrder(
+			mockFactory.EXPECT().GetBitwardenClient().Return(firstClient, nil),
+			mockFactory.EXPECT().GetBitwardenClient().Return(secondClient, nil),
+		)
+
+		pool := controller.NewBitwardenClientPool(mockFactory, 10, 10*time.Millisecond)
+
+		client, _ := pool.GetBitwardenClient()
+		Expect(client.AccessTokenLogin(firstToken, &statePath)).To(Succeed())
+		client.Close()
+
+		time.Sleep(50 * time.Millisecond)
+
+		client, _ = pool.GetBitwardenClient()
+		Expect(client.AccessTokenLogin(firstToken, &statePath)).To(Succeed())
+		client.Close()
+
+		Expect(pool.Size()).To(Equal(1))
+	})
+
+	It("should log in again and retry once on authentication errors", func() {
+		calls := 0
+		mockClient := newMockClient(func() (*sdk.SecretsSyncResponse, error) {
+			calls++
+			if calls == 1 {
+				return nil, fmt.Errorf("API error: Received error message from server: [401 Unauthorized]")
+			}
+			return &sdk.SecretsSyncResponse{HasChanges: true}, nil
+		})
+		mockClient.EXPECT().AccessTokenLogin(firstToken, gomock.Any()).Return(nil).Times(2)
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil).Times(1)
+
+		pool := controller.NewBitwardenClientPool(mockFactory, 10, time.Hour)
+
+		client, _ := pool.GetBitwardenClient()
+		Expect(client.AccessTokenLogin(firstToken, &statePath)).To(Succeed())
+		response, err := client.Secrets().Sync("org", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.HasChanges).To(BeTrue())
+		client.Close()
+
+		Expect(pool.Size()).To(Equal(1))
+	})
+
+	It("should discard sessions that cannot log in again", func() {
+		mockClient := newMockClient(func() (*sdk.SecretsSyncResponse, error) {
+			return nil, fmt.Errorf("API error: Received error message from server: [401 Unauthorized]")
+		})
+		gomock.InOrder(
+			mockClient.EXPECT().AccessTokenLogin(firstToken, gomock.Any()).Return(nil),
+			mockClient.EXPECT().AccessTokenLogin(firstToken, gomock.Any()).Return(fmt.Errorf("API error: invalid_client")),
+		)
+		mockClient.EXPECT().Close().Times(1)
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil).Times(1)
+
+		pool := controller.NewBitwardenClientPool(mockFactory, 10, time.Hour)
+
+		client, _ := pool.GetBitwardenClient()
+		Expect(client.AccessTokenLogin(firstToken, &statePath)).To(Succeed())
+		_, err := client.Secrets().Sync("org", nil)
+		Expect(err).To(HaveOccurred())
+		client.Close()
+
+		Expect(pool.Size()).To(Equal(0))
+	})
+
+	It("should not hand the same session to concurrent callers", func() {
+		var mu sync.Mutex
+		inUse := map[*mocks.MockBitwardenClientInterface]bool{}
+
+		mockFactory.EXPECT().GetBitwardenClient().DoAndReturn(func() (sdk.BitwardenClientInterface, error) {
+			var mockClient *mocks.MockBitwardenClientInterface
+			mockClient = newMockClient(func() (*sdk.SecretsSyncResponse, error) {
+				mu.Lock()
+				Expect(inUse[mockClient]).To(BeFalse())
+				inUse[mockClient] = true
+				mu.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				mu.Lock()
+				inUse[mockClient] = false
+				mu.Unlock()
+				return &sdk.SecretsSyncResponse{}, nil
+			})
+			mockClient.EXPECT().AccessTokenLogin(firstToken, gomock.Any()).Return(nil)
+			mockClient.EXPECT().Close().AnyTimes()
+			return mockClient, nil
+		}).AnyTimes()
+
+		pool := controller.NewBitwardenClientPool(mockFactory, 4, time.Hour)
+
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				client, _ := pool.GetBitwardenClient()
+				Expect(client.AccessTokenLogin(firstToken, &statePath)).To(Succeed())
+				_, err := client.Secrets().Sync("org", nil)
+				Expect(err).NotTo(HaveOccurred())
+				client.Close()
+			}()
+		}
+		wg.Wait()
+
+		Expect(pool.Size()).To(BeNumerically("<=", 4))
+	})
+})
@@ -0,0 +1,162 @@
+package controller_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	mocks "github.com/bitwarden/sm-kubernetes/internal/controller/test/mocks"
+)
+
+var _ = Describe("Bitwarden Client Timeout Tests", func() {
+	const (
+		token   = "0.machine-account-token"
+		timeout = 50 * time.Millisecond
+	)
+
+	var (
+		mockCtrl    *gomock.Controller
+		mockFactory *mocks.MockBitwardenClientFactory
+		statePath   string
+	)
+
+	// newMockClient returns a client whose Sync calls block until unblock is closed
+	newMockClient := func(unblock <-chan struct{}) (*mocks.MockBitwardenClientInterface, *mocks.MockSecretsInterface) {
+		mockClient := mocks.NewMockBitwardenClientInterface(mockCtrl)
+		mockSecrets := mocks.NewMockSecretsInterface(mockCtrl)
+		mockClient.EXPECT().Secrets().Return(mockSecrets).AnyTimes()
+		mockSecrets.EXPECT().Sync(gomock.Any(), gomock.Any()).DoAndReturn(func(string, *time.Time) (*sdk.SecretsSyncResponse, error) {
+			<-unblock
+			return &sdk.SecretsSyncResponse{HasChanges: true}, nil
+		}).AnyTimes()
+		return mockClient, mockSecrets
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockFactory = mocks.NewMockBitwardenClientFactory(mockCtrl)
+		mockFactory.EXPECT().GetApiUrl().Return("https://api.bitwarden.com").AnyTimes()
+		statePath = "bin"
+	})
+
+	It("should return the result of calls completing within the deadline", func() {
+		unblock := make(chan struct{})
+		close(unblock)
+		mockClient, _ := newMockClient(unblock)
+		mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(nil)
+		mockClient.EXPECT().Close().Times(1)
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil)
+
+		client, err := controller.NewTimeoutClientFactory(mockFactory, time.Second).GetBitwardenClient()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.AccessTokenLogin(token, &statePath)).To(Succeed())
+
+		response, err := client.Secrets().Sync("org", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.HasChanges).To(BeTrue())
+
+		client.Close()
+	})
+
+	It("should abandon a call exceeding the deadline and close the client once it returns", func() {
+		unblock := make(chan struct{})
+		mockClient, _ := newMockClient(unblock)
+		mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(nil)
+		closed := make(chan struct{})
+		mockClient.EXPECT().Close().Do(func() { close(closed) }).Times(1)
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil)
+
+		client, err := controller.NewTimeoutClientFactory(mockFactory, timeout).GetBitwardenClient()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.AccessTokenLogin(token, &statePath)).To(Succeed())
+
+		_, err = client.Secrets().Sync("org", nil)
+		Expect(controller.IsTimeoutError(err)).To(BeTrue())
+
+		// The client is unusable while the abandoned call is running
+		Expect(controller.IsTimeoutError(client.AccessTokenLogin(token, &statePath))).To(BeTrue())
+
+		client.Close()
+		Consistently(closed, 2*timeout).ShouldNot(BeClosed())
+
+		close(unblock)
+		Eventually(closed).Should(BeClosed())
+	})
+
+	It("should keep the state of an abandoned call until it returns", func() {
+		unblock := make(chan struct{})
+		mockClient, _ := newMockClient(unblock)
+		mockClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(nil)
+		mockClient.EXPECT().Close().Times(1)
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil)
+
+		stateStore, err := controller.NewStateStore(GinkgoT().TempDir(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		reconciler := &controller.BitwardenSecretReconciler{
+			BitwardenClientFactory: controller.NewTimeoutClientFactory(mockFactory, timeout),
+			StateStore:             stateStore,
+		}
+
+		_, err = reconciler.SyncSecrets(GinkgoLogr, "org", token, nil)
+		Expect(controller.IsTimeoutError(err)).To(BeTrue())
+
+		// The next session for the token waits for the abandoned call, which may still write the state
+		acquired := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			_, release, err := stateStore.Acquire(token)
+			Expect(err).NotTo(HaveOccurred())
+			close(acquired)
+			Expect(release()).To(Succeed())
+		}()
+		Consistently(acquired, 2*timeout).ShouldNot(BeClosed())
+
+		close(unblock)
+		Eventually(acquired).Should(BeClosed())
+	})
+
+	It("should discard a pooled session whose call was abandoned", func() {
+		unblock := make(chan struct{})
+		stuckClient, _ := newMockClient(unblock)
+		stuckClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(nil)
+		closed := make(chan struct{})
+		stuckClient.EXPECT().Close().Do(func() { close(closed) }).Times(1)
+
+		healthy := make(chan struct{})
+		close(healthy)
+		healthyClient, _ := newMockClient(healthy)
+		healthyClient.EXPECT().AccessTokenLogin(token, gomock.Any()).Return(nil)
+
+		gomock.InOrder(
+			mockFactory.EXPECT().GetBitwardenClient().Return(stuckClient, nil),
+			mockFactory.EXPECT().GetBitwardenClient().Return(healthyClient, nil),
+		)
+
+		pool := controller.NewBitwardenClientPool(mockFactory, 10, time.Hour)
+		factory := controller.NewTimeoutClientFactory(pool, timeout)
+
+		client, err := factory.GetBitwardenClient()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.AccessTokenLogin(token, &statePath)).To(Succeed())
+		_, err = client.Secrets().Sync("org", nil)
+		Expect(controller.IsTimeoutError(err)).To(BeTrue())
+		client.Close()
+
+		// The stuck session is still checked out, so the next caller gets a new one
+		client, err = factory.GetBitwardenClient()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.AccessTokenLogin(token, &statePath)).To(Succeed())
+		_, err = client.Secrets().Sync("org", nil)
+		Expect(err).NotTo(HaveOccurred())
+		client.Close()
+		Expect(pool.Size()).To(Equal(2))
+
+		close(unblock)
+		Eventually(closed).Should(BeClosed())
+		Eventually(pool.Size).Should(Equal(1))
+	})
+})
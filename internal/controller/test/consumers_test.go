@@ -0,0 +1,138 @@
+package controller_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+// builderIndexer registers the indexes of the operator on a fake client
+type builderIndexer struct {
+	builder *fake.ClientBuilder
+}
+
+func (i builderIndexer) IndexField(_ context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	i.builder.WithIndex(obj, field, extractValue)
+	return nil
+}
+
+var _ = Describe("Consumer Tracker Tests", func() {
+	const namespace = "default"
+
+	var (
+		ctx     context.Context
+		tracker *controller.ConsumerTracker
+		data    map[string][]byte
+	)
+
+	keyRef := func(secretName string, key string) corev1.Container {
+		return corev1.Container{Name: "app", Image: "app", Env: []corev1.EnvVar{{Name: "VALUE", ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: key},
+		}}}}
+	}
+
+	pod := func(name string, owner string, phase corev1.PodPhase, container corev1.Container) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{container}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+		if owner != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: owner, UID: "rs", Controller: ptr.To(true)}}
+		}
+		return p
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		data = map[string][]byte{"password": []byte("secret"), "username": []byte("app")}
+
+		builder := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme)
+		Expect(controller.IndexConsumers(ctx, builderIndexer{builder})).To(Succeed())
+
+		pullSecret := corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "synced"}}, Containers: []corev1.Container{{Name: "app", Image: "app"}}}
+		k8sClient := builder.WithObjects(
+			pod("web-1", "web-5d8f", corev1.PodRunning, keyRef("synced", "password")),
+			pod("web-2", "web-5d8f", corev1.PodRunning, keyRef("synced", "password")),
+			pod("debug", "", corev1.PodRunning, keyRef("synced", "old-password")),
+			pod("migration", "", corev1.PodSucceeded, keyRef("synced", "password")),
+			pod("unrelated", "", corev1.PodRunning, keyRef("other", "password")),
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other-namespace", Namespace: "other"}, Spec: pullSecret},
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "puller", Namespace: namespace}, Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{Spec: pullSecret},
+			}},
+			&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: namespace}, Spec: appsv1.StatefulSetSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "db", Image: "db"}},
+					Volumes: []corev1.Volume{{Name: "secret", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+						SecretName: "synced",
+						Items:      []corev1.KeyToPath{{Key: "username", Path: "user"}, {Key: "root-password", Path: "root"}},
+					}}}},
+				}},
+			}},
+		).Build()
+		tracker = &controller.ConsumerTracker{Reader: k8sClient}
+	})
+
+	It("should find the secrets and keys a pod spec references", func() {
+		spec := &corev1.PodSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+			InitContainers:   []corev1.Container{keyRef("synced", "password")},
+			Containers: []corev1.Container{
+				keyRef("synced", "password"),
+				{EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "env"}}}}},
+			},
+			Volumes: []corev1.Volume{{Name: "projected", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{{Secret: &corev1.SecretProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "synced"},
+					Items:                []corev1.KeyToPath{{Key: "username", Path: "user"}},
+				}}},
+			}}}},
+		}
+
+		Expect(controller.SecretReferences(spec)).To(Equal(map[string][]string{
+			"registry": nil,
+			"env":      nil,
+			"synced":   {"password", "username"},
+		}))
+	})
+
+	It("should list the consumers of a secret with the keys missing from it", func() {
+		consumers, err := tracker.Consumers(ctx, namespace, "synced", data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(consumers).To(Equal([]operatorsv1.SecretConsumer{
+			{Kind: "Deployment", Name: "puller"},
+			{Kind: "Pod", Name: "debug", Pods: 1, MissingKeys: []string{"old-password"}},
+			{Kind: "ReplicaSet", Name: "web-5d8f", Pods: 2},
+			{Kind: "StatefulSet", Name: "db", MissingKeys: []string{"root-password"}},
+		}))
+
+		condition := controller.ConsumersCondition("synced", consumers)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(controller.ReasonMissingKeys))
+		Expect(condition.Message).To(ContainSubstring("Pod/debug references old-password"))
+		Expect(condition.Message).To(ContainSubstring("StatefulSet/db references root-password"))
+	})
+
+	It("should report secrets without consumers", func() {
+		consumers, err := tracker.Consumers(ctx, namespace, "unused", data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(consumers).To(BeEmpty())
+		Expect(controller.ConsumersCondition("unused", consumers).Reason).To(Equal(controller.ReasonNoConsumers))
+
+		consumers = []operatorsv1.SecretConsumer{{Kind: "Deployment", Name: "puller"}}
+		Expect(controller.ConsumersCondition("synced", consumers).Status).To(Equal(metav1.ConditionTrue))
+	})
+})
@@ -0,0 +1,214 @@
+package controller_test
+
+import (
+	"context"
+	"time"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	mocks "github.com/bitwarden/sm-kubernetes/internal/controller/test/mocks"
+)
+
+var _ = Describe("Generated Secret Tests", func() {
+	const (
+		namespace = "default"
+		orgId     = "a08a8157-129e-4002-bab4-b118014ca9c7"
+		projectId = "1b2e5a7c-08d4-4f4e-9a2b-b155012d0001"
+	)
+
+	var (
+		ctx            context.Context
+		k8sClient      client.Client
+		reconciler     *controller.BitwardenGeneratedSecretReconciler
+		recorder       *events.FakeRecorder
+		mockSecrets    *mocks.MockSecretsInterface
+		mockGenerators *mocks.MockGeneratorsInterface
+		generated      *operatorsv1.BitwardenGeneratedSecret
+	)
+
+	generatedKey := types.NamespacedName{Name: "generated", Namespace: namespace}
+	k8sSecretKey := types.NamespacedName{Name: "db", Namespace: namespace}
+	options := operatorsv1.PasswordOptions{Length: 24, Lowercase: true, Uppercase: true, Numbers: true}
+
+	response := func(id string, value string, project string) sdk.SecretResponse {
+		return sdk.SecretResponse{ID: id, Key: "db-password", Value: value, OrganizationID: orgId, ProjectID: &project, RevisionDate: time.Now()}
+	}
+
+	reconcileGenerated := func() (ctrl.Result, error) {
+		return reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: generatedKey})
+	}
+
+	currentGenerated := func() *operatorsv1.BitwardenGeneratedSecret {
+		current := &operatorsv1.BitwardenGeneratedSecret{}
+		Expect(k8sClient.Get(ctx, generatedKey, current)).To(Succeed())
+		return current
+	}
+
+	syncedPassword := func() string {
+		k8sSecret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, k8sSecretKey, k8sSecret)).To(Succeed())
+		return string(k8sSecret.Data["password"])
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		generated = &operatorsv1.BitwardenGeneratedSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: generatedKey.Name, Namespace: namespace, UID: "generated-uid"},
+			Spec: operatorsv1.BitwardenGeneratedSecretSpec{
+				SecretName:     k8sSecretKey.Name,
+				SecretKey:      "password",
+				OrganizationId: orgId,
+				ProjectId:      projectId,
+				BwSecretName:   "db-password",
+				AuthToken:      operatorsv1.AuthToken{SecretName: "bw-auth-token", SecretKey: "token"},
+				Password:       options,
+			},
+		}
+		authToken := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bw-auth-token", Namespace: namespace},
+			Data:       map[string][]byte{"token": []byte("abc-123")},
+		}
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(operatorsv1.AddToScheme(scheme)).To(Succeed())
+		k8sClient = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(generated, authToken).
+			WithStatusSubresource(&operatorsv1.BitwardenGeneratedSecret{}).
+			Build()
+
+		mockCtrl := gomock.NewController(GinkgoT())
+		mockFactory := mocks.NewMockBitwardenClientFactory(mockCtrl)
+		mockClient := mocks.NewMockBitwardenClientInterface(mockCtrl)
+		mockSecrets = mocks.NewMockSecretsInterface(mockCtrl)
+		mockGenerators = mocks.NewMockGeneratorsInterface(mockCtrl)
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil).AnyTimes()
+		mockClient.EXPECT().AccessTokenLogin("abc-123", gomock.Any()).Return(nil).AnyTimes()
+		mockClient.EXPECT().Secrets().Return(mockSecrets).AnyTimes()
+		mockClient.EXPECT().Generators().Return(mockGenerators).AnyTimes()
+		mockClient.EXPECT().Close().AnyTimes()
+
+		stateStore, err := controller.NewStateStore(GinkgoT().TempDir(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		recorder = events.NewFakeRecorder(10)
+		reconciler = &controller.BitwardenGeneratedSecretReconciler{
+			Client:                 k8sClient,
+			Scheme:                 scheme,
+			BitwardenClientFactory: mockFactory,
+			StateStore:             stateStore,
+			Recorder:               recorder,
+			RefreshIntervalSeconds: 300,
+		}
+	})
+
+	It("should build the generator request from the password options", func() {
+		request, err := controller.PasswordGeneratorRequest(operatorsv1.PasswordOptions{
+			Length: 16, Lowercase: true, Numbers: true, AvoidAmbiguous: true,
+			MinNumber: ptr.To[int64](3), MinSpecial: ptr.To[int64](2),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(request).To(Equal(sdk.PasswordGeneratorRequest{
+			Length: 16, Lowercase: true, Numbers: true, AvoidAmbiguous: true, MinNumber: ptr.To[int64](3),
+		}))
+
+		_, err = controller.PasswordGeneratorRequest(operatorsv1.PasswordOptions{Length: 16})
+		Expect(err).To(MatchError(ContainSubstring("no character class")))
+
+		_, err = controller.PasswordGeneratorRequest(operatorsv1.PasswordOptions{Length: 4, Numbers: true, Special: true, MinNumber: ptr.To[int64](3), MinSpecial: ptr.To[int64](2)})
+		Expect(err).To(MatchError(ContainSubstring("less than the sum 5 of the minimums")))
+	})
+
+	It("should generate the password once and record the secret in the status", func() {
+		mockSecrets.EXPECT().List(orgId).Return(&sdk.SecretIdentifiersResponse{Data: []sdk.SecretIdentifierResponse{{ID: "other", Key: "api-key"}}}, nil)
+		mockGenerators.EXPECT().GeneratePassword(sdk.PasswordGeneratorRequest{Length: 24, Lowercase: true, Uppercase: true, Numbers: true}).
+			Return(ptr.To("s3cr3t-Passw0rd"), nil)
+		created := response("bw-1", "s3cr3t-Passw0rd", projectId)
+		mockSecrets.EXPECT().Create("db-password", "s3cr3t-Passw0rd", controller.GeneratedSecretNote(generated), orgId, []string{projectId}).Return(&created, nil)
+
+		result, err := reconcileGenerated()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+		current := currentGenerated()
+		Expect(current.Status.BwSecretId).To(Equal("bw-1"))
+		Expect(current.Status.GeneratedTime.IsZero()).To(BeFalse())
+		Expect(apimeta.IsStatusConditionTrue(current.Status.Conditions, controller.ConditionSuccessfulSync)).To(BeTrue())
+		Expect(recorder.Events).To(Receive(ContainSubstring(controller.ReasonPasswordGenerated)))
+
+		k8sSecret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, k8sSecretKey, k8sSecret)).To(Succeed())
+		Expect(k8sSecret.Data).To(Equal(map[string][]byte{"password": []byte("s3cr3t-Passw0rd")}))
+		Expect(k8sSecret.Labels[controller.LabelSecretRole]).To(Equal(controller.SecretRoleSynced))
+		Expect(metav1.IsControlledBy(k8sSecret, current)).To(BeTrue())
+
+		// Later syncs only read the recorded secret, picking up a rotation done in Secrets Manager
+		rotated := response("bw-1", "r0tated", projectId)
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1"}).Return(&sdk.SecretsResponse{Data: []sdk.SecretResponse{rotated}}, nil)
+		_, err = reconcileGenerated()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(syncedPassword()).To(Equal("r0tated"))
+	})
+
+	It("should use an existing secret of the project with the name instead of generating one", func() {
+		mockSecrets.EXPECT().List(orgId).Return(&sdk.SecretIdentifiersResponse{Data: []sdk.SecretIdentifierResponse{
+			{ID: "bw-1", Key: "db-password"}, {ID: "bw-2", Key: "db-password"},
+		}}, nil)
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1", "bw-2"}).Return(&sdk.SecretsResponse{Data: []sdk.SecretResponse{
+			response("bw-1", "elsewhere", "other-project"),
+			response("bw-2", "existing", projectId),
+		}}, nil)
+
+		_, err := reconcileGenerated()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(currentGenerated().Status.BwSecretId).To(Equal("bw-2"))
+		Expect(syncedPassword()).To(Equal("existing"))
+		Expect(recorder.Events).To(Receive(ContainSubstring(controller.ReasonExistingSecretFound)))
+	})
+
+	It("should not generate a password again when the secret is gone", func() {
+		generated.Status.BwSecretId = "bw-1"
+		Expect(k8sClient.Status().Update(ctx, generated)).To(Succeed())
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1"}).Return(&sdk.SecretsResponse{}, nil)
+
+		_, err := reconcileGenerated()
+		Expect(err).To(MatchError(ContainSubstring("generated secret bw-1 does not exist")))
+
+		current := currentGenerated()
+		Expect(current.Status.BwSecretId).To(Equal("bw-1"))
+		Expect(apimeta.IsStatusConditionFalse(current.Status.Conditions, controller.ConditionSuccessfulSync)).To(BeTrue())
+	})
+
+	It("should not write a Kubernetes secret it does not manage", func() {
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: k8sSecretKey.Name, Namespace: namespace},
+			Data:       map[string][]byte{"password": []byte("hand-made")},
+		})).To(Succeed())
+		generated.Status.BwSecretId = "bw-1"
+		Expect(k8sClient.Status().Update(ctx, generated)).To(Succeed())
+		value := response("bw-1", "generated", projectId)
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1"}).Return(&sdk.SecretsResponse{Data: []sdk.SecretResponse{value}}, nil)
+
+		_, err := reconcileGenerated()
+		Expect(err).To(MatchError(ContainSubstring("is not managed by BitwardenGeneratedSecret generated")))
+		Expect(syncedPassword()).To(Equal("hand-made"))
+	})
+})
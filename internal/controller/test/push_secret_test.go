@@ -0,0 +1,324 @@
+package controller_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	mocks "github.com/bitwarden/sm-kubernetes/internal/controller/test/mocks"
+)
+
+var _ = Describe("Push Secret Tests", func() {
+	const (
+		namespace = "default"
+		orgId     = "a08a8157-129e-4002-bab4-b118014ca9c7"
+		projectId = "1b2e5a7c-08d4-4f4e-9a2b-b155012d0001"
+	)
+
+	var (
+		ctx         context.Context
+		k8sClient   client.Client
+		reconciler  *controller.BitwardenPushSecretReconciler
+		recorder    *events.FakeRecorder
+		mockSecrets *mocks.MockSecretsInterface
+		pushSecret  *operatorsv1.BitwardenPushSecret
+		source      *corev1.Secret
+		pushedAt    time.Time
+	)
+
+	pushKey := types.NamespacedName{Name: "push", Namespace: namespace}
+
+	response := func(id string, key string, value string, revision time.Time) *sdk.SecretResponse {
+		project := projectId
+		return &sdk.SecretResponse{
+			ID:             id,
+			Key:            key,
+			Value:          value,
+			Note:           controller.PushNote(pushSecret),
+			OrganizationID: orgId,
+			ProjectID:      &project,
+			RevisionDate:   revision,
+		}
+	}
+
+	record := func(key string, id string) operatorsv1.PushedSecret {
+		return operatorsv1.PushedSecret{SecretKeyName: key, BwSecretId: id, RevisionDate: pushedAt.Format(time.RFC3339Nano)}
+	}
+
+	reconcilePush := func() (ctrl.Result, error) {
+		return reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: pushKey})
+	}
+
+	currentPushSecret := func() *operatorsv1.BitwardenPushSecret {
+		current := &operatorsv1.BitwardenPushSecret{}
+		Expect(k8sClient.Get(ctx, pushKey, current)).To(Succeed())
+		return current
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		pushedAt = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		pushSecret = &operatorsv1.BitwardenPushSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: pushKey.Name, Namespace: namespace},
+			Spec: operatorsv1.BitwardenPushSecretSpec{
+				SecretName:     "credentials",
+				OrganizationId: orgId,
+				ProjectId:      projectId,
+				AuthToken:      operatorsv1.AuthToken{SecretName: "bw-auth-token", SecretKey: "token"},
+				Map:            []operatorsv1.PushSecretMap{{SecretKeyName: "password", BwSecretName: "db-password"}},
+				ConflictPolicy: operatorsv1.PushConflictSkip,
+				DeletionPolicy: operatorsv1.PushDeletionRetain,
+			},
+		}
+		source = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: namespace},
+			Data:       map[string][]byte{"password": []byte("hunter2"), "username": []byte("app")},
+		}
+		authToken := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bw-auth-token", Namespace: namespace},
+			Data:       map[string][]byte{"token": []byte("abc-123")},
+		}
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(operatorsv1.AddToScheme(scheme)).To(Succeed())
+		k8sClient = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(pushSecret, source, authToken).
+			WithStatusSubresource(&operatorsv1.BitwardenPushSecret{}).
+			Build()
+
+		mockCtrl := gomock.NewController(GinkgoT())
+		mockFactory := mocks.NewMockBitwardenClientFactory(mockCtrl)
+		mockClient := mocks.NewMockBitwardenClientInterface(mockCtrl)
+		mockSecrets = mocks.NewMockSecretsInterface(mockCtrl)
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil).AnyTimes()
+		mockClient.EXPECT().AccessTokenLogin("abc-123", gomock.Any()).Return(nil).AnyTimes()
+		mockClient.EXPECT().Secrets().Return(mockSecrets).AnyTimes()
+		mockClient.EXPECT().Close().AnyTimes()
+
+		stateStore, err := controller.NewStateStore(GinkgoT().TempDir(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		recorder = events.NewFakeRecorder(10)
+		reconciler = &controller.BitwardenPushSecretReconciler{
+			Client:                 k8sClient,
+			BitwardenClientFactory: mockFactory,
+			StateStore:             stateStore,
+			Recorder:               recorder,
+			RefreshIntervalSeconds: 300,
+		}
+	})
+
+	It("should push the mapped keys or every key of the secret", func() {
+		entries, err := controller.PushEntries(pushSecret, source)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(Equal([]controller.PushEntry{{SecretKeyName: "password", BwSecretName: "db-password", Value: "hunter2"}}))
+
+		pushSecret.Spec.Map = nil
+		entries, err = controller.PushEntries(pushSecret, source)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(Equal([]controller.PushEntry{
+			{SecretKeyName: "password", BwSecretName: "password", Value: "hunter2"},
+			{SecretKeyName: "username", BwSecretName: "username", Value: "app"},
+		}))
+	})
+
+	It("should refuse to push missing keys and binary values", func() {
+		source.Data["certificate"] = []byte{0xff, 0xfe}
+		pushSecret.Spec.Map = append(pushSecret.Spec.Map,
+			operatorsv1.PushSecretMap{SecretKeyName: "api-key", BwSecretName: "api-key"},
+			operatorsv1.PushSecretMap{SecretKeyName: "certificate", BwSecretName: "certificate"})
+
+		_, err := controller.PushEntries(pushSecret, source)
+		Expect(err).To(MatchError(ContainSubstring("has no keys api-key")))
+		Expect(err).To(MatchError(ContainSubstring("keys certificate of secret default/credentials are not valid UTF-8")))
+	})
+
+	It("should create the secrets and record them in the status", func() {
+		mockSecrets.EXPECT().List(orgId).Return(&sdk.SecretIdentifiersResponse{}, nil)
+		mockSecrets.EXPECT().Create("db-password", "hunter2", controller.PushNote(pushSecret), orgId, []string{projectId}).
+			Return(response("bw-1", "db-password", "hunter2", pushedAt), nil)
+
+		result, err := reconcilePush()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+		current := currentPushSecret()
+		Expect(current.Status.PushedSecrets).To(Equal([]operatorsv1.PushedSecret{record("password", "bw-1")}))
+		Expect(apimeta.IsStatusConditionTrue(current.Status.Conditions, controller.ConditionSuccessfulPush)).To(BeTrue())
+		Expect(apimeta.IsStatusConditionFalse(current.Status.Conditions, controller.ConditionConflicted)).To(BeTrue())
+		Expect(current.Finalizers).To(BeEmpty())
+	})
+
+	It("should update changed values and leave unchanged ones alone", func() {
+		pushSecret.Status.PushedSecrets = []operatorsv1.PushedSecret{record("password", "bw-1")}
+		entries := []controller.PushEntry{{SecretKeyName: "password", BwSecretName: "db-password", Value: "hunter2"}}
+
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1"}).
+			Return(&sdk.SecretsResponse{Data: []sdk.SecretResponse{*response("bw-1", "db-password", "hunter2", pushedAt)}}, nil)
+		pushed, err := controller.Push(mockSecrets, pushSecret, entries)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pushed).To(Equal([]operatorsv1.PushedSecret{record("password", "bw-1")}))
+
+		updatedAt := pushedAt.Add(time.Minute)
+		entries[0].Value = "correct-horse"
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1"}).
+			Return(&sdk.SecretsResponse{Data: []sdk.SecretResponse{*response("bw-1", "db-password", "hunter2", pushedAt)}}, nil)
+		mockSecrets.EXPECT().Update("bw-1", "db-password", "correct-horse", controller.PushNote(pushSecret), orgId, []string{projectId}).
+			Return(response("bw-1", "db-password", "correct-horse", updatedAt), nil)
+		pushed, err = controller.Push(mockSecrets, pushSecret, entries)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pushed[0].RevisionDate).To(Equal(updatedAt.Format(time.RFC3339Nano)))
+	})
+
+	It("should push secrets again that were deleted from Secrets Manager", func() {
+		pushSecret.Status.PushedSecrets = []operatorsv1.PushedSecret{record("password", "bw-1")}
+		entries := []controller.PushEntry{{SecretKeyName: "password", BwSecretName: "db-password", Value: "hunter2"}}
+
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1"}).Return(&sdk.SecretsResponse{}, nil)
+		mockSecrets.EXPECT().List(orgId).Return(&sdk.SecretIdentifiersResponse{}, nil)
+		mockSecrets.EXPECT().Create("db-password", "hunter2", gomock.Any(), orgId, []string{projectId}).
+			Return(response("bw-2", "db-password", "hunter2", pushedAt), nil)
+
+		pushed, err := controller.Push(mockSecrets, pushSecret, entries)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pushed).To(Equal([]operatorsv1.PushedSecret{record("password", "bw-2")}))
+	})
+
+	It("should adopt secrets it pushed before that are missing from the status", func() {
+		entries := []controller.PushEntry{
+			{SecretKeyName: "password", BwSecretName: "db-password", Value: "hunter2"},
+			{SecretKeyName: "username", BwSecretName: "db-username", Value: "app"},
+		}
+		foreign := response("bw-3", "db-password", "hunter2", pushedAt)
+		foreign.Note = "Created by hand"
+
+		mockSecrets.EXPECT().List(orgId).Return(&sdk.SecretIdentifiersResponse{Data: []sdk.SecretIdentifierResponse{
+			{ID: "bw-1", Key: "db-password"}, {ID: "bw-2", Key: "api-key"}, {ID: "bw-3", Key: "db-password"},
+		}}, nil)
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1", "bw-3"}).Return(&sdk.SecretsResponse{Data: []sdk.SecretResponse{
+			*response("bw-1", "db-password", "hunter2", pushedAt), *foreign,
+		}}, nil)
+		mockSecrets.EXPECT().Create("db-username", "app", gomock.Any(), orgId, []string{projectId}).
+			Return(response("bw-4", "db-username", "app", pushedAt), nil)
+
+		pushed, err := controller.Push(mockSecrets, pushSecret, entries)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pushed).To(Equal([]operatorsv1.PushedSecret{record("password", "bw-1"), record("username", "bw-4")}))
+	})
+
+	It("should only overwrite secrets edited in Secrets Manager with the Overwrite conflict policy", func() {
+		pushSecret.Status.PushedSecrets = []operatorsv1.PushedSecret{record("password", "bw-1")}
+		Expect(k8sClient.Status().Update(ctx, pushSecret)).To(Succeed())
+		editedAt := pushedAt.Add(time.Hour)
+
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1"}).
+			Return(&sdk.SecretsResponse{Data: []sdk.SecretResponse{*response("bw-1", "db-password", "edited", editedAt)}}, nil)
+		_, err := reconcilePush()
+		Expect(err).NotTo(HaveOccurred())
+
+		current := currentPushSecret()
+		Expect(current.Status.PushedSecrets[0].Conflicted).To(BeTrue())
+		Expect(current.Status.PushedSecrets[0].RevisionDate).To(Equal(pushedAt.Format(time.RFC3339Nano)))
+		Expect(apimeta.IsStatusConditionTrue(current.Status.Conditions, controller.ConditionConflicted)).To(BeTrue())
+		Expect(recorder.Events).To(Receive(ContainSubstring(controller.ReasonEditedInBw)))
+
+		pushSecret = current
+		pushSecret.Spec.ConflictPolicy = operatorsv1.PushConflictOverwrite
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1"}).
+			Return(&sdk.SecretsResponse{Data: []sdk.SecretResponse{*response("bw-1", "db-password", "edited", editedAt)}}, nil)
+		mockSecrets.EXPECT().Update("bw-1", "db-password", "hunter2", gomock.Any(), orgId, []string{projectId}).
+			Return(response("bw-1", "db-password", "hunter2", editedAt.Add(time.Second)), nil)
+		pushed, err := controller.Push(mockSecrets, pushSecret, []controller.PushEntry{{SecretKeyName: "password", BwSecretName: "db-password", Value: "hunter2"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pushed[0].Conflicted).To(BeFalse())
+	})
+
+	It("should delete the secrets of keys no longer pushed with the Delete deletion policy", func() {
+		pushSecret.Status.PushedSecrets = []operatorsv1.PushedSecret{record("password", "bw-1"), record("username", "bw-2")}
+		entries := []controller.PushEntry{{SecretKeyName: "password", BwSecretName: "db-password", Value: "hunter2"}}
+		current := &sdk.SecretsResponse{Data: []sdk.SecretResponse{
+			*response("bw-1", "db-password", "hunter2", pushedAt),
+			*response("bw-2", "username", "app", pushedAt),
+		}}
+
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1", "bw-2"}).Return(current, nil)
+		pushed, err := controller.Push(mockSecrets, pushSecret, entries)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pushed).To(Equal([]operatorsv1.PushedSecret{record("password", "bw-1")}))
+
+		pushSecret.Spec.DeletionPolicy = operatorsv1.PushDeletionDelete
+		mockSecrets.EXPECT().GetByIDS([]string{"bw-1", "bw-2"}).Return(current, nil)
+		mockSecrets.EXPECT().Delete([]string{"bw-2"}).Return(&sdk.SecretsDeleteResponse{}, nil)
+		pushed, err = controller.Push(mockSecrets, pushSecret, entries)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pushed).To(Equal([]operatorsv1.PushedSecret{record("password", "bw-1")}))
+	})
+
+	It("should keep the secrets pushed before a failure", func() {
+		pushSecret.Spec.Map = nil
+		Expect(k8sClient.Update(ctx, pushSecret)).To(Succeed())
+		mockSecrets.EXPECT().List(orgId).Return(&sdk.SecretIdentifiersResponse{}, nil)
+		mockSecrets.EXPECT().Create("password", "hunter2", gomock.Any(), orgId, []string{projectId}).
+			Return(response("bw-1", "password", "hunter2", pushedAt), nil)
+		mockSecrets.EXPECT().Create("username", "app", gomock.Any(), orgId, []string{projectId}).
+			Return(nil, fmt.Errorf("API error: 503 Service Unavailable"))
+
+		_, err := reconcilePush()
+		Expect(err).To(MatchError(ContainSubstring("503")))
+
+		current := currentPushSecret()
+		Expect(current.Status.PushedSecrets).To(Equal([]operatorsv1.PushedSecret{record("password", "bw-1")}))
+		condition := apimeta.FindStatusCondition(current.Status.Conditions, controller.ConditionSuccessfulPush)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(controller.ReasonPushFailed))
+	})
+
+	It("should wait for a missing source secret", func() {
+		Expect(k8sClient.Delete(ctx, source)).To(Succeed())
+
+		result, err := reconcilePush()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(300 * time.Second))
+
+		condition := apimeta.FindStatusCondition(currentPushSecret().Status.Conditions, controller.ConditionSuccessfulPush)
+		Expect(condition.Reason).To(Equal(controller.ReasonSourceNotFound))
+	})
+
+	It("should delete the pushed secrets with the BitwardenPushSecret with the Delete deletion policy", func() {
+		pushSecret.Spec.DeletionPolicy = operatorsv1.PushDeletionDelete
+		Expect(k8sClient.Update(ctx, pushSecret)).To(Succeed())
+		mockSecrets.EXPECT().List(orgId).Return(&sdk.SecretIdentifiersResponse{}, nil)
+		mockSecrets.EXPECT().Create("db-password", "hunter2", gomock.Any(), orgId, []string{projectId}).
+			Return(response("bw-1", "db-password", "hunter2", pushedAt), nil)
+
+		_, err := reconcilePush()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(currentPushSecret().Finalizers).To(ConsistOf(controller.FinalizerPushSecret))
+
+		mockSecrets.EXPECT().Delete([]string{"bw-1"}).Return(&sdk.SecretsDeleteResponse{}, nil)
+		Expect(k8sClient.Delete(ctx, currentPushSecret())).To(Succeed())
+		_, err = reconcilePush()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, pushKey, &operatorsv1.BitwardenPushSecret{})).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,128 @@
+package controller_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+var _ = Describe("Readiness Gate Tests", func() {
+	const namespace = "default"
+
+	var (
+		ctx        context.Context
+		k8sClient  client.Client
+		reconciler *controller.PodReadinessReconciler
+		bwSecret   *operatorsv1.BitwardenSecret
+	)
+
+	podKey := types.NamespacedName{Name: "app", Namespace: namespace}
+
+	secretsSynced := func() *corev1.PodCondition {
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, podKey, pod)).To(Succeed())
+		for i := range pod.Status.Conditions {
+			if pod.Status.Conditions[i].Type == controller.PodConditionSecretsSynced {
+				return &pod.Status.Conditions[i]
+			}
+		}
+		return nil
+	}
+
+	reconcilePod := func() {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: podKey})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(operatorsv1.AddToScheme(scheme)).To(Succeed())
+
+		bwSecret = &operatorsv1.BitwardenSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bw-secret", Namespace: namespace},
+			Spec:       operatorsv1.BitwardenSecretSpec{SecretName: "synced"},
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: podKey.Name, Namespace: namespace},
+			Spec: corev1.PodSpec{
+				ReadinessGates: []corev1.PodReadinessGate{{ConditionType: controller.PodConditionSecretsSynced}},
+				Containers: []corev1.Container{{Name: "app", Image: "app", Env: []corev1.EnvVar{{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "synced"}, Key: "password"},
+				}}}}},
+			},
+			Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.ContainersReady, Status: corev1.ConditionTrue}}},
+		}
+
+		k8sClient = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(bwSecret, pod).
+			WithStatusSubresource(&operatorsv1.BitwardenSecret{}, &corev1.Pod{}).
+			Build()
+		reconciler = &controller.PodReadinessReconciler{Client: k8sClient}
+	})
+
+	It("should hold pods back until their BitwardenSecrets are synced", func() {
+		reconcilePod()
+		condition := secretsSynced()
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Message).To(ContainSubstring("bw-secret"))
+
+		apimeta.SetStatusCondition(&bwSecret.Status.Conditions, metav1.Condition{Type: "SuccessfulSync", Status: metav1.ConditionTrue, Reason: "ReconciliationComplete"})
+		Expect(k8sClient.Status().Update(ctx, bwSecret)).To(Succeed())
+
+		reconcilePod()
+		condition = secretsSynced()
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(controller.ReasonSecretsSynced))
+
+		pod := &corev1.Pod{}
+		Expect(k8sClient.Get(ctx, podKey, pod)).To(Succeed())
+		Expect(pod.Status.Conditions).To(ContainElement(HaveField("Type", corev1.ContainersReady)))
+	})
+
+	It("should stop waiting for deleted BitwardenSecrets", func() {
+		reconcilePod()
+		Expect(secretsSynced().Status).To(Equal(corev1.ConditionFalse))
+
+		Expect(k8sClient.Delete(ctx, bwSecret)).To(Succeed())
+
+		reconcilePod()
+		Expect(secretsSynced().Status).To(Equal(corev1.ConditionTrue))
+	})
+
+	It("should find the BitwardenSecrets a pod spec references", func() {
+		other := operatorsv1.BitwardenSecret{ObjectMeta: metav1.ObjectMeta{Name: "other"}, Spec: operatorsv1.BitwardenSecretSpec{SecretName: "other"}}
+		versioned := operatorsv1.BitwardenSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "versioned"},
+			Spec:       operatorsv1.BitwardenSecretSpec{SecretName: "app"},
+			Status:     operatorsv1.BitwardenSecretStatus{CurrentSecretName: "app-0123456789"},
+		}
+		spec := &corev1.PodSpec{Volumes: []corev1.Volume{
+			{Name: "synced", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "synced"}}},
+			{Name: "versioned", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "app-0123456789"}}},
+		}}
+
+		referenced := controller.ReferencedBitwardenSecrets(spec, []operatorsv1.BitwardenSecret{*bwSecret, other, versioned})
+		Expect(referenced).To(HaveLen(2))
+		Expect(referenced[0].Name).To(Equal("bw-secret"))
+		Expect(referenced[1].Name).To(Equal("versioned"))
+	})
+})
@@ -0,0 +1,105 @@
+package controller_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+var _ = Describe("Readiness Check Tests", func() {
+	var (
+		status   atomic.Int32
+		requests atomic.Int32
+		server   *httptest.Server
+		probeReq *http.Request
+	)
+
+	BeforeEach(func() {
+		status.Store(http.StatusOK)
+		requests.Store(0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if r.URL.Path != "/api/alive" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(int(status.Load()))
+		}))
+		DeferCleanup(server.Close)
+
+		probeReq = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	})
+
+	It("should pass while the endpoint is alive", func() {
+		checker := controller.NewEndpointChecker(server.URL+"/api/", time.Second, 0)
+		Expect(checker.Check(probeReq)).To(Succeed())
+
+		// Client errors show that the endpoint is reachable
+		status.Store(http.StatusNotFound)
+		Expect(checker.Check(probeReq)).To(Succeed())
+	})
+
+	It("should fail on server errors and unreachable endpoints", func() {
+		status.Store(http.StatusServiceUnavailable)
+		Expect(controller.NewEndpointChecker(server.URL+"/api", time.Second, 0).Check(probeReq)).To(MatchError(ContainSubstring("503")))
+
+		unreachable := httptest.NewServer(http.NotFoundHandler())
+		unreachable.Close()
+		Expect(controller.NewEndpointChecker(unreachable.URL, time.Second, 0).Check(probeReq)).To(MatchError(ContainSubstring("not reachable")))
+	})
+
+	It("should report the outcome of background checks as a metric", func() {
+		checker := controller.NewEndpointChecker(server.URL+"/api", time.Second, 50*time.Millisecond)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- checker.Start(ctx)
+		}()
+		DeferCleanup(func() {
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		reachable := func() float64 {
+			families, err := metrics.Registry.Gather()
+			Expect(err).NotTo(HaveOccurred())
+			for _, family := range families {
+				if family.GetName() != "bitwarden_endpoint_reachable" {
+					continue
+				}
+				for _, metric := range family.GetMetric() {
+					if metric.GetLabel()[0].GetValue() == checker.URL {
+						return metric.GetGauge().GetValue()
+					}
+				}
+			}
+			return -1
+		}
+
+		Eventually(reachable).Should(Equal(1.0))
+		status.Store(http.StatusServiceUnavailable)
+		Eventually(reachable).Should(Equal(0.0))
+		Expect(checker.Check(probeReq)).To(MatchError(ContainSubstring("503")))
+	})
+
+	It("should reuse the outcome of a check until it expires", func() {
+		checker := controller.NewEndpointChecker(server.URL+"/api", time.Second, 200*time.Millisecond)
+
+		Expect(checker.Check(probeReq)).To(Succeed())
+		status.Store(http.StatusBadGateway)
+		Expect(checker.Check(probeReq)).To(Succeed())
+		Expect(requests.Load()).To(Equal(int32(1)))
+
+		Eventually(func() error { return checker.Check(probeReq) }).Should(HaveOccurred())
+		Expect(requests.Load()).To(Equal(int32(2)))
+	})
+})
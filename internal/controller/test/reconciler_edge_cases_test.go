@@ -65,7 +65,7 @@ var _ = Describe("BitwardenSecret Reconciler - Edge Case Tests", Ordered, func()
 
 		// Verify reconciliation succeeded
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		Eventually(func(g Gomega) {
 
@@ -124,7 +124,7 @@ var _ = Describe("BitwardenSecret Reconciler - Edge Case Tests", Ordered, func()
 
 		// Verify reconciliation succeeded
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		Eventually(func(g Gomega) {
 
@@ -205,7 +205,7 @@ var _ = Describe("BitwardenSecret Reconciler - Edge Case Tests", Ordered, func()
 
 		// Verify reconciliation succeeded
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		// Verify created Kubernetes secret
 		createdTargetSecret := &corev1.Secret{}
@@ -357,7 +357,7 @@ var _ = Describe("BitwardenSecret Reconciler - Edge Case Tests", Ordered, func()
 
 		// Verify reconciliation succeeded
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		Eventually(func(g Gomega) {
 			// Verify created Kubernetes secret
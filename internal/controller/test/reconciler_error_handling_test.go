@@ -14,7 +14,9 @@ import (
 
 	"k8s.io/apimachinery/pkg/types"
 
+	sdk "github.com/bitwarden/sdk-go/v2"
 	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
 	mocks "github.com/bitwarden/sm-kubernetes/internal/controller/test/mocks"
 	"github.com/bitwarden/sm-kubernetes/internal/controller/test/testutils"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -81,7 +83,8 @@ var _ = Describe("BitwardenSecret Reconciler - Error Handling Tests", Ordered, f
 		Expect(err).To(HaveOccurred())
 		Expect(errors.IsNotFound(err)).To(BeFalse())
 		Expect(err.Error()).To(ContainSubstring("API server error"))
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		// No status can be recorded without the BitwardenSecret, so the default rate limiter retries
+		Expect(result.RequeueAfter).To(BeZero())
 	})
 
 	It("should handle a missing auth token secret", func() {
@@ -95,7 +98,8 @@ var _ = Describe("BitwardenSecret Reconciler - Error Handling Tests", Ordered, f
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
 		Expect(err).To(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		// Auth errors are retried once the auth token secret changes
+		Expect(result.RequeueAfter).To(BeZero())
 	})
 
 	It("should handle an invalid auth token secret key", func() {
@@ -112,7 +116,8 @@ var _ = Describe("BitwardenSecret Reconciler - Error Handling Tests", Ordered, f
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
 		Expect(err).To(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		// Auth errors are retried once the auth token secret changes
+		Expect(result.RequeueAfter).To(BeZero())
 
 		Eventually(func(g Gomega) {
 			// Verify FailedSync condition
@@ -137,8 +142,9 @@ var _ = Describe("BitwardenSecret Reconciler - Error Handling Tests", Ordered, f
 		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
-		Expect(err).To(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second))
 
 		Eventually(func(g Gomega) {
 			// Verify FailedSync condition
@@ -149,4 +155,79 @@ var _ = Describe("BitwardenSecret Reconciler - Error Handling Tests", Ordered, f
 			g.Expect(condition.Status).To(Equal(metav1.ConditionFalse))
 		})
 	})
+
+	It("should report a Bitwarden call exceeding its deadline", func() {
+		unblock := make(chan struct{})
+		DeferCleanup(func() { close(unblock) })
+
+		// Expectations are matched in order, so the first sync hangs before the default mocks apply
+		fixture.MockSecrets.EXPECT().
+			Sync(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(string, *time.Time) (*sdk.SecretsSyncResponse, error) {
+				<-unblock
+				return nil, fmt.Errorf("connection closed")
+			}).
+			Times(1)
+		fixture.SetupDefaultCtrlMocks(false, nil)
+		fixture.Reconciler.BitwardenClientFactory = controller.NewTimeoutClientFactory(fixture.MockFactory, 100*time.Millisecond)
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = fixture.CreateBitwardenSecret(testutils.BitwardenSecretName, namespace, fixture.OrgId, testutils.SynchronizedSecretName, testutils.AuthSecretName, testutils.AuthSecretKey, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+
+		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+		Eventually(func(g Gomega) {
+			createdSecret := &operatorsv1.BitwardenSecret{}
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}, createdSecret)).Should(Succeed())
+			condition := apimeta.FindStatusCondition(createdSecret.Status.Conditions, "FailedSync")
+			g.Expect(condition).NotTo(BeNil())
+			g.Expect(condition.Reason).To(Equal(controller.ReasonBitwardenTimeout))
+			g.Expect(createdSecret.Status.Backoff).NotTo(BeNil())
+			g.Expect(createdSecret.Status.Backoff.ErrorClass).To(Equal(string(controller.ErrorClassTransient)))
+		}).Should(Succeed())
+	})
+
+	It("should stop calling an unavailable Bitwarden API", func() {
+		fixture.MockSecrets.EXPECT().Sync(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("503 Service Unavailable")).Times(1)
+		fixture.SetupDefaultCtrlMocks(false, nil)
+		fixture.Reconciler.BitwardenClientFactory = controller.NewCircuitBreakerClientFactory(fixture.MockFactory, 1, time.Minute)
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = fixture.CreateBitwardenSecret(testutils.BitwardenSecretName, namespace, fixture.OrgId, testutils.SynchronizedSecretName, testutils.AuthSecretName, testutils.AuthSecretKey, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+
+		_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			createdSecret := &operatorsv1.BitwardenSecret{}
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}, createdSecret)).Should(Succeed())
+			g.Expect(createdSecret.Status.Backoff).NotTo(BeNil())
+		}).Should(Succeed())
+
+		// The circuit is open, so the retry waits for the next probe without calling the API
+		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Minute, time.Second))
+
+		Eventually(func(g Gomega) {
+			createdSecret := &operatorsv1.BitwardenSecret{}
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}, createdSecret)).Should(Succeed())
+			g.Expect(apimeta.IsStatusConditionTrue(createdSecret.Status.Conditions, controller.ConditionBitwardenUnavailable)).To(BeTrue())
+			condition := apimeta.FindStatusCondition(createdSecret.Status.Conditions, "FailedSync")
+			g.Expect(condition).NotTo(BeNil())
+			g.Expect(condition.Reason).To(Equal(controller.ReasonCircuitOpen))
+		}).Should(Succeed())
+	})
 })
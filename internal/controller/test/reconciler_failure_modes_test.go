@@ -69,8 +69,9 @@ var _ = Describe("BitwardenSecret Reconciler - Failure Mode Tests", Ordered, fun
 		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
-		Expect(err).To(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second))
 
 		Eventually(func(g Gomega) {
 			// Verify no secret was created
@@ -97,6 +98,7 @@ var _ = Describe("BitwardenSecret Reconciler - Failure Mode Tests", Ordered, fun
 		Expect(err).NotTo(HaveOccurred())
 		Expect(bwSecret).NotTo(BeNil())
 
+		var recordedStatus *operatorsv1.BitwardenSecretStatus
 		fixture.WithMockK8sClient(testContext, func(client *mocks.MockClient, statusWriter *mocks.MockStatusWriter) {
 			// // Mock Get for BitwardenSecret
 			client.EXPECT().
@@ -154,16 +156,27 @@ var _ = Describe("BitwardenSecret Reconciler - Failure Mode Tests", Ordered, fun
 
 			statusWriter.EXPECT().
 				Update(gomock.Any(), gomock.AssignableToTypeOf(&operatorsv1.BitwardenSecret{}), gomock.Any()).
-				Return(nil).
+				DoAndReturn(func(_ context.Context, obj any, _ ...any) error {
+					recordedStatus = obj.(*operatorsv1.BitwardenSecret).Status.DeepCopy()
+					return nil
+				}).
 				AnyTimes()
 		})
 
 		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
-		Expect(err).To(HaveOccurred())
-		Expect(err.Error()).To(ContainSubstring("secret creation failed"))
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second))
+
+		Expect(recordedStatus).NotTo(BeNil())
+		condition := apimeta.FindStatusCondition(recordedStatus.Conditions, "FailedSync")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Message).To(ContainSubstring("secret creation failed"))
+		Expect(recordedStatus.Backoff).NotTo(BeNil())
+		Expect(recordedStatus.Backoff.ErrorClass).To(Equal(string(controller.ErrorClassTransient)))
+		Expect(recordedStatus.Backoff.ConsecutiveFailures).To(Equal(int32(1)))
 	})
 
 	It("should handle a secret patch failure", func() {
@@ -188,6 +201,7 @@ var _ = Describe("BitwardenSecret Reconciler - Failure Mode Tests", Ordered, fun
 		}
 		Expect(fixture.K8sClient.Create(fixture.Ctx, existingSecret)).Should(Succeed())
 
+		var recordedStatus *operatorsv1.BitwardenSecretStatus
 		fixture.WithMockK8sClient(testContext, func(client *mocks.MockClient, statusWriter *mocks.MockStatusWriter) {
 			// Mock Get for BitwardenSecret
 			client.EXPECT().
@@ -244,16 +258,27 @@ var _ = Describe("BitwardenSecret Reconciler - Failure Mode Tests", Ordered, fun
 
 			statusWriter.EXPECT().
 				Update(gomock.Any(), gomock.AssignableToTypeOf(&operatorsv1.BitwardenSecret{}), gomock.Any()).
-				Return(nil).
+				DoAndReturn(func(_ context.Context, obj any, _ ...any) error {
+					recordedStatus = obj.(*operatorsv1.BitwardenSecret).Status.DeepCopy()
+					return nil
+				}).
 				AnyTimes()
 		})
 
 		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
-		Expect(err).To(HaveOccurred())
-		Expect(err.Error()).To(ContainSubstring("secret patch failed"))
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second))
+
+		Expect(recordedStatus).NotTo(BeNil())
+		condition := apimeta.FindStatusCondition(recordedStatus.Conditions, "FailedSync")
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Message).To(ContainSubstring("secret patch failed"))
+		Expect(recordedStatus.Backoff).NotTo(BeNil())
+		Expect(recordedStatus.Backoff.ErrorClass).To(Equal(string(controller.ErrorClassTransient)))
+		Expect(recordedStatus.Backoff.ConsecutiveFailures).To(Equal(int32(1)))
 	})
 
 	It("should handle an annotation setting failure", func() {
@@ -294,7 +319,7 @@ var _ = Describe("BitwardenSecret Reconciler - Failure Mode Tests", Ordered, fun
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
 		Expect(err).NotTo(HaveOccurred()) // Annotation failure is logged but doesn't fail reconciliation
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		Eventually(func(g Gomega) {
 			// Verify SuccessfulSync condition (sync completes despite annotation failure)
@@ -371,9 +396,9 @@ var _ = Describe("BitwardenSecret Reconciler - Failure Mode Tests", Ordered, fun
 		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
 
-		// Verify reconciliation returns conflict error and requeues
+		// Verify reconciliation returns conflict error, which is retried by the default rate limiter
 		Expect(err).To(MatchError(conflictError))
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeZero())
 	})
 
 })
@@ -0,0 +1,118 @@
+package controller_test
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller/test/testutils"
+	"github.com/google/uuid"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("BitwardenSecret Reconciler - Mapped Secrets Tests", Ordered, func() {
+	var (
+		namespace string
+		fixture   testutils.TestFixture
+	)
+
+	BeforeEach(func() {
+		fixture = *testutils.NewTestFixture(testContext, envTestRunner)
+		namespace = fixture.CreateNamespace()
+	})
+
+	AfterAll(func() {
+		fixture.Cancel()
+	})
+
+	AfterEach(func() {
+		fixture.Teardown()
+	})
+
+	It("should only fetch the mapped secrets", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		bwSecret, err := fixture.CreateDefaultBitwardenSecret(namespace, fixture.SecretMap[:3])
+		Expect(err).NotTo(HaveOccurred())
+
+		refresh, smSecrets, missingSecrets, err := fixture.Reconciler.PullMappedSecrets(logf.Log, bwSecret, testutils.AuthSecretValue, time.Time{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refresh).To(BeTrue())
+		Expect(smSecrets).To(HaveLen(3))
+		Expect(missingSecrets).To(BeEmpty())
+	})
+
+	It("should use revision dates to detect changes", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		bwSecret, err := fixture.CreateDefaultBitwardenSecret(namespace, fixture.SecretMap)
+		Expect(err).NotTo(HaveOccurred())
+
+		// The fixture secrets were revised when the fixture was set up
+		refresh, _, _, err := fixture.Reconciler.PullMappedSecrets(logf.Log, bwSecret, testutils.AuthSecretValue, time.Now().Add(time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refresh).To(BeFalse())
+
+		refresh, _, _, err = fixture.Reconciler.PullMappedSecrets(logf.Log, bwSecret, testutils.AuthSecretValue, time.Now().Add(-time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refresh).To(BeTrue())
+	})
+
+	It("should report every missing secret and sync the others", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+
+		missingIds := []string{uuid.NewString(), uuid.NewString()}
+		secretMap := append([]operatorsv1.SecretMap{}, fixture.SecretMap[:2]...)
+		for i, id := range missingIds {
+			secretMap = append(secretMap, operatorsv1.SecretMap{BwSecretId: id, SecretKeyName: fmt.Sprintf("missing_%d", i)})
+		}
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fixture.CreateDefaultBitwardenSecret(namespace, secretMap)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+		_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			createdTargetSecret := &corev1.Secret{}
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.SynchronizedSecretName, Namespace: namespace}, createdTargetSecret)).Should(Succeed())
+			g.Expect(createdTargetSecret.Data).To(HaveLen(2))
+
+			updatedBwSecret := &operatorsv1.BitwardenSecret{}
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}, updatedBwSecret)).Should(Succeed())
+			g.Expect(updatedBwSecret.Status.MissingSecrets).To(HaveLen(2))
+			for i, missing := range updatedBwSecret.Status.MissingSecrets {
+				g.Expect(missing.BwSecretId).To(Equal(missingIds[i]))
+				g.Expect(missing.Reason).NotTo(BeEmpty())
+			}
+		}).Should(Succeed())
+	})
+
+	It("should not call the API when nothing is mapped", func() {
+		// No mocks are set up, so any call to the API fails the test
+
+		bwSecret := &operatorsv1.BitwardenSecret{
+			Spec: operatorsv1.BitwardenSecretSpec{OnlyMappedSecrets: true},
+		}
+
+		refresh, smSecrets, missingSecrets, err := fixture.Reconciler.PullMappedSecrets(logf.Log, bwSecret, testutils.AuthSecretValue, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refresh).To(BeFalse())
+		Expect(smSecrets).To(BeEmpty())
+		Expect(missingSecrets).To(BeEmpty())
+	})
+})
@@ -0,0 +1,147 @@
+package controller_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	"github.com/bitwarden/sm-kubernetes/internal/controller/test/testutils"
+)
+
+var _ = Describe("BitwardenSecret Reconciler - Namespace Policy Tests", Ordered, func() {
+	var (
+		namespace string
+		fixture   testutils.TestFixture
+	)
+
+	BeforeEach(func() {
+		fixture = *testutils.NewTestFixture(testContext, envTestRunner)
+		namespace = fixture.CreateNamespace()
+	})
+
+	AfterAll(func() {
+		fixture.Cancel()
+	})
+
+	AfterEach(func() {
+		fixture.Teardown()
+	})
+
+	// Policies are cluster scoped, so each test selects only its own namespace and removes the policy afterwards
+	createPolicy := func(spec operatorsv1.BitwardenSecretPolicySpec) {
+		spec.NamespaceSelector = metav1.LabelSelector{
+			MatchLabels: map[string]string{"kubernetes.io/metadata.name": namespace},
+		}
+		policy, err := fixture.CreateBitwardenSecretPolicy(namespace, spec)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			Expect(fixture.K8sClient.Delete(fixture.Ctx, policy)).To(Succeed())
+		})
+	}
+
+	expectPolicyViolation := func(message string) {
+		Eventually(func(g Gomega) {
+			updatedBwSecret := &operatorsv1.BitwardenSecret{}
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}, updatedBwSecret)).Should(Succeed())
+			condition := apimeta.FindStatusCondition(updatedBwSecret.Status.Conditions, controller.ConditionPolicyViolation)
+			g.Expect(condition).NotTo(BeNil())
+			g.Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			g.Expect(condition.Message).To(ContainSubstring(message))
+		}).Should(Succeed())
+
+		// Nothing may be written for a BitwardenSecret that violates a policy
+		targetSecret := &corev1.Secret{}
+		err := fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.SynchronizedSecretName, Namespace: namespace}, targetSecret)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	}
+
+	It("should sync when the BitwardenSecret complies with the policy", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+		createPolicy(operatorsv1.BitwardenSecretPolicySpec{
+			AllowedOrganizationIds:    []string{fixture.OrgId},
+			AllowedSecretNamePatterns: []string{"bitwarden-*"},
+			MaxKeys:                   ptr.To[int32](testutils.ExpectedNumOfSecrets),
+		})
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fixture.CreateDefaultBitwardenSecret(namespace, fixture.SecretMap)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+		_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			createdTargetSecret := &corev1.Secret{}
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.SynchronizedSecretName, Namespace: namespace}, createdTargetSecret)).Should(Succeed())
+			g.Expect(len(createdTargetSecret.Data)).To(Equal(testutils.ExpectedNumOfSecrets))
+		}).Should(Succeed())
+	})
+
+	It("should reject a disallowed organization", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+		createPolicy(operatorsv1.BitwardenSecretPolicySpec{
+			AllowedOrganizationIds: []string{"00000000-0000-0000-0000-000000000000"},
+		})
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fixture.CreateDefaultBitwardenSecret(namespace, fixture.SecretMap)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).To(HaveOccurred())
+		// Policy violations are retried once the BitwardenSecret or a policy changes
+		Expect(result.RequeueAfter).To(BeZero())
+
+		expectPolicyViolation("does not allow organization " + fixture.OrgId)
+	})
+
+	It("should reject secrets from disallowed projects", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+		createPolicy(operatorsv1.BitwardenSecretPolicySpec{
+			AllowedProjectIds: []string{"00000000-0000-0000-0000-000000000000"},
+		})
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fixture.CreateDefaultBitwardenSecret(namespace, fixture.SecretMap)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+		_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).To(HaveOccurred())
+
+		expectPolicyViolation("does not allow secret " + fixture.SecretMap[0].BwSecretId)
+	})
+
+	It("should reject a rendered secret with too many keys", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+		createPolicy(operatorsv1.BitwardenSecretPolicySpec{
+			MaxKeys: ptr.To[int32](testutils.ExpectedNumOfSecrets - 1),
+		})
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		// Without a map every accessible secret is synced, so the key count is only known after the pull
+		_, err = fixture.CreateBitwardenSecret(testutils.BitwardenSecretName, namespace, fixture.OrgId, testutils.SynchronizedSecretName, testutils.AuthSecretName, testutils.AuthSecretKey, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+		_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).To(HaveOccurred())
+
+		expectPolicyViolation("allows at most 9 keys")
+	})
+})
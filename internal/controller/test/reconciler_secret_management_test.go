@@ -1,6 +1,7 @@
 package controller_test
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,6 +10,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -17,6 +19,7 @@ import (
 	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
 	"github.com/bitwarden/sm-kubernetes/internal/controller"
 	"github.com/bitwarden/sm-kubernetes/internal/controller/test/testutils"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	//+kubebuilder:scaffold:imports
 )
@@ -54,13 +57,14 @@ var _ = Describe("BitwardenSecret Reconciler - Secret Management Tests", Ordered
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		Eventually(func(g Gomega) {
 			// Verify created secret
 			createdTargetSecret := &corev1.Secret{}
 			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.SynchronizedSecretName, Namespace: namespace}, createdTargetSecret)).Should(Succeed())
 			g.Expect(createdTargetSecret.Labels[controller.LabelBwSecret]).To(Equal(string(bwSecret.UID)))
+			g.Expect(createdTargetSecret.Labels[controller.LabelSecretRole]).To(Equal(controller.SecretRoleSynced))
 			g.Expect(createdTargetSecret.Type).To(Equal(corev1.SecretTypeOpaque))
 			g.Expect(len(createdTargetSecret.Data)).To(Equal(testutils.ExpectedNumOfSecrets)) // From bwSecretsResponse
 
@@ -73,6 +77,138 @@ var _ = Describe("BitwardenSecret Reconciler - Secret Management Tests", Ordered
 		})
 	})
 
+	It("should not rewrite a secret whose data is unchanged", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fixture.CreateDefaultBitwardenSecret(namespace, fixture.SecretMap)
+		Expect(err).NotTo(HaveOccurred())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+		_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		syncedSecret := &corev1.Secret{}
+		bwSecret := &operatorsv1.BitwardenSecret{}
+		Eventually(func(g Gomega) {
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.SynchronizedSecretName, Namespace: namespace}, syncedSecret)).Should(Succeed())
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, req.NamespacedName, bwSecret)).Should(Succeed())
+			g.Expect(bwSecret.Status.LastCheckedTime).NotTo(BeNil())
+		}).Should(Succeed())
+		firstCheck := bwSecret.Status.LastCheckedTime.Time
+
+		// Sync everything again, as if another secret of the organization had changed
+		bwSecret.Status.LastSuccessfulSyncTime = metav1.Time{}
+		Expect(fixture.K8sClient.Status().Update(fixture.Ctx, bwSecret)).To(Succeed())
+		Eventually(func(g Gomega) {
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, req.NamespacedName, bwSecret)).Should(Succeed())
+			g.Expect(bwSecret.Status.LastSuccessfulSyncTime.IsZero()).To(BeTrue())
+		}).Should(Succeed())
+
+		_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, req.NamespacedName, bwSecret)).Should(Succeed())
+			g.Expect(bwSecret.Status.LastCheckedTime.Time).To(BeTemporally(">", firstCheck))
+
+			unchangedSecret := &corev1.Secret{}
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.SynchronizedSecretName, Namespace: namespace}, unchangedSecret)).Should(Succeed())
+			g.Expect(unchangedSecret.ResourceVersion).To(Equal(syncedSecret.ResourceVersion))
+			g.Expect(unchangedSecret.Annotations[controller.AnnotationSyncTime]).To(Equal(syncedSecret.Annotations[controller.AnnotationSyncTime]))
+		}).Should(Succeed())
+	})
+
+	It("should keep injected data out of Kubernetes secrets", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+		fixture.Reconciler.Delivered = controller.NewDeliveryCache()
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+		bwSecret, err := fixture.CreateDefaultBitwardenSecret(namespace, fixture.SecretMap)
+		Expect(err).NotTo(HaveOccurred())
+		bwSecret.Spec.Delivery = operatorsv1.DeliveryInject
+		Expect(fixture.K8sClient.Update(fixture.Ctx, bwSecret)).To(Succeed())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+		_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		data, ok := fixture.Reconciler.Delivered.Get(bwSecret)
+		Expect(ok).To(BeTrue())
+		Expect(data).NotTo(BeEmpty())
+
+		Consistently(func(g Gomega) {
+			secret := &corev1.Secret{}
+			err := fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.SynchronizedSecretName, Namespace: namespace}, secret)
+			g.Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		}, "1s").Should(Succeed())
+	})
+
+	It("should write versioned immutable secrets and prune old versions", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		bwSecret, err := fixture.CreateDefaultBitwardenSecret(namespace, fixture.SecretMap)
+		Expect(err).NotTo(HaveOccurred())
+		bwSecret.Spec.Versioning = &operatorsv1.SecretVersioning{RevisionHistoryLimit: 1}
+		Expect(fixture.K8sClient.Update(fixture.Ctx, bwSecret)).To(Succeed())
+
+		// Previous versions, the older of which exceeds the revision history limit
+		for i, age := range []time.Duration{2 * time.Hour, time.Hour} {
+			previous := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("%s-previous-%d", testutils.SynchronizedSecretName, i),
+					Namespace: namespace,
+					Labels: map[string]string{
+						controller.LabelBwSecret:      string(bwSecret.UID),
+						controller.LabelSecretRole:    controller.SecretRoleSynced,
+						controller.LabelSecretVersion: fmt.Sprintf("previous%d", i),
+					},
+					Annotations: map[string]string{controller.AnnotationSyncTime: time.Now().Add(-age).UTC().Format(time.RFC3339Nano)},
+				},
+				Data: map[string][]byte{"version": []byte(fmt.Sprint(i))},
+			}
+			Expect(fixture.K8sClient.Create(fixture.Ctx, previous)).To(Succeed())
+		}
+		Eventually(func(g Gomega) {
+			secrets := &corev1.SecretList{}
+			g.Expect(fixture.K8sClient.List(fixture.Ctx, secrets, client.InNamespace(namespace), client.HasLabels{controller.LabelSecretVersion})).To(Succeed())
+			g.Expect(secrets.Items).To(HaveLen(2))
+		}).Should(Succeed())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+		_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func(g Gomega) {
+			updatedBwSecret := &operatorsv1.BitwardenSecret{}
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, req.NamespacedName, updatedBwSecret)).Should(Succeed())
+			current := updatedBwSecret.Status.CurrentSecretName
+			g.Expect(current).To(HavePrefix(testutils.SynchronizedSecretName + "-"))
+			g.Expect(updatedBwSecret.Annotations).To(HaveKeyWithValue(controller.AnnotationCurrentSecret, current))
+
+			currentSecret := &corev1.Secret{}
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: current, Namespace: namespace}, currentSecret)).Should(Succeed())
+			g.Expect(currentSecret.Immutable).To(HaveValue(BeTrue()))
+			g.Expect(currentSecret.Data).To(HaveLen(testutils.ExpectedNumOfSecrets))
+
+			// The secret named secretName is not written in versioned mode
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.SynchronizedSecretName, Namespace: namespace}, &corev1.Secret{})).NotTo(Succeed())
+
+			secrets := &corev1.SecretList{}
+			g.Expect(fixture.K8sClient.List(fixture.Ctx, secrets, client.InNamespace(namespace), client.HasLabels{controller.LabelSecretVersion})).To(Succeed())
+			var names []string
+			for _, secret := range secrets.Items {
+				names = append(names, secret.Name)
+			}
+			g.Expect(names).To(ConsistOf(current, testutils.SynchronizedSecretName+"-previous-1"))
+		}).Should(Succeed())
+	})
+
 	It("should update an existing Kubernetes secret", func() {
 		fixture.SetupDefaultCtrlMocks(false, nil)
 
@@ -99,7 +235,7 @@ var _ = Describe("BitwardenSecret Reconciler - Secret Management Tests", Ordered
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		Eventually(func(g Gomega) {
 			// Verify updated secret
@@ -138,7 +274,7 @@ var _ = Describe("BitwardenSecret Reconciler - Secret Management Tests", Ordered
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		Eventually(func(g Gomega) {
 			// Verify created secret
@@ -198,7 +334,7 @@ var _ = Describe("BitwardenSecret Reconciler - Secret Management Tests", Ordered
 
 		// Verify reconciliation succeeded and requeue is set
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		// Verify created Kubernetes secret
 		createdTargetSecret := &corev1.Secret{}
@@ -230,6 +366,44 @@ var _ = Describe("BitwardenSecret Reconciler - Secret Management Tests", Ordered
 		})
 	})
 
+	It("should create typed secrets with the keys their type requires", func() {
+		fixture.SetupDefaultCtrlMocks(false, nil)
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		// The API server rejects a kubernetes.io/tls secret that is created without its certificate and key
+		bwSecret := &operatorsv1.BitwardenSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: testutils.BitwardenSecretName, Namespace: namespace},
+			Spec: operatorsv1.BitwardenSecretSpec{
+				AuthToken:      operatorsv1.AuthToken{SecretName: testutils.AuthSecretName, SecretKey: testutils.AuthSecretKey},
+				SecretName:     testutils.SynchronizedSecretName,
+				OrganizationId: fixture.OrgId,
+				SecretType:     corev1.SecretTypeTLS,
+				SecretMap: []operatorsv1.SecretMap{
+					{BwSecretId: fixture.SecretMap[0].BwSecretId, SecretKeyName: corev1.TLSCertKey},
+					{BwSecretId: fixture.SecretMap[1].BwSecretId, SecretKeyName: corev1.TLSPrivateKeyKey},
+				},
+				OnlyMappedSecrets: true,
+			},
+		}
+		Expect(fixture.K8sClient.Create(fixture.Ctx, bwSecret)).To(Succeed())
+
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
+		Eventually(func(g Gomega) {
+			g.Expect(fixture.K8sClient.Get(fixture.Ctx, req.NamespacedName, &operatorsv1.BitwardenSecret{})).Should(Succeed())
+		}).Should(Succeed())
+		_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		createdTargetSecret := &corev1.Secret{}
+		Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: testutils.SynchronizedSecretName, Namespace: namespace}, createdTargetSecret)).Should(Succeed())
+		Expect(createdTargetSecret.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(createdTargetSecret.Data).To(HaveKey(corev1.TLSCertKey))
+		Expect(createdTargetSecret.Data).To(HaveKey(corev1.TLSPrivateKeyKey))
+		Expect(createdTargetSecret.Data).To(HaveLen(2))
+	})
+
 	It("should create empty secret when OnlyMappedSecrets is true and fixture.SecretMap is empty", func() {
 		// Configure mocks with successful Bitwarden API response
 		fixture.SetupDefaultCtrlMocks(false, nil)
@@ -247,7 +421,7 @@ var _ = Describe("BitwardenSecret Reconciler - Secret Management Tests", Ordered
 
 		// Verify reconciliation succeeded and requeue is set
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		// Verify created Kubernetes secret
 		createdTargetSecret := &corev1.Secret{}
@@ -54,7 +54,7 @@ var _ = Describe("BitwardenSecret Reconciler - Success Tests", Ordered, func() {
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		Eventually(func(g Gomega) {
 			// Verify created secret
@@ -128,7 +128,8 @@ var _ = Describe("BitwardenSecret Reconciler - Success Tests", Ordered, func() {
 		_, err := fixture.CreateDefaultAuthSecret(namespace)
 		Expect(err).NotTo(HaveOccurred())
 
-		bwSecret, err := fixture.CreateDefaultBitwardenSecret(namespace, fixture.SecretMap)
+		// Changes are only reported by Sync when all accessible secrets are synced
+		bwSecret, err := fixture.CreateBitwardenSecret(testutils.BitwardenSecretName, namespace, fixture.OrgId, testutils.SynchronizedSecretName, testutils.AuthSecretName, testutils.AuthSecretKey, fixture.SecretMap, false)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(bwSecret).NotTo(BeNil())
 
@@ -136,7 +137,7 @@ var _ = Describe("BitwardenSecret Reconciler - Success Tests", Ordered, func() {
 
 		result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(result.RequeueAfter).To(Equal(time.Duration(fixture.Reconciler.RefreshIntervalSeconds) * time.Second))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second, time.Duration(fixture.Reconciler.RefreshIntervalSeconds)*time.Second/2))
 
 		Eventually(func(g Gomega) {
 			// Verify no SuccessfulSync condition (no sync occurred)
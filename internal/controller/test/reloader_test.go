@@ -0,0 +1,123 @@
+package controller_test
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+var _ = Describe("Reloader Tests", func() {
+	const namespace = "default"
+
+	var (
+		ctx       context.Context
+		k8sClient client.Client
+		recorder  *events.FakeRecorder
+		reloader  *controller.Reloader
+		bwSecret  *operatorsv1.BitwardenSecret
+		secret    *corev1.Secret
+	)
+
+	podSpec := func(container corev1.Container, volumes ...corev1.Volume) corev1.PodTemplateSpec {
+		container.Name = "app"
+		container.Image = "app"
+		return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{container}, Volumes: volumes}}
+	}
+
+	templateAnnotations := func(obj client.Object) map[string]string {
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: obj.GetName(), Namespace: namespace}, obj)).To(Succeed())
+		switch w := obj.(type) {
+		case *appsv1.Deployment:
+			return w.Spec.Template.Annotations
+		case *appsv1.StatefulSet:
+			return w.Spec.Template.Annotations
+		case *appsv1.DaemonSet:
+			return w.Spec.Template.Annotations
+		}
+		return nil
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		bwSecret = &operatorsv1.BitwardenSecret{ObjectMeta: metav1.ObjectMeta{Name: "bw-secret", Namespace: namespace}}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "synced", Namespace: namespace},
+			Data:       map[string][]byte{"password": []byte("new")},
+		}
+
+		envFrom := podSpec(corev1.Container{EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "synced"}}}}})
+		volume := podSpec(corev1.Container{}, corev1.Volume{Name: "secret", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "synced"}}})
+		unrelated := podSpec(corev1.Container{Env: []corev1.EnvVar{{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "other"}, Key: "token"},
+		}}}})
+
+		k8sClient = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "env-from", Namespace: namespace}, Spec: appsv1.DeploymentSpec{Template: envFrom}},
+			&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "volume", Namespace: namespace}, Spec: appsv1.StatefulSetSpec{Template: volume}},
+			&appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "annotated", Namespace: namespace, Annotations: map[string]string{controller.AnnotationReload: "other, synced"}},
+				Spec:       appsv1.DaemonSetSpec{Template: unrelated},
+			},
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: namespace}, Spec: appsv1.DeploymentSpec{Template: unrelated}},
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "other-namespace", Namespace: "other"}, Spec: appsv1.DeploymentSpec{Template: envFrom}},
+		).Build()
+		recorder = events.NewFakeRecorder(10)
+		reloader = &controller.Reloader{Client: k8sClient, Reader: k8sClient, Recorder: recorder}
+	})
+
+	It("should hash every key and value", func() {
+		hash := controller.SecretContentHash(map[string][]byte{"a": []byte("bc")})
+		Expect(controller.SecretContentHash(map[string][]byte{"a": []byte("bc")})).To(Equal(hash))
+		Expect(controller.SecretContentHash(map[string][]byte{"ab": []byte("c")})).NotTo(Equal(hash))
+		Expect(controller.SecretContentHash(map[string][]byte{"a": []byte("bd")})).NotTo(Equal(hash))
+		Expect(controller.SecretContentHash(map[string][]byte{"a": []byte("bc"), "b": nil})).NotTo(Equal(hash))
+	})
+
+	It("should name the hash annotation after the secret", func() {
+		Expect(controller.SecretHashAnnotation("synced")).To(Equal("secret-hash.k8s.bitwarden.com/synced"))
+
+		long := controller.SecretHashAnnotation(strings.Repeat("a", 100))
+		Expect(strings.TrimPrefix(long, controller.AnnotationSecretHashPrefix)).To(HaveLen(63))
+		Expect(controller.SecretHashAnnotation(strings.Repeat("a", 101))).NotTo(Equal(long))
+	})
+
+	It("should restart the workloads consuming the secret once", func() {
+		restarted, err := reloader.Reload(ctx, bwSecret, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restarted).To(ConsistOf("Deployment/env-from", "StatefulSet/volume", "DaemonSet/annotated"))
+
+		hash := controller.SecretContentHash(secret.Data)
+		annotation := controller.SecretHashAnnotation("synced")
+		Expect(templateAnnotations(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "env-from"}})).To(HaveKeyWithValue(annotation, hash))
+		Expect(templateAnnotations(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "volume"}})).To(HaveKeyWithValue(annotation, hash))
+		Expect(templateAnnotations(&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "annotated"}})).To(HaveKeyWithValue(annotation, hash))
+		Expect(templateAnnotations(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "unrelated"}})).NotTo(HaveKey(annotation))
+
+		Expect(recorder.Events).To(HaveLen(4))
+		Eventually(recorder.Events).Should(Receive(ContainSubstring(controller.ReasonWorkloadRestarted)))
+
+		// Workloads that already run with the current data are not restarted again
+		restarted, err = reloader.Reload(ctx, bwSecret, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restarted).To(BeEmpty())
+
+		secret.Data["password"] = []byte("newer")
+		restarted, err = reloader.Reload(ctx, bwSecret, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restarted).To(HaveLen(3))
+	})
+})
@@ -0,0 +1,61 @@
+package controller_test
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+var _ = Describe("Sync Schedule Tests", func() {
+	const interval = 5 * time.Minute
+
+	lastSync := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	It("should schedule the next sync deterministically", func() {
+		uid := types.UID("6b1e3c3e-7d5c-4b1e-9a57-0c4f6f0d1a2b")
+
+		next := controller.NextSyncTime(uid, interval, lastSync)
+		Expect(controller.NextSyncTime(uid, interval, lastSync)).To(Equal(next))
+		Expect(next.Sub(lastSync)).To(BeNumerically(">=", interval/2))
+		Expect(next.Sub(lastSync)).To(BeNumerically("<", interval*3/2))
+
+		// The offset within the interval is kept from one sync to the next
+		Expect(controller.NextSyncTime(uid, interval, next)).To(Equal(next.Add(interval)))
+	})
+
+	It("should spread syncs across the refresh interval", func() {
+		buckets := map[int]int{}
+		for i := 0; i < 500; i++ {
+			next := controller.NextSyncTime(types.UID(fmt.Sprintf("uid-%d", i)), interval, lastSync)
+			buckets[int(next.Sub(lastSync)/(interval/10))]++
+		}
+
+		// Ten buckets of a tenth of the interval each, from half an interval to one and a half intervals
+		Expect(buckets).To(HaveLen(10))
+		for bucket := 5; bucket < 15; bucket++ {
+			Expect(buckets[bucket]).To(BeNumerically(">", 20), fmt.Sprintf("bucket %d", bucket))
+		}
+	})
+
+	It("should back off reconcile retries up to the maximum delay", func() {
+		limiter := controller.NewReconcileRateLimiter(10 * time.Second)
+		req := reconcile.Request{NamespacedName: types.NamespacedName{Name: "secret", Namespace: "default"}}
+
+		Expect(limiter.When(req)).To(Equal(time.Second))
+		Expect(limiter.When(req)).To(Equal(2 * time.Second))
+		for i := 0; i < 5; i++ {
+			limiter.When(req)
+		}
+		Expect(limiter.When(req)).To(Equal(10 * time.Second))
+
+		limiter.Forget(req)
+		Expect(limiter.When(req)).To(Equal(time.Second))
+	})
+})
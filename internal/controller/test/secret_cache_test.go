@@ -0,0 +1,83 @@
+package controller_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	mocks "github.com/bitwarden/sm-kubernetes/internal/controller/test/mocks"
+)
+
+var _ = Describe("Secret Cache Tests", func() {
+	var (
+		cached    *mocks.MockClient
+		apiReader *mocks.MockClient
+		key       types.NamespacedName
+	)
+
+	BeforeEach(func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		cached = mocks.NewMockClient(mockCtrl)
+		apiReader = mocks.NewMockClient(mockCtrl)
+		key = types.NamespacedName{Name: "auth-token", Namespace: "default"}
+	})
+
+	It("should only cache secrets labelled for it", func() {
+		selector := controller.CachedSecretSelector()
+		Expect(selector.Matches(labels.Set{controller.LabelSecretRole: controller.SecretRoleSynced})).To(BeTrue())
+		Expect(selector.Matches(labels.Set{controller.LabelSecretRole: controller.SecretRoleAuthToken})).To(BeTrue())
+		Expect(selector.Matches(labels.Set{controller.LabelSecretRole: controller.SecretRolePushSource})).To(BeTrue())
+		Expect(selector.Matches(labels.Set{controller.LabelSecretRole: "other"})).To(BeFalse())
+		Expect(selector.Matches(labels.Set{"owner": "helm"})).To(BeFalse())
+
+		options := controller.CacheOptions(nil)
+		Expect(options.ByObject).To(HaveLen(1))
+		Expect(options.DefaultNamespaces).To(BeEmpty())
+		Expect(options.DefaultTransform).NotTo(BeNil())
+
+		stripped, err := options.DefaultTransform(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stripped.(*corev1.Secret).ManagedFields).To(BeNil())
+
+		Expect(controller.CacheOptions([]string{"team-a", "team-b"}).DefaultNamespaces).To(HaveKey("team-b"))
+	})
+
+	It("should read secrets that are not cached through the API reader", func() {
+		notFound := k8serrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, key.Name)
+		cached.EXPECT().Get(gomock.Any(), key, gomock.Any()).Return(notFound)
+		apiReader.EXPECT().Get(gomock.Any(), key, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ types.NamespacedName, obj client.Object, _ ...client.GetOption) error {
+				obj.(*corev1.Secret).Data = map[string][]byte{"token": []byte("value")}
+				return nil
+			})
+
+		secret := &corev1.Secret{}
+		Expect(controller.GetSecret(context.Background(), cached, apiReader, key, secret)).To(Succeed())
+		Expect(secret.Data).To(HaveKeyWithValue("token", []byte("value")))
+	})
+
+	It("should not call the API reader for cached secrets or other errors", func() {
+		cached.EXPECT().Get(gomock.Any(), key, gomock.Any()).Return(nil)
+		Expect(controller.GetSecret(context.Background(), cached, apiReader, key, &corev1.Secret{})).To(Succeed())
+
+		cached.EXPECT().Get(gomock.Any(), key, gomock.Any()).Return(k8serrors.NewServiceUnavailable("down"))
+		Expect(controller.GetSecret(context.Background(), cached, apiReader, key, &corev1.Secret{})).To(MatchError(ContainSubstring("down")))
+
+		notFound := k8serrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, key.Name)
+		cached.EXPECT().Get(gomock.Any(), key, gomock.Any()).Return(notFound)
+		Expect(k8serrors.IsNotFound(controller.GetSecret(context.Background(), cached, nil, key, &corev1.Secret{}))).To(BeTrue())
+	})
+})
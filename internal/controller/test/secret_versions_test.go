@@ -0,0 +1,114 @@
+package controller_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+var _ = Describe("Secret Version Tests", func() {
+	It("should name versions after the hash of their data", func() {
+		data := map[string][]byte{"password": []byte("one")}
+		name := controller.VersionedSecretName("app", data)
+		Expect(name).To(MatchRegexp(`^app-[0-9a-f]{10}$`))
+		Expect(controller.VersionedSecretName("app", map[string][]byte{"password": []byte("one")})).To(Equal(name))
+		Expect(controller.VersionedSecretName("app", map[string][]byte{"password": []byte("two")})).NotTo(Equal(name))
+	})
+
+	It("should truncate long names to a valid secret name", func() {
+		data := map[string][]byte{"password": []byte("one")}
+		for _, secretName := range []string{strings.Repeat("a", 253), strings.Repeat("a", 241) + ".b", strings.Repeat("a", 240) + "-.b"} {
+			name := controller.VersionedSecretName(secretName, data)
+			Expect(validation.IsDNS1123Subdomain(name)).To(BeEmpty(), name)
+			Expect(name).To(HaveSuffix("-" + controller.VersionedSecretName("", data)[1:]))
+		}
+		Expect(controller.VersionedSecretName(strings.Repeat("a", 253), map[string][]byte{"password": []byte("two")})).
+			NotTo(Equal(controller.VersionedSecretName(strings.Repeat("a", 253), data)))
+	})
+
+	It("should check the name patterns of policies against the names of the versions", func() {
+		policies := []operatorsv1.BitwardenSecretPolicy{{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+			Spec:       operatorsv1.BitwardenSecretPolicySpec{AllowedSecretNamePatterns: []string{"app-*"}},
+		}}
+		bwSecret := &operatorsv1.BitwardenSecret{Spec: operatorsv1.BitwardenSecretSpec{SecretName: "app"}}
+		Expect(controller.CheckSpecPolicies(policies, bwSecret)).To(ConsistOf(ContainSubstring("does not allow secret name app ")))
+
+		bwSecret.Spec.Versioning = &operatorsv1.SecretVersioning{}
+		Expect(controller.CheckSpecPolicies(policies, bwSecret)).To(BeEmpty())
+
+		versionName := controller.VersionedSecretName("app", map[string][]byte{"password": []byte("one")})
+		Expect(controller.CheckSecretNamePolicies(policies, versionName)).To(BeEmpty())
+		Expect(controller.CheckSecretNamePolicies(policies, "other-"+versionName[len("app-"):])).To(HaveLen(1))
+	})
+
+	It("should build immutable versions", func() {
+		bwSecret := &operatorsv1.BitwardenSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bw-secret", Namespace: "default", UID: types.UID("uid")},
+			Spec:       operatorsv1.BitwardenSecretSpec{SecretName: "app", SecretType: "kubernetes.io/basic-auth"},
+		}
+		data := map[string][]byte{"password": []byte("one")}
+
+		secret := controller.CreateVersionedK8sSecret(bwSecret, data)
+		Expect(secret.Name).To(Equal(controller.VersionedSecretName("app", data)))
+		Expect(secret.Namespace).To(Equal("default"))
+		Expect(secret.Immutable).To(HaveValue(BeTrue()))
+		Expect(secret.Type).To(BeEquivalentTo("kubernetes.io/basic-auth"))
+		Expect(secret.Data).To(Equal(data))
+		Expect(secret.Labels).To(HaveKeyWithValue(controller.LabelBwSecret, "uid"))
+		Expect(secret.Labels).To(HaveKeyWithValue(controller.LabelSecretRole, controller.SecretRoleSynced))
+		Expect(secret.Labels).To(HaveKeyWithValue(controller.LabelSecretVersion, secret.Name[len("app-"):]))
+	})
+
+	It("should create typed secrets with their data", func() {
+		bwSecret := &operatorsv1.BitwardenSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bw-secret", Namespace: "default"},
+			Spec:       operatorsv1.BitwardenSecretSpec{SecretName: "app-tls", SecretType: corev1.SecretTypeTLS},
+		}
+		data := map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")}
+
+		secret := controller.CreateK8sSecret(bwSecret, data)
+		Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(secret.Data).To(Equal(data))
+
+		bwSecret.Spec.SecretType = ""
+		secret = controller.CreateK8sSecret(bwSecret, nil)
+		Expect(secret.Type).To(Equal(corev1.SecretTypeOpaque))
+		Expect(secret.Data).To(BeEmpty())
+	})
+
+	It("should only consider secrets with other data, labels or annotations changed", func() {
+		original := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      map[string]string{controller.LabelBwSecret: "uid"},
+				Annotations: map[string]string{controller.AnnotationSyncTime: "2026-01-01T00:00:00Z"},
+			},
+			Data: map[string][]byte{"password": []byte("one")},
+		}
+
+		desired := original.DeepCopy()
+		desired.Annotations[controller.AnnotationSyncTime] = "2026-01-02T00:00:00Z"
+		Expect(controller.SecretUnchanged(original, desired)).To(BeTrue())
+
+		changed := desired.DeepCopy()
+		changed.Data["password"] = []byte("two")
+		Expect(controller.SecretUnchanged(original, changed)).To(BeFalse())
+
+		changed = desired.DeepCopy()
+		changed.Labels[controller.LabelSecretRole] = controller.SecretRoleSynced
+		Expect(controller.SecretUnchanged(original, changed)).To(BeFalse())
+
+		changed = desired.DeepCopy()
+		changed.Annotations[controller.AnnotationCustomMap] = "[]"
+		Expect(controller.SecretUnchanged(original, changed)).To(BeFalse())
+	})
+})
@@ -0,0 +1,144 @@
+package controller_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+var _ = Describe("Shard Manager Tests", func() {
+	const shards = 8
+
+	var (
+		ctx       context.Context
+		k8sClient client.Client
+		mu        sync.Mutex
+		acquired  map[string][]int
+	)
+
+	acquiredBy := func(identity string) func() []int {
+		return func() []int {
+			mu.Lock()
+			defer mu.Unlock()
+			return slices.Clone(acquired[identity])
+		}
+	}
+
+	newShardManager := func(identity string) *controller.ShardManager {
+		m := controller.NewShardManager(k8sClient, k8sClient, "sm-operator-system", "test", identity, shards)
+		m.LeaseDuration = time.Second
+		m.OnAcquire = func(_ context.Context, shard int) {
+			mu.Lock()
+			defer mu.Unlock()
+			acquired[identity] = append(acquired[identity], shard)
+		}
+		return m
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		k8sClient = fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+		acquired = map[string][]int{}
+	})
+
+	It("should assign every BitwardenSecret to a stable shard", func() {
+		for range 100 {
+			uid := types.UID(uuid.NewString())
+			shard := controller.ShardFor(uid, shards)
+			Expect(shard).To(BeNumerically(">=", 0))
+			Expect(shard).To(BeNumerically("<", shards))
+			Expect(controller.ShardFor(uid, shards)).To(Equal(shard))
+		}
+	})
+
+	It("should own every BitwardenSecret without sharding", func() {
+		var m *controller.ShardManager
+		Expect(m.Owns(types.UID(uuid.NewString()))).To(BeTrue())
+	})
+
+	It("should hold every shard as the only replica", func() {
+		m := newShardManager("a")
+		Expect(m.Owns(types.UID(uuid.NewString()))).To(BeFalse())
+
+		m.Sync(ctx)
+		Expect(m.HeldShards()).To(HaveLen(shards))
+		Expect(m.Owns(types.UID(uuid.NewString()))).To(BeTrue())
+		Eventually(acquiredBy("a")).Should(HaveLen(shards))
+
+		// Renewing does not acquire the shards again
+		m.Sync(ctx)
+		Consistently(acquiredBy("a")).WithTimeout(100 * time.Millisecond).Should(HaveLen(shards))
+	})
+
+	It("should rebalance the shards when a replica joins and leaves", func() {
+		a := newShardManager("a")
+		b := newShardManager("b")
+		a.Sync(ctx)
+
+		// The shards assigned to b are still held by a
+		b.Sync(ctx)
+		Expect(b.HeldShards()).To(BeEmpty())
+
+		a.Sync(ctx)
+		b.Sync(ctx)
+		Expect(a.HeldShards()).NotTo(BeEmpty())
+		Expect(b.HeldShards()).NotTo(BeEmpty())
+		Expect(append(a.HeldShards(), b.HeldShards()...)).To(ConsistOf(0, 1, 2, 3, 4, 5, 6, 7))
+		Eventually(acquiredBy("b")).Should(ConsistOf(b.HeldShards()))
+
+		for range 100 {
+			uid := types.UID(uuid.NewString())
+			Expect(a.Owns(uid)).NotTo(Equal(b.Owns(uid)))
+		}
+
+		b.Release(ctx)
+		Expect(b.HeldShards()).To(BeEmpty())
+		a.Sync(ctx)
+		Expect(a.HeldShards()).To(HaveLen(shards))
+	})
+
+	It("should take over the shards of a replica that stopped renewing", func() {
+		a := newShardManager("a")
+		b := newShardManager("b")
+		a.Sync(ctx)
+		Expect(a.HeldShards()).To(HaveLen(shards))
+
+		Eventually(func(g Gomega) {
+			b.Sync(ctx)
+			g.Expect(b.HeldShards()).To(HaveLen(shards))
+		}).WithTimeout(5 * time.Second).WithPolling(200 * time.Millisecond).Should(Succeed())
+
+		// a stops syncing its shards once their leases would have expired
+		Expect(a.HeldShards()).To(BeEmpty())
+	})
+
+	It("should renew the leases while a shard is still being handed to the controller", func() {
+		m := newShardManager("a")
+		unblock := make(chan struct{})
+		defer close(unblock)
+		m.OnAcquire = func(_ context.Context, _ int) {
+			<-unblock
+		}
+
+		synced := make(chan struct{})
+		go func() {
+			defer close(synced)
+			m.Sync(ctx)
+			m.Sync(ctx)
+		}()
+		Eventually(synced).Should(BeClosed())
+		Expect(m.HeldShards()).To(HaveLen(shards))
+	})
+})
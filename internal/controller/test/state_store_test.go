@@ -0,0 +1,207 @@
+package controller_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+var _ = Describe("SDK State Store Tests", func() {
+	const (
+		firstToken  = "0.first-machine-account-token"
+		secondToken = "0.second-machine-account-token"
+	)
+
+	It("should give every token its own state file", func() {
+		store, err := controller.NewStateStore(GinkgoT().TempDir(), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		firstPath, releaseFirst, err := store.Acquire(firstToken)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(releaseFirst()).To(Succeed())
+
+		secondPath, releaseSecond, err := store.Acquire(secondToken)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(releaseSecond()).To(Succeed())
+
+		Expect(firstPath).To(Equal(filepath.Join(store.Dir, controller.HashAuthToken(firstToken))))
+		Expect(secondPath).NotTo(Equal(firstPath))
+		Expect(firstPath).NotTo(ContainSubstring(firstToken))
+	})
+
+	It("should keep encrypted state only in encrypted form", func() {
+		store, err := controller.NewStateStore(GinkgoT().TempDir(), []byte("0123456789abcdef0123456789abcdef"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Encrypted()).To(BeTrue())
+
+		statePath, release, err := store.Acquire(firstToken)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Dir(statePath)).NotTo(Equal(store.Dir))
+		Expect(os.WriteFile(statePath, []byte("sdk session state"), 0o600)).To(Succeed())
+		Expect(release()).To(Succeed())
+
+		// The plain state is removed once the session is released
+		_, err = os.Stat(statePath)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		encrypted, err := os.ReadFile(filepath.Join(store.Dir, controller.HashAuthToken(firstToken)+".enc"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(encrypted)).NotTo(ContainSubstring("sdk session state"))
+
+		// The next session for the same token gets the decrypted state back
+		statePath, release, err = store.Acquire(firstToken)
+		Expect(err).NotTo(HaveOccurred())
+		state, err := os.ReadFile(statePath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(state)).To(Equal("sdk session state"))
+		Expect(release()).To(Succeed())
+	})
+
+	It("should fail to decrypt state with a different key", func() {
+		dir := GinkgoT().TempDir()
+		store, err := controller.NewStateStore(dir, []byte("0123456789abcdef0123456789abcdef"))
+		Expect(err).NotTo(HaveOccurred())
+
+		statePath, release, err := store.Acquire(firstToken)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(statePath, []byte("sdk session state"), 0o600)).To(Succeed())
+		Expect(release()).To(Succeed())
+
+		otherStore, err := controller.NewStateStore(dir, []byte("fedcba9876543210fedcba9876543210"))
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = otherStore.Acquire(firstToken)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject short encryption keys", func() {
+		_, err := controller.NewStateStore(GinkgoT().TempDir(), []byte("too-short"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should only remove state of unreferenced tokens", func() {
+		store, err := controller.NewStateStore(GinkgoT().TempDir(), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, token := range []string{firstToken, secondToken} {
+			statePath, release, err := store.Acquire(token)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(statePath, []byte("sdk session state"), 0o600)).To(Succeed())
+			Expect(release()).To(Succeed())
+		}
+
+		// Files not written by the store are left alone
+		unrelated := filepath.Join(store.Dir, "unrelated")
+		Expect(os.WriteFile(unrelated, []byte("keep"), 0o600)).To(Succeed())
+
+		referenced := map[string]bool{controller.HashAuthToken(firstToken): true}
+
+		// Recently written state is kept
+		removed, err := store.Remove(referenced, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(BeEmpty())
+
+		removed, err = store.Remove(referenced, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(ConsistOf(controller.HashAuthToken(secondToken)))
+
+		Expect(filepath.Join(store.Dir, controller.HashAuthToken(firstToken))).To(BeAnExistingFile())
+		Expect(filepath.Join(store.Dir, controller.HashAuthToken(secondToken))).NotTo(BeAnExistingFile())
+		Expect(unrelated).To(BeAnExistingFile())
+	})
+
+	Describe("State Janitor", func() {
+		const (
+			namespace   = "default"
+			unusedToken = "0.unused-machine-account-token"
+		)
+
+		var (
+			store        *controller.StateStore
+			authToken    operatorsv1.AuthToken
+			authK8sToken *corev1.Secret
+		)
+
+		writeState := func(tokens ...string) {
+			for _, token := range tokens {
+				statePath, release, err := store.Acquire(token)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(statePath, []byte("sdk session state"), 0o600)).To(Succeed())
+				Expect(release()).To(Succeed())
+			}
+		}
+
+		cleanup := func(objects ...client.Object) {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			Expect(operatorsv1.AddToScheme(scheme)).To(Succeed())
+			janitor := &controller.StateJanitor{
+				Client:     fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(objects, authK8sToken)...).Build(),
+				StateStore: store,
+			}
+			janitor.Cleanup(context.Background())
+		}
+
+		BeforeEach(func() {
+			var err error
+			store, err = controller.NewStateStore(GinkgoT().TempDir(), nil)
+			Expect(err).NotTo(HaveOccurred())
+			authToken = operatorsv1.AuthToken{SecretName: "bw-auth-token", SecretKey: "token"}
+			authK8sToken = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "bw-auth-token", Namespace: namespace},
+				Data:       map[string][]byte{"token": []byte(firstToken)},
+			}
+			writeState(firstToken, unusedToken)
+		})
+
+		It("should keep the state of tokens only used by a BitwardenPushSecret", func() {
+			cleanup(&operatorsv1.BitwardenPushSecret{
+				ObjectMeta: metav1.ObjectMeta{Name: "push", Namespace: namespace},
+				Spec:       operatorsv1.BitwardenPushSecretSpec{AuthToken: authToken},
+			})
+
+			Expect(filepath.Join(store.Dir, controller.HashAuthToken(firstToken))).To(BeAnExistingFile())
+			Expect(filepath.Join(store.Dir, controller.HashAuthToken(unusedToken))).NotTo(BeAnExistingFile())
+		})
+
+		It("should keep the state of tokens only used by a BitwardenGeneratedSecret", func() {
+			cleanup(&operatorsv1.BitwardenGeneratedSecret{
+				ObjectMeta: metav1.ObjectMeta{Name: "generated", Namespace: namespace},
+				Spec:       operatorsv1.BitwardenGeneratedSecretSpec{AuthToken: authToken},
+			})
+
+			Expect(filepath.Join(store.Dir, controller.HashAuthToken(firstToken))).To(BeAnExistingFile())
+			Expect(filepath.Join(store.Dir, controller.HashAuthToken(unusedToken))).NotTo(BeAnExistingFile())
+		})
+
+		It("should remove the state of tokens that were not used recently without a client", func() {
+			janitor := &controller.StateJanitor{StateStore: store, UnusedTTL: 50 * time.Millisecond}
+
+			janitor.Cleanup(context.Background())
+			Expect(filepath.Join(store.Dir, controller.HashAuthToken(unusedToken))).To(BeAnExistingFile())
+
+			time.Sleep(100 * time.Millisecond)
+			writeState(firstToken)
+			// Keep the file of the used token old enough to be removed if it were not recently used
+			old := time.Now().Add(-time.Hour)
+			Expect(os.Chtimes(filepath.Join(store.Dir, controller.HashAuthToken(firstToken)), old, old)).To(Succeed())
+			janitor.Cleanup(context.Background())
+
+			Expect(filepath.Join(store.Dir, controller.HashAuthToken(firstToken))).To(BeAnExistingFile())
+			Expect(filepath.Join(store.Dir, controller.HashAuthToken(unusedToken))).NotTo(BeAnExistingFile())
+		})
+	})
+})
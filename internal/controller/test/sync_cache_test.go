@@ -0,0 +1,250 @@
+package controller_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	mocks "github.com/bitwarden/sm-kubernetes/internal/controller/test/mocks"
+	"github.com/bitwarden/sm-kubernetes/internal/controller/test/testutils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Sync Cache Tests", func() {
+	const (
+		orgId     = "a08a8157-129e-4002-bab4-b118014ca9c7"
+		authToken = "0.machine-account-token"
+	)
+
+	var fetches atomic.Int32
+
+	fetch := func() (*sdk.SecretsSyncResponse, error) {
+		fetches.Add(1)
+		return &sdk.SecretsSyncResponse{HasChanges: true}, nil
+	}
+
+	BeforeEach(func() {
+		fetches.Store(0)
+	})
+
+	It("should serve repeated syncs from the cache", func() {
+		cache := controller.NewSyncCache(time.Minute)
+
+		for range 3 {
+			response, err := cache.Sync(orgId, authToken, fetch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.HasChanges).To(BeTrue())
+		}
+
+		Expect(fetches.Load()).To(Equal(int32(1)))
+	})
+
+	It("should keep separate entries per organization and token", func() {
+		cache := controller.NewSyncCache(time.Minute)
+
+		_, err := cache.Sync(orgId, authToken, fetch)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cache.Sync(orgId, "0.other-token", fetch)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cache.Sync("other-org", authToken, fetch)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fetches.Load()).To(Equal(int32(3)))
+	})
+
+	It("should sync again once the entry has expired", func() {
+		cache := controller.NewSyncCache(10 * time.Millisecond)
+
+		_, err := cache.Sync(orgId, authToken, fetch)
+		Expect(err).NotTo(HaveOccurred())
+		time.Sleep(50 * time.Millisecond)
+		_, err = cache.Sync(orgId, authToken, fetch)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fetches.Load()).To(Equal(int32(2)))
+	})
+
+	It("should not cache errors", func() {
+		cache := controller.NewSyncCache(time.Minute)
+
+		_, err := cache.Sync(orgId, authToken, func() (*sdk.SecretsSyncResponse, error) {
+			return nil, fmt.Errorf("bitwarden api error")
+		})
+		Expect(err).To(HaveOccurred())
+
+		_, err = cache.Sync(orgId, authToken, fetch)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetches.Load()).To(Equal(int32(1)))
+	})
+
+	It("should coalesce concurrent syncs into one call", func() {
+		cache := controller.NewSyncCache(time.Minute)
+		release := make(chan struct{})
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				_, err := cache.Sync(orgId, authToken, func() (*sdk.SecretsSyncResponse, error) {
+					<-release
+					return fetch()
+				})
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		Expect(fetches.Load()).To(Equal(int32(1)))
+	})
+
+	It("should track when secrets were added or removed", func() {
+		cache := controller.NewSyncCache(10 * time.Millisecond)
+		secretIds := []string{"db-password", "api-key"}
+		fetchIds := func() (*sdk.SecretsSyncResponse, error) {
+			response := &sdk.SecretsSyncResponse{HasChanges: true}
+			for _, id := range secretIds {
+				response.Secrets = append(response.Secrets, sdk.SecretResponse{ID: id})
+			}
+			return response, nil
+		}
+
+		beforeFirstSync := time.Now()
+		Expect(cache.SecretsChangedSince(orgId, authToken, beforeFirstSync)).To(BeTrue())
+
+		_, err := cache.Sync(orgId, authToken, fetchIds)
+		Expect(err).NotTo(HaveOccurred())
+		afterFirstSync := time.Now()
+		Expect(cache.SecretsChangedSince(orgId, authToken, afterFirstSync)).To(BeFalse())
+		// Nothing is known from before the first sync
+		Expect(cache.SecretsChangedSince(orgId, authToken, beforeFirstSync.Add(-time.Minute))).To(BeTrue())
+
+		// The same secrets in a different order are no change
+		secretIds = []string{"api-key", "db-password"}
+		time.Sleep(20 * time.Millisecond)
+		_, err = cache.Sync(orgId, authToken, fetchIds)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cache.SecretsChangedSince(orgId, authToken, afterFirstSync)).To(BeFalse())
+
+		secretIds = []string{"api-key"}
+		time.Sleep(20 * time.Millisecond)
+		_, err = cache.Sync(orgId, authToken, fetchIds)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cache.SecretsChangedSince(orgId, authToken, afterFirstSync)).To(BeTrue())
+		Expect(cache.SecretsChangedSince(orgId, authToken, time.Now())).To(BeFalse())
+	})
+
+	It("should only report changes since the last sync of each BitwardenSecret", func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		mockFactory := mocks.NewMockBitwardenClientFactory(mockCtrl)
+		mockClient := mocks.NewMockBitwardenClientInterface(mockCtrl)
+		mockSecrets := mocks.NewMockSecretsInterface(mockCtrl)
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil).AnyTimes()
+		mockClient.EXPECT().AccessTokenLogin(authToken, gomock.Any()).Return(nil).AnyTimes()
+		mockClient.EXPECT().Secrets().Return(mockSecrets).AnyTimes()
+		mockClient.EXPECT().Close().AnyTimes()
+
+		revised := time.Now().UTC().Add(-time.Hour)
+		mockSecrets.EXPECT().Sync(orgId, nil).Return(&sdk.SecretsSyncResponse{
+			HasChanges: true,
+			Secrets:    []sdk.SecretResponse{{ID: "db-password", RevisionDate: revised}},
+		}, nil).Times(2)
+
+		stateStore, err := controller.NewStateStore(GinkgoT().TempDir(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		puller := &controller.SecretPuller{
+			BitwardenClientFactory: mockFactory,
+			StateStore:             stateStore,
+			SyncCache:              controller.NewSyncCache(10 * time.Millisecond),
+		}
+
+		// A BitwardenSecret that was never synced gets every secret
+		refresh, smSecrets, err := puller.PullSecretManagerSecretDeltas(GinkgoLogr, orgId, authToken, time.Time{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refresh).To(BeTrue())
+		Expect(smSecrets).To(HaveLen(1))
+
+		// One synced before the secret was revised is refreshed from the cached sync
+		refresh, _, err = puller.PullSecretManagerSecretDeltas(GinkgoLogr, orgId, authToken, revised.Add(-time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refresh).To(BeTrue())
+
+		// One synced since is not, as long as no secrets were added or removed since its last sync
+		time.Sleep(20 * time.Millisecond)
+		refresh, _, err = puller.PullSecretManagerSecretDeltas(GinkgoLogr, orgId, authToken, time.Now().UTC())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refresh).To(BeFalse())
+	})
+})
+
+var _ = Describe("BitwardenSecret Reconciler - Sync Cache Tests", Ordered, func() {
+	var (
+		namespace string
+		fixture   testutils.TestFixture
+	)
+
+	BeforeEach(func() {
+		fixture = *testutils.NewTestFixture(testContext, envTestRunner)
+		namespace = fixture.CreateNamespace()
+	})
+
+	AfterAll(func() {
+		fixture.Cancel()
+	})
+
+	AfterEach(func() {
+		fixture.Teardown()
+	})
+
+	It("should sync once for BitwardenSecrets sharing a token and organization", func() {
+		fixture.Reconciler.SyncCache = controller.NewSyncCache(time.Minute)
+
+		fixture.MockFactory.EXPECT().GetApiUrl().Return("http://api.bitwarden.com").AnyTimes()
+		fixture.MockFactory.EXPECT().GetIdentityApiUrl().Return("http://identity.bitwarden.com").AnyTimes()
+		fixture.MockFactory.EXPECT().GetBitwardenClient().Return(fixture.MockClient, nil).Times(1)
+		fixture.MockClient.EXPECT().AccessTokenLogin(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		fixture.MockClient.EXPECT().Secrets().Return(fixture.MockSecrets).Times(1)
+		fixture.MockClient.EXPECT().Close().Times(1)
+
+		fixture.MockSecrets.EXPECT().Sync(fixture.OrgId, nil).Return(&sdk.SecretsSyncResponse{
+			HasChanges: true,
+			Secrets: []sdk.SecretResponse{
+				{ID: fixture.SecretMap[0].BwSecretId, Key: "secret_0", Value: "value_0", OrganizationID: fixture.OrgId},
+			},
+		}, nil).Times(1)
+
+		_, err := fixture.CreateDefaultAuthSecret(namespace)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, name := range []string{"bw-secret-1", "bw-secret-2"} {
+			_, err = fixture.CreateBitwardenSecret(name, namespace, fixture.OrgId, name+"-k8s", testutils.AuthSecretName, testutils.AuthSecretKey, fixture.SecretMap, true)
+			Expect(err).NotTo(HaveOccurred())
+
+			req := reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}
+			_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Eventually(func(g Gomega) {
+			for _, name := range []string{"bw-secret-1-k8s", "bw-secret-2-k8s"} {
+				createdTargetSecret := &corev1.Secret{}
+				g.Expect(fixture.K8sClient.Get(fixture.Ctx, types.NamespacedName{Name: name, Namespace: namespace}, createdTargetSecret)).Should(Succeed())
+				g.Expect(createdTargetSecret.Data).To(HaveKeyWithValue(fixture.SecretMap[0].SecretKeyName, []byte("value_0")))
+			}
+		}).Should(Succeed())
+	})
+})
@@ -4,6 +4,7 @@ package testutils
 import (
 	"context"
 	"fmt"
+	"slices"
 	"testing"
 	"time"
 
@@ -42,6 +43,7 @@ type TestFixture struct {
 	Cancel          context.CancelFunc
 	Namespace       string
 	StatePath       string
+	StateStore      *controller.StateStore
 	RefreshInterval int
 	SecretMap       []operatorsv1.SecretMap
 }
@@ -65,6 +67,8 @@ func (f *TestFixture) WithMockK8sClient(t *testing.T, configureMocks func(client
 	mockK8sClient := mocks.NewMockClient(mockCtrl)
 	mockStatusWriter := mocks.NewMockStatusWriter(mockCtrl)
 	mockK8sClient.EXPECT().Status().Return(mockStatusWriter).AnyTimes()
+	// No BitwardenSecretPolicies exist unless a test configures them
+	mockK8sClient.EXPECT().List(gomock.Any(), gomock.AssignableToTypeOf(&operatorsv1.BitwardenSecretPolicyList{}), gomock.Any()).Return(nil).AnyTimes()
 	configureMocks(mockK8sClient, mockStatusWriter)
 	f.Reconciler.Client = mockK8sClient
 	f.MockCtrl = mockCtrl
@@ -112,11 +116,15 @@ func (f *TestFixture) setup(t *testing.T, runner *EnvTestRunner) {
 	// Setup context
 	f.Ctx, f.Cancel = context.WithCancel(context.TODO())
 
+	stateStore, err := controller.NewStateStore(f.StatePath, nil)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	f.StateStore = stateStore
+
 	f.Reconciler = controller.BitwardenSecretReconciler{
 		Client:                  runner.Client,
 		Scheme:                  runner.Manager.GetScheme(),
 		RefreshIntervalSeconds:  f.RefreshInterval,
-		StatePath:               f.StatePath,
+		StateStore:              f.StateStore,
 		SetK8sSecretAnnotations: controller.SetK8sSecretAnnotations,
 	}
 
@@ -152,12 +160,33 @@ func (f *TestFixture) SetupDefaultCtrlMocks(failing bool, syncResponse *sdk.Secr
 			Sync(gomock.Any(), gomock.Any()).
 			Return(nil, fmt.Errorf("bitwarden api error")).
 			AnyTimes()
+
+		f.MockSecrets.
+			EXPECT().
+			GetByIDS(gomock.Any()).
+			Return(nil, fmt.Errorf("bitwarden api error")).
+			AnyTimes()
 	} else {
 		f.MockSecrets.
 			EXPECT().
 			Sync(gomock.Any(), gomock.Any()).
 			Return(response, nil).
 			AnyTimes()
+
+		// Only the requested secrets contained in the sync response are returned
+		f.MockSecrets.
+			EXPECT().
+			GetByIDS(gomock.Any()).
+			DoAndReturn(func(secretIds []string) (*sdk.SecretsResponse, error) {
+				secrets := []sdk.SecretResponse{}
+				for _, secret := range response.Secrets {
+					if slices.Contains(secretIds, secret.ID) {
+						secrets = append(secrets, secret)
+					}
+				}
+				return &sdk.SecretsResponse{Data: secrets}, nil
+			}).
+			AnyTimes()
 	}
 
 	f.MockClient.
@@ -193,6 +222,7 @@ func (f *TestFixture) CreateAuthSecret(name, namespace, key, value string) (*cor
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: namespace,
+			Labels:    map[string]string{controller.LabelSecretRole: controller.SecretRoleAuthToken},
 		},
 		Data: map[string][]byte{
 			key: []byte(value),
@@ -284,6 +314,28 @@ func (f *TestFixture) CreateSynchronizedSecret(name string, namespace string, da
 
 	return secret, nil
 }
+func (f *TestFixture) CreateBitwardenSecretPolicy(name string, spec operatorsv1.BitwardenSecretPolicySpec) (*operatorsv1.BitwardenSecretPolicy, error) {
+	policy := &operatorsv1.BitwardenSecretPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: spec,
+	}
+	err := f.K8sClient.Create(f.Ctx, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait for the policy to be available in the cache
+	gomega.Eventually(func(g gomega.Gomega) {
+		fetched := &operatorsv1.BitwardenSecretPolicy{}
+		err := f.K8sClient.Get(f.Ctx, types.NamespacedName{Name: name}, fetched)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+	}).WithTimeout(10 * time.Second).WithPolling(100 * time.Millisecond).Should(gomega.Succeed())
+
+	return policy, nil
+}
+
 func (f *TestFixture) CreateNamespace() string {
 	f.Namespace = fmt.Sprintf("bitwarden-ns-%s", uuid.NewString())
 	ns := corev1.Namespace{
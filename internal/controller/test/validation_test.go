@@ -11,6 +11,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -346,10 +347,19 @@ var _ = Describe("Secret Name Validation Tests", Ordered, func() {
 
 			// Trigger reconciliation - should fail due to K8s-invalid name
 			req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
-			_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
-			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("Secret key names invalid for Kubernetes"))
-			Expect(err.Error()).To(ContainSubstring("This is an invalid keyname"))
+			result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			// Key names come from Secrets Manager and may be fixed there, so the sync is retried
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			updatedBwSecret := &operatorsv1.BitwardenSecret{}
+			Expect(fixture.K8sClient.Get(fixture.Ctx, req.NamespacedName, updatedBwSecret)).To(Succeed())
+			condition := apimeta.FindStatusCondition(updatedBwSecret.Status.Conditions, "FailedSync")
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Message).To(ContainSubstring("Secret key names invalid for Kubernetes"))
+			Expect(condition.Message).To(ContainSubstring("This is an invalid keyname"))
+			Expect(updatedBwSecret.Status.Backoff).NotTo(BeNil())
+			Expect(updatedBwSecret.Status.Backoff.ErrorClass).To(Equal(string(controller.ErrorClassTransient)))
 		})
 
 		It("should fail with duplicate secret names", func() {
@@ -412,10 +422,19 @@ var _ = Describe("Secret Name Validation Tests", Ordered, func() {
 
 			// Trigger reconciliation - should fail
 			req := reconcile.Request{NamespacedName: types.NamespacedName{Name: testutils.BitwardenSecretName, Namespace: namespace}}
-			_, err = fixture.Reconciler.Reconcile(fixture.Ctx, req)
-			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("Duplicate secret key names detected"))
-			Expect(err.Error()).To(ContainSubstring("DUPLICATE_NAME"))
+			result, err := fixture.Reconciler.Reconcile(fixture.Ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			// Key names come from Secrets Manager and may be fixed there, so the sync is retried
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			updatedBwSecret := &operatorsv1.BitwardenSecret{}
+			Expect(fixture.K8sClient.Get(fixture.Ctx, req.NamespacedName, updatedBwSecret)).To(Succeed())
+			condition := apimeta.FindStatusCondition(updatedBwSecret.Status.Conditions, "FailedSync")
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Message).To(ContainSubstring("Duplicate secret key names detected"))
+			Expect(condition.Message).To(ContainSubstring("DUPLICATE_NAME"))
+			Expect(updatedBwSecret.Status.Backoff).NotTo(BeNil())
+			Expect(updatedBwSecret.Status.Backoff.ErrorClass).To(Equal(string(controller.ErrorClassTransient)))
 		})
 	})
 
@@ -0,0 +1,269 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+// Package csi runs the operator as a provider of the Secrets Store CSI driver, which mounts the secrets of
+// SecretProviderClasses into pods as files.
+package csi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	providerv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+	"sigs.k8s.io/yaml"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+const (
+	// Name of the provider in SecretProviderClasses, which is also the name of its socket
+	ProviderName = "bitwarden"
+	// Version of the provider API
+	APIVersion = "v1alpha1"
+
+	// Parameters of SecretProviderClasses, named after the fields of BitwardenSecrets they stand for
+	ParameterOrganizationId    = "organizationId"
+	ParameterMap               = "map"
+	ParameterOnlyMappedSecrets = "onlyMappedSecrets"
+	ParameterUseSecretNames    = "useSecretNames"
+	// Key of the node publish secret holding the machine account token
+	ParameterAuthTokenKey = "authTokenKey"
+	DefaultAuthTokenKey   = "token"
+
+	// Parameters of other providers that are not supported. They are rejected rather than ignored, since a
+	// volume mounted without them would hold other secrets than the ones asked for.
+	ParameterObjects         = "objects"
+	ParameterBitwardenSecret = "bitwardenSecret"
+
+	// Attributes the driver adds to the parameters
+	attributePodNamespace        = "csi.storage.k8s.io/pod.namespace"
+	attributePodName             = "csi.storage.k8s.io/pod.name"
+	attributeSecretProviderClass = "secretProviderClass"
+)
+
+var csilog = logf.Log.WithName("csi-provider")
+
+// Provider mounts the secrets of Secrets Manager into the volumes of the Secrets Store CSI driver.
+//
+// The parameters of a SecretProviderClass describe the secrets like a BitwardenSecret does, and are rendered
+// with the same logic, so that a map and the onlyMappedSecrets and useSecretNames options give the same keys
+// as file names that they give as keys of a synced secret. The machine account token is read from the node
+// publish secret of the volume.
+type Provider struct {
+	providerv1alpha1.UnimplementedCSIDriverProviderServer
+
+	Puller *controller.SecretPuller
+}
+
+// Version reports the API version of the provider.
+func (p *Provider) Version(ctx context.Context, req *providerv1alpha1.VersionRequest) (*providerv1alpha1.VersionResponse, error) {
+	runtimeVersion := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		runtimeVersion = info.Main.Version
+	}
+	return &providerv1alpha1.VersionResponse{Version: APIVersion, RuntimeName: "sm-operator", RuntimeVersion: runtimeVersion}, nil
+}
+
+// Mount returns the files of a volume.
+func (p *Provider) Mount(ctx context.Context, req *providerv1alpha1.MountRequest) (*providerv1alpha1.MountResponse, error) {
+	attributes := map[string]string{}
+	if err := json.Unmarshal([]byte(req.Attributes), &attributes); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid attributes: %v", err)
+	}
+	secrets := map[string]string{}
+	if req.Secrets != "" {
+		if err := json.Unmarshal([]byte(req.Secrets), &secrets); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid node publish secret: %v", err)
+		}
+	}
+	var mode os.FileMode
+	if err := json.Unmarshal([]byte(req.Permission), &mode); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid file permission %q: %v", req.Permission, err)
+	}
+
+	logger := csilog.WithValues(
+		"pod", attributes[attributePodNamespace]+"/"+attributes[attributePodName],
+		"secretProviderClass", attributes[attributeSecretProviderClass])
+
+	bwSecret, err := BitwardenSecretFromParameters(attributes)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	authTokenKey := attributes[ParameterAuthTokenKey]
+	if authTokenKey == "" {
+		authTokenKey = DefaultAuthTokenKey
+	}
+	authToken, ok := secrets[authTokenKey]
+	if !ok || authToken == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "the node publish secret has no %s key holding a machine account token", authTokenKey)
+	}
+
+	data, err := p.render(logger, bwSecret, authToken)
+	if err != nil {
+		logger.Error(err, "Failed to mount secrets")
+		if controller.IsAuthError(err) {
+			return nil, status.Errorf(codes.Unauthenticated, "failed to authenticate with Secrets Manager: %v", err)
+		}
+		return nil, status.Errorf(codes.Unavailable, "failed to get secrets from Secrets Manager: %v", err)
+	}
+
+	response := &providerv1alpha1.MountResponse{}
+	keys := slices.Sorted(maps.Keys(data))
+	for _, key := range keys {
+		response.Files = append(response.Files, &providerv1alpha1.File{Path: key, Mode: int32(mode), Contents: data[key]})
+		hash := sha256.Sum256(data[key])
+		response.ObjectVersion = append(response.ObjectVersion, &providerv1alpha1.ObjectVersion{Id: key, Version: hex.EncodeToString(hash[:8])})
+	}
+	logger.Info("Mounted secrets", "files", len(keys))
+	return response, nil
+}
+
+// render fetches the secrets of a BitwardenSecret and maps them to keys the way they are written to the
+// synced secret.
+func (p *Provider) render(logger logr.Logger, bwSecret *operatorsv1.BitwardenSecret, authToken string) (map[string][]byte, error) {
+	var smSecrets []sdk.SecretResponse
+	var err error
+	if bwSecret.Spec.OnlyMappedSecrets {
+		var missingSecrets []operatorsv1.MissingSecret
+		_, smSecrets, missingSecrets, err = p.Puller.PullMappedSecrets(logger, bwSecret, authToken, time.Time{})
+		if err == nil && len(missingSecrets) > 0 {
+			// A partially mounted volume would only fail the pod later on
+			ids := make([]string, 0, len(missingSecrets))
+			for _, missing := range missingSecrets {
+				ids = append(ids, missing.BwSecretId)
+			}
+			err = fmt.Errorf("mapped secrets do not exist or the machine account has no access to them: %s", strings.Join(ids, ", "))
+		}
+	} else {
+		_, smSecrets, err = p.Puller.PullSecretManagerSecretDeltas(logger, bwSecret.Spec.OrganizationId, authToken, time.Time{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return controller.RenderSecretData(logger, bwSecret, smSecrets)
+}
+
+// BitwardenSecretFromParameters returns the BitwardenSecret the parameters of a SecretProviderClass stand for.
+func BitwardenSecretFromParameters(parameters map[string]string) (*operatorsv1.BitwardenSecret, error) {
+	// Secrets are selected by ID in the map, and named after their secret names with useSecretNames
+	if _, ok := parameters[ParameterObjects]; ok {
+		return nil, fmt.Errorf("the %s parameter is not supported; select secrets by ID with the %s parameter, or mount all secrets of the organization named after their secret names with %s", ParameterObjects, ParameterMap, ParameterUseSecretNames)
+	}
+	// Referencing a BitwardenSecret would need access to the Kubernetes API, which the provider does not have
+	if _, ok := parameters[ParameterBitwardenSecret]; ok {
+		return nil, fmt.Errorf("the %s parameter is not supported; describe the secrets with the parameters of the SecretProviderClass instead", ParameterBitwardenSecret)
+	}
+
+	bwSecret := &operatorsv1.BitwardenSecret{
+		Spec: operatorsv1.BitwardenSecretSpec{
+			OrganizationId:    parameters[ParameterOrganizationId],
+			OnlyMappedSecrets: true,
+		},
+	}
+
+	var err error
+	if value, ok := parameters[ParameterOnlyMappedSecrets]; ok {
+		if bwSecret.Spec.OnlyMappedSecrets, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid %s parameter %q", ParameterOnlyMappedSecrets, value)
+		}
+	}
+	if value, ok := parameters[ParameterUseSecretNames]; ok {
+		if bwSecret.Spec.UseSecretNames, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid %s parameter %q", ParameterUseSecretNames, value)
+		}
+	}
+	if bwSecret.Spec.UseSecretNames && bwSecret.Spec.OnlyMappedSecrets {
+		return nil, errors.New("useSecretNames and onlyMappedSecrets cannot both be enabled; these options are mutually exclusive")
+	}
+	if !bwSecret.Spec.OnlyMappedSecrets && bwSecret.Spec.OrganizationId == "" {
+		return nil, fmt.Errorf("the %s parameter is required unless only mapped secrets are mounted", ParameterOrganizationId)
+	}
+
+	if value := parameters[ParameterMap]; value != "" {
+		if err := yaml.UnmarshalStrict([]byte(value), &bwSecret.Spec.SecretMap); err != nil {
+			return nil, fmt.Errorf("invalid %s parameter: %w", ParameterMap, err)
+		}
+	}
+	for _, mapping := range bwSecret.Spec.SecretMap {
+		if mapping.BwSecretId == "" {
+			return nil, fmt.Errorf("the %s parameter has an entry without bwSecretId", ParameterMap)
+		}
+		// Keys are used as file names
+		if err := controller.ValidateK8sSecretKeyName(mapping.SecretKeyName); err != nil {
+			return nil, fmt.Errorf("invalid %s parameter: %w", ParameterMap, err)
+		}
+		if mapping.SecretKeyName == "." || mapping.SecretKeyName == ".." {
+			return nil, fmt.Errorf("invalid %s parameter: secret key '%s' is not a valid file name", ParameterMap, mapping.SecretKeyName)
+		}
+	}
+	if bwSecret.Spec.OnlyMappedSecrets && len(bwSecret.Spec.SecretMap) == 0 {
+		return nil, fmt.Errorf("the %s parameter is required when only mapped secrets are mounted", ParameterMap)
+	}
+	return bwSecret, nil
+}
+
+// NewServer returns a gRPC server serving the provider API with provider.
+func NewServer(provider providerv1alpha1.CSIDriverProviderServer) *grpc.Server {
+	server := grpc.NewServer()
+	providerv1alpha1.RegisterCSIDriverProviderServer(server, provider)
+	return server
+}
+
+// Serve serves the provider API on a unix socket until the context is done.
+func Serve(ctx context.Context, endpoint string, provider providerv1alpha1.CSIDriverProviderServer) error {
+	// A socket left behind by a previous run would fail the listener
+	if err := os.Remove(endpoint); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove stale socket %s: %w", endpoint, err)
+	}
+	listener, err := net.Listen("unix", endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", endpoint, err)
+	}
+
+	server := NewServer(provider)
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	csilog.Info("Serving the provider API", "endpoint", endpoint)
+	return server.Serve(listener)
+}
@@ -0,0 +1,219 @@
+package csi_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+
+	sdk "github.com/bitwarden/sdk-go/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	providerv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	mocks "github.com/bitwarden/sm-kubernetes/internal/controller/test/mocks"
+	"github.com/bitwarden/sm-kubernetes/internal/csi"
+)
+
+var _ = Describe("CSI Provider", func() {
+	const (
+		orgId     = "3a8c0f8e-5b7e-4c38-9e0a-6c0f3b8e1a2d"
+		dbId      = "9d1e4c6a-2f3b-4a5c-8d7e-1f2a3b4c5d6e"
+		apiKeyId  = "4b5c6d7e-8f9a-4b1c-9d2e-3f4a5b6c7d8e"
+		missingId = "0f1e2d3c-4b5a-4968-8776-655443322110"
+	)
+
+	var (
+		conn        *grpc.ClientConn
+		mockFactory *mocks.MockBitwardenClientFactory
+		mockClient  *mocks.MockBitwardenClientInterface
+		mockSecrets *mocks.MockSecretsInterface
+	)
+
+	secrets := []sdk.SecretResponse{
+		{ID: dbId, Key: "DB_PASSWORD", Value: "hunter2", OrganizationID: orgId},
+		{ID: apiKeyId, Key: "API_KEY", Value: "abc123", OrganizationID: orgId},
+	}
+
+	mount := func(parameters map[string]string, nodePublishSecret map[string]string) (*providerv1alpha1.MountResponse, error) {
+		attributes := map[string]string{
+			"csi.storage.k8s.io/pod.namespace": "team-a",
+			"csi.storage.k8s.io/pod.name":      "app",
+			"secretProviderClass":              "bitwarden",
+		}
+		for key, value := range parameters {
+			attributes[key] = value
+		}
+		attributesJSON, err := json.Marshal(attributes)
+		Expect(err).NotTo(HaveOccurred())
+		secretsJSON, err := json.Marshal(nodePublishSecret)
+		Expect(err).NotTo(HaveOccurred())
+
+		request := &providerv1alpha1.MountRequest{
+			Attributes: string(attributesJSON),
+			Secrets:    string(secretsJSON),
+			TargetPath: "/var/lib/kubelet/pods/app/volumes/secrets",
+			Permission: "420",
+		}
+		return providerv1alpha1.NewCSIDriverProviderClient(conn).Mount(context.Background(), request)
+	}
+
+	files := func(response *providerv1alpha1.MountResponse) map[string]string {
+		contents := map[string]string{}
+		for _, file := range response.Files {
+			Expect(file.Mode).To(Equal(int32(0o644)))
+			contents[file.Path] = string(file.Contents)
+		}
+		return contents
+	}
+
+	token := map[string]string{"token": "machine-account-token"}
+
+	BeforeEach(func() {
+		mockCtrl := gomock.NewController(GinkgoT())
+		mockFactory = mocks.NewMockBitwardenClientFactory(mockCtrl)
+		mockClient = mocks.NewMockBitwardenClientInterface(mockCtrl)
+		mockSecrets = mocks.NewMockSecretsInterface(mockCtrl)
+
+		mockFactory.EXPECT().GetBitwardenClient().Return(mockClient, nil).AnyTimes()
+		mockClient.EXPECT().AccessTokenLogin("machine-account-token", gomock.Any()).Return(nil).AnyTimes()
+		mockClient.EXPECT().Secrets().Return(mockSecrets).AnyTimes()
+		mockClient.EXPECT().Close().AnyTimes()
+		mockSecrets.EXPECT().GetByIDS(gomock.Any()).DoAndReturn(func(ids []string) (*sdk.SecretsResponse, error) {
+			response := &sdk.SecretsResponse{}
+			for _, secret := range secrets {
+				if slices.Contains(ids, secret.ID) {
+					response.Data = append(response.Data, secret)
+				}
+			}
+			return response, nil
+		}).AnyTimes()
+		mockSecrets.EXPECT().Sync(orgId, gomock.Any()).Return(&sdk.SecretsSyncResponse{HasChanges: true, Secrets: secrets}, nil).AnyTimes()
+
+		// Unix socket paths are limited in length, so the socket does not go into the test directory
+		dir, err := os.MkdirTemp("", "csi")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+
+		stateStore, err := controller.NewStateStore(filepath.Join(dir, "state"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		provider := &csi.Provider{
+			Puller: &controller.SecretPuller{BitwardenClientFactory: mockFactory, StateStore: stateStore},
+		}
+
+		endpoint := filepath.Join(dir, csi.ProviderName+".sock")
+		ctx, cancel := context.WithCancel(context.Background())
+		served := make(chan error, 1)
+		go func() {
+			served <- csi.Serve(ctx, endpoint, provider)
+		}()
+		DeferCleanup(func() {
+			cancel()
+			Eventually(served).Should(Receive(BeNil()))
+		})
+		Eventually(func() error {
+			_, err := os.Stat(endpoint)
+			return err
+		}).Should(Succeed())
+
+		conn, err = grpc.NewClient("unix://"+endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(conn.Close)
+	})
+
+	It("should report the version of the provider API", func() {
+		response, err := providerv1alpha1.NewCSIDriverProviderClient(conn).Version(context.Background(), &providerv1alpha1.VersionRequest{Version: "v1alpha1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Version).To(Equal(csi.APIVersion))
+		Expect(response.RuntimeName).NotTo(BeEmpty())
+	})
+
+	It("should mount mapped secrets under their mapped keys", func() {
+		response, err := mount(map[string]string{
+			"map": "- bwSecretId: " + dbId + "\n  secretKeyName: db-password\n",
+		}, token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files(response)).To(Equal(map[string]string{"db-password": "hunter2"}))
+		Expect(response.ObjectVersion).To(HaveLen(1))
+		Expect(response.ObjectVersion[0].Id).To(Equal("db-password"))
+		Expect(response.ObjectVersion[0].Version).NotTo(BeEmpty())
+	})
+
+	It("should mount all secrets of the organization like a BitwardenSecret", func() {
+		response, err := mount(map[string]string{
+			"organizationId":    orgId,
+			"onlyMappedSecrets": "false",
+			"map":               "- bwSecretId: " + apiKeyId + "\n  secretKeyName: api-key\n",
+		}, token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files(response)).To(Equal(map[string]string{dbId: "hunter2", "api-key": "abc123"}))
+		Expect(response.Files[0].Path).To(Equal(dbId))
+
+		response, err = mount(map[string]string{
+			"organizationId":    orgId,
+			"onlyMappedSecrets": "false",
+			"useSecretNames":    "true",
+		}, token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files(response)).To(Equal(map[string]string{"DB_PASSWORD": "hunter2", "API_KEY": "abc123"}))
+	})
+
+	It("should read the machine account token from the configured key of the node publish secret", func() {
+		parameters := map[string]string{
+			"map":          "- bwSecretId: " + dbId + "\n  secretKeyName: db-password\n",
+			"authTokenKey": "bitwarden-token",
+		}
+		_, err := mount(parameters, token)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		response, err := mount(parameters, map[string]string{"bitwarden-token": "machine-account-token"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files(response)).To(HaveKey("db-password"))
+	})
+
+	It("should reject invalid parameters", func() {
+		for _, parameters := range []map[string]string{
+			{},
+			{"useSecretNames": "true", "map": "- bwSecretId: " + dbId + "\n  secretKeyName: db-password\n"},
+			{"onlyMappedSecrets": "maybe", "map": "- bwSecretId: " + dbId + "\n  secretKeyName: db-password\n"},
+			{"map": "- bwSecretId: " + dbId + "\n  secretKeyName: ../db-password\n"},
+			{"map": "- bwSecretId: " + dbId + "\n  secretKeyName: ..\n"},
+			{"map": "- bwSecretId: " + dbId + "\n  key: db-password\n"},
+			{"onlyMappedSecrets": "false"},
+		} {
+			_, err := mount(parameters, token)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument), "parameters %v", parameters)
+		}
+	})
+
+	It("should reject selecting secrets by name or by a BitwardenSecret", func() {
+		_, err := mount(map[string]string{
+			"organizationId": orgId,
+			"objects":        "- objectName: DB_PASSWORD\n",
+		}, token)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(status.Convert(err).Message()).To(ContainSubstring("the objects parameter is not supported"))
+
+		_, err = mount(map[string]string{
+			"bitwardenSecret": "app-secrets",
+			"map":             "- bwSecretId: " + dbId + "\n  secretKeyName: db-password\n",
+		}, token)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(status.Convert(err).Message()).To(ContainSubstring("the bitwardenSecret parameter is not supported"))
+	})
+
+	It("should fail the mount when a mapped secret is missing", func() {
+		_, err := mount(map[string]string{
+			"map": "- bwSecretId: " + dbId + "\n  secretKeyName: db-password\n- bwSecretId: " + missingId + "\n  secretKeyName: other\n",
+		}, token)
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+		Expect(err.Error()).To(ContainSubstring(missingId))
+	})
+})
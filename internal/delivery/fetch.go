@@ -0,0 +1,141 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package delivery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatFiles writes every key of the data to a file of the same name
+	FormatFiles = "files"
+	// FormatEnv writes the data to EnvFileName as shell variable assignments
+	FormatEnv   = "env"
+	EnvFileName = "secrets.env"
+
+	// Environment variable passing the CA certificate of the delivery API to the init containers
+	EnvCABundle = "BW_DELIVERY_CA_BUNDLE"
+
+	// How long Fetch waits between attempts
+	fetchRetryInterval = 2 * time.Second
+)
+
+// NewHTTPClient returns a client trusting the PEM encoded CA certificates in caBundle, or the system
+// certificates when it is empty.
+func NewHTTPClient(caBundle string, timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caBundle != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caBundle)) {
+			return nil, errors.New("the CA bundle contains no certificate")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// Fetch requests the data of a BitwardenSecret from the delivery API at url, authenticating with the
+// service account token in tokenFile. The token is read for every attempt, since the kubelet rotates it.
+// Fetch retries until the context is done while the data is not available yet, the BitwardenSecret does
+// not exist yet or the operator cannot be reached, and fails right away when the request is denied.
+func Fetch(ctx context.Context, client *http.Client, url string, tokenFile string) (map[string][]byte, error) {
+	for {
+		data, retry, err := fetchOnce(ctx, client, url, tokenFile)
+		if err == nil || !retry {
+			return data, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-time.After(fetchRetryInterval):
+		}
+	}
+}
+
+func fetchOnce(ctx context.Context, client *http.Client, url string, tokenFile string) (map[string][]byte, bool, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to read the service account token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		response := Response{}
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return nil, false, fmt.Errorf("invalid response from %s: %w", url, err)
+		}
+		return response.Data, false, nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, false, fmt.Errorf("request to %s was denied: %s", url, resp.Status)
+	default:
+		return nil, true, fmt.Errorf("request to %s failed: %s", url, resp.Status)
+	}
+}
+
+// Write writes the data to dir in the given format. The files are readable by every user, since the
+// containers of a pod may run as different users and the volume is private to the pod.
+func Write(dir string, format string, data map[string][]byte) error {
+	switch format {
+	case FormatFiles:
+		for key, value := range data {
+			if key != filepath.Base(key) || key == "." || key == ".." {
+				return fmt.Errorf("key %q cannot be used as a file name", key)
+			}
+			if err := os.WriteFile(filepath.Join(dir, key), value, 0o444); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatEnv:
+		var env strings.Builder
+		for _, key := range slices.Sorted(maps.Keys(data)) {
+			// Single quotes keep the value literal; embedded single quotes close and reopen the quoting
+			fmt.Fprintf(&env, "%s='%s'\n", key, strings.ReplaceAll(string(data[key]), "'", `'\''`))
+		}
+		return os.WriteFile(filepath.Join(dir, EnvFileName), []byte(env.String()), 0o444)
+	}
+	return fmt.Errorf("unknown format %q, expected %s or %s", format, FormatFiles, FormatEnv)
+}
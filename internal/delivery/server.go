@@ -0,0 +1,230 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+// Package delivery serves the data of BitwardenSecrets to pods and other in-cluster clients over HTTPS, and
+// fetches it inside pods.
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+const (
+	// Audience of the service account tokens presented to the delivery API
+	Audience = "k8s.bitwarden.com"
+	// Pattern of the delivery API path, served by the webhook server of the operator
+	Pattern = "GET /delivery/v1/namespaces/{namespace}/bitwardensecrets/{name}"
+
+	// Extra fields of the user info of service account tokens bound to a pod
+	extraPodName = "authentication.kubernetes.io/pod-name"
+	extraPodUID  = "authentication.kubernetes.io/pod-uid"
+
+	serviceAccountPrefix = "system:serviceaccount:"
+
+	// Virtual subresource of BitwardenSecrets that grants reading their data through the delivery API
+	DataSubresource = "data"
+)
+
+var deliverylog = logf.Log.WithName("delivery")
+
+// Path returns the path of a BitwardenSecret in the delivery API.
+func Path(namespace string, name string) string {
+	return fmt.Sprintf("/delivery/v1/namespaces/%s/bitwardensecrets/%s", namespace, name)
+}
+
+// Response is the body returned for a BitwardenSecret. The values are base64 encoded, like those of a
+// Kubernetes secret.
+type Response struct {
+	Data map[string][]byte `json:"data"`
+}
+
+// Server delivers the data of BitwardenSecrets to the pods they are injected into, and to the clients
+// authorized to read it.
+//
+// Clients authenticate with a service account token issued for the Audience, which is verified with a
+// TokenReview. A pod bound to the token is served the BitwardenSecret named by its k8s.bitwarden.com/inject
+// annotation, in its own namespace. Any other BitwardenSecret is only served when a SubjectAccessReview
+// allows the user of the token to get the data subresource of it, which does not exist in the API server
+// and is only granted through RBAC. The data is served from what the operator has synced, so clients never
+// hold a machine account token and no call to Bitwarden is made on their behalf.
+type Server struct {
+	// Client reads BitwardenSecrets and synced secrets from the cache, and creates the TokenReviews and
+	// SubjectAccessReviews
+	Client client.Client
+	// APIReader reads the pods presenting tokens and the secrets that are not kept in the cache
+	APIReader client.Reader
+	Delivered *controller.DeliveryCache
+}
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// ServeHTTP answers a request for the data of a BitwardenSecret.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := types.NamespacedName{Namespace: r.PathValue("namespace"), Name: r.PathValue("name")}
+
+	user, err := s.authenticate(ctx, r)
+	if err != nil {
+		deliverylog.Info("Rejected unauthenticated request", "bitwardenSecret", key, "reason", err.Error())
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.authorize(ctx, user, key); err != nil {
+		deliverylog.Info("Rejected unauthorized request", "bitwardenSecret", key, "user", user.Username, "reason", err.Error())
+		http.Error(w, fmt.Sprintf("%s may not read BitwardenSecret %s", user.Username, key), http.StatusForbidden)
+		return
+	}
+
+	bwSecret := &operatorsv1.BitwardenSecret{}
+	if err := s.Client.Get(ctx, key, bwSecret); err != nil {
+		if k8serrors.IsNotFound(err) {
+			http.Error(w, fmt.Sprintf("BitwardenSecret %s not found", key), http.StatusNotFound)
+			return
+		}
+		deliverylog.Error(err, "Failed to read BitwardenSecret", "bitwardenSecret", key)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := controller.DeliveredData(ctx, s.Client, s.APIReader, s.Delivered, bwSecret)
+	if err != nil {
+		if errors.Is(err, controller.ErrNotDelivered) {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		deliverylog.Error(err, "Failed to read the data of BitwardenSecret", "bitwardenSecret", key)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	deliverylog.Info("Delivered BitwardenSecret", "bitwardenSecret", key, "user", user.Username)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(Response{Data: data}); err != nil {
+		deliverylog.Error(err, "Failed to write the data of BitwardenSecret", "bitwardenSecret", key)
+	}
+}
+
+// authenticate verifies the bearer token of a request with a TokenReview.
+func (s *Server) authenticate(ctx context.Context, r *http.Request) (authenticationv1.UserInfo, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return authenticationv1.UserInfo{}, errors.New("no bearer token")
+	}
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: []string{Audience}},
+	}
+	if err := s.Client.Create(ctx, review); err != nil {
+		return authenticationv1.UserInfo{}, fmt.Errorf("token review failed: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return authenticationv1.UserInfo{}, fmt.Errorf("token rejected: %s", review.Status.Error)
+	}
+	if !slices.Contains(review.Status.Audiences, Audience) {
+		return authenticationv1.UserInfo{}, fmt.Errorf("token not issued for %s", Audience)
+	}
+	return review.Status.User, nil
+}
+
+// authorize checks that the token was issued to a pod annotated for the injection of the BitwardenSecret,
+// or to a user allowed to get its data subresource.
+func (s *Server) authorize(ctx context.Context, user authenticationv1.UserInfo, key types.NamespacedName) error {
+	injectionErr := s.authorizeInjection(ctx, user, key)
+	if injectionErr == nil {
+		return nil
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   key.Namespace,
+				Verb:        "get",
+				Group:       operatorsv1.GroupVersion.Group,
+				Resource:    "bitwardensecrets",
+				Subresource: DataSubresource,
+				Name:        key.Name,
+			},
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  make(map[string]authorizationv1.ExtraValue, len(user.Extra)),
+		},
+	}
+	for k, v := range user.Extra {
+		review.Spec.Extra[k] = authorizationv1.ExtraValue(v)
+	}
+	if err := s.Client.Create(ctx, review); err != nil {
+		return fmt.Errorf("%w, and the subject access review failed: %w", injectionErr, err)
+	}
+	if !review.Status.Allowed {
+		return fmt.Errorf("%w, and may not get bitwardensecrets/%s", injectionErr, DataSubresource)
+	}
+	return nil
+}
+
+// authorizeInjection checks that the token was issued to a pod in the namespace of the BitwardenSecret
+// that is annotated for its injection.
+func (s *Server) authorizeInjection(ctx context.Context, user authenticationv1.UserInfo, key types.NamespacedName) error {
+	namespace, _, ok := strings.Cut(strings.TrimPrefix(user.Username, serviceAccountPrefix), ":")
+	if !ok || !strings.HasPrefix(user.Username, serviceAccountPrefix) {
+		return errors.New("not a service account")
+	}
+	if namespace != key.Namespace {
+		return fmt.Errorf("service account of namespace %s", namespace)
+	}
+
+	podName, podUID := user.Extra[extraPodName], user.Extra[extraPodUID]
+	if len(podName) != 1 || len(podUID) != 1 {
+		return errors.New("token not bound to a pod")
+	}
+
+	pod := &corev1.Pod{}
+	if err := s.APIReader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: podName[0]}, pod); err != nil {
+		return fmt.Errorf("pod %s not found: %w", podName[0], err)
+	}
+	if string(pod.UID) != podUID[0] {
+		return fmt.Errorf("pod %s was replaced", podName[0])
+	}
+	if strings.TrimSpace(pod.Annotations[controller.AnnotationInject]) != key.Name {
+		return fmt.Errorf("pod %s is not annotated for the injection of %s", podName[0], key.Name)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package delivery_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/bitwarden/sm-kubernetes/internal/delivery"
+)
+
+var _ = Describe("Delivery Fetch", func() {
+	var (
+		dir       string
+		tokenFile string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		tokenFile = filepath.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(tokenFile, []byte("pod-token\n"), 0o600)).To(Succeed())
+	})
+
+	It("should retry until the data is available", func() {
+		var attempts atomic.Int32
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer pod-token"))
+			if attempts.Add(1) == 1 {
+				http.Error(w, "not synced", http.StatusServiceUnavailable)
+				return
+			}
+			Expect(json.NewEncoder(w).Encode(delivery.Response{Data: map[string][]byte{"password": []byte("secret")}})).To(Succeed())
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		data, err := delivery.Fetch(ctx, server.Client(), server.URL, tokenFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(map[string][]byte{"password": []byte("secret")}))
+		Expect(attempts.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("should fail right away when the request is denied", func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		_, err := delivery.Fetch(context.Background(), server.Client(), server.URL, tokenFile)
+		Expect(err).To(MatchError(ContainSubstring("denied")))
+	})
+
+	It("should write one file per key", func() {
+		Expect(delivery.Write(dir, delivery.FormatFiles, map[string][]byte{"password": []byte("secret"), "user": []byte("app")})).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(dir, "password"))).To(Equal([]byte("secret")))
+		Expect(os.ReadFile(filepath.Join(dir, "user"))).To(Equal([]byte("app")))
+
+		Expect(delivery.Write(dir, delivery.FormatFiles, map[string][]byte{"../escape": []byte("secret")})).NotTo(Succeed())
+	})
+
+	It("should write an env file of quoted assignments", func() {
+		Expect(delivery.Write(dir, delivery.FormatEnv, map[string][]byte{"PASSWORD": []byte("it's $secret"), "USER": []byte("app")})).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(dir, delivery.EnvFileName))).To(Equal([]byte("PASSWORD='it'\\''s $secret'\nUSER='app'\n")))
+	})
+})
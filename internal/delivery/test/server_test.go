@@ -0,0 +1,187 @@
+package delivery_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	"github.com/bitwarden/sm-kubernetes/internal/delivery"
+)
+
+var _ = Describe("Delivery Server", func() {
+	const namespace = "team-a"
+
+	var (
+		server    *delivery.Server
+		mux       *http.ServeMux
+		delivered *controller.DeliveryCache
+		injected  *operatorsv1.BitwardenSecret
+	)
+
+	// Tokens are named after the pod they are bound to, or after their service account when prefixed with sa:
+	tokenReview := func(review *authenticationv1.TokenReview) {
+		if review.Spec.Token == "invalid" {
+			return
+		}
+		if serviceAccount, ok := strings.CutPrefix(review.Spec.Token, "sa:"); ok {
+			review.Status = authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				Audiences:     review.Spec.Audiences,
+				User:          authenticationv1.UserInfo{Username: "system:serviceaccount:" + namespace + ":" + serviceAccount},
+			}
+			return
+		}
+		review.Status = authenticationv1.TokenReviewStatus{
+			Authenticated: true,
+			Audiences:     review.Spec.Audiences,
+			User: authenticationv1.UserInfo{
+				Username: "system:serviceaccount:" + namespace + ":default",
+				Extra: map[string]authenticationv1.ExtraValue{
+					"authentication.kubernetes.io/pod-name": {review.Spec.Token},
+					"authentication.kubernetes.io/pod-uid":  {review.Spec.Token + "-uid"},
+				},
+			},
+		}
+	}
+
+	// Only the reader service account may get the data subresource of the synced BitwardenSecret
+	subjectAccessReview := func(review *authorizationv1.SubjectAccessReview) {
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = review.Spec.User == "system:serviceaccount:"+namespace+":reader" &&
+			attributes.Verb == "get" && attributes.Group == "k8s.bitwarden.com" && attributes.Resource == "bitwardensecrets" &&
+			attributes.Subresource == "data" && attributes.Namespace == namespace && attributes.Name == "synced"
+	}
+
+	create := func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+		switch review := obj.(type) {
+		case *authenticationv1.TokenReview:
+			tokenReview(review)
+			return nil
+		case *authorizationv1.SubjectAccessReview:
+			subjectAccessReview(review)
+			return nil
+		}
+		return c.Create(ctx, obj, opts...)
+	}
+
+	request := func(token string, namespace string, name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, delivery.Path(namespace, name), nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	pod := func(name string, inject string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			UID:         types.UID(name + "-uid"),
+			Annotations: map[string]string{controller.AnnotationInject: inject},
+		}}
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(operatorsv1.AddToScheme(scheme)).To(Succeed())
+
+		injected = &operatorsv1.BitwardenSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "injected", Namespace: namespace, UID: "injected-uid"},
+			Spec:       operatorsv1.BitwardenSecretSpec{Delivery: operatorsv1.DeliveryInject},
+		}
+		synced := &operatorsv1.BitwardenSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "synced", Namespace: namespace},
+			Spec:       operatorsv1.BitwardenSecretSpec{SecretName: "synced-secret", Delivery: operatorsv1.DeliverySecret},
+		}
+		apimeta.SetStatusCondition(&synced.Status.Conditions, metav1.Condition{Type: "SuccessfulSync", Status: metav1.ConditionTrue, Reason: "ReconciliationComplete"})
+
+		k8sClient := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(
+				pod("app", "injected"),
+				pod("other-app", "synced"),
+				pod("unannotated", ""),
+				injected,
+				synced,
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "synced-secret", Namespace: namespace}, Data: map[string][]byte{"token": []byte("from-secret")}},
+			).
+			WithInterceptorFuncs(interceptor.Funcs{Create: create}).
+			Build()
+
+		delivered = controller.NewDeliveryCache()
+		server = &delivery.Server{Client: k8sClient, APIReader: k8sClient, Delivered: delivered}
+		mux = http.NewServeMux()
+		mux.Handle(delivery.Pattern, server)
+	})
+
+	It("should deliver injected data to the annotated pod once it is synced", func() {
+		response := request("app", namespace, "injected")
+		Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(response.Header().Get("Retry-After")).NotTo(BeEmpty())
+
+		delivered.Store(injected, map[string][]byte{"password": []byte("injected")})
+
+		response = request("app", namespace, "injected")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Header().Get("Cache-Control")).To(Equal("no-store"))
+		body := delivery.Response{}
+		Expect(json.Unmarshal(response.Body.Bytes(), &body)).To(Succeed())
+		Expect(body.Data).To(Equal(map[string][]byte{"password": []byte("injected")}))
+	})
+
+	It("should deliver the data of synced secrets", func() {
+		response := request("other-app", namespace, "synced")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		body := delivery.Response{}
+		Expect(json.Unmarshal(response.Body.Bytes(), &body)).To(Succeed())
+		Expect(body.Data).To(Equal(map[string][]byte{"token": []byte("from-secret")}))
+	})
+
+	It("should reject requests without a valid token", func() {
+		Expect(request("", namespace, "injected").Code).To(Equal(http.StatusUnauthorized))
+		Expect(request("invalid", namespace, "injected").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should only deliver a BitwardenSecret to the pods annotated for it", func() {
+		delivered.Store(injected, map[string][]byte{"password": []byte("injected")})
+
+		Expect(request("other-app", namespace, "injected").Code).To(Equal(http.StatusForbidden))
+		Expect(request("unannotated", namespace, "injected").Code).To(Equal(http.StatusForbidden))
+		Expect(request("deleted-pod", namespace, "injected").Code).To(Equal(http.StatusForbidden))
+		Expect(request("app", "team-b", "injected").Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("should deliver a BitwardenSecret to the users allowed to get its data subresource", func() {
+		delivered.Store(injected, map[string][]byte{"password": []byte("injected")})
+
+		response := request("sa:reader", namespace, "synced")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		body := delivery.Response{}
+		Expect(json.Unmarshal(response.Body.Bytes(), &body)).To(Succeed())
+		Expect(body.Data).To(Equal(map[string][]byte{"token": []byte("from-secret")}))
+
+		Expect(request("sa:reader", namespace, "injected").Code).To(Equal(http.StatusForbidden))
+		Expect(request("sa:default", namespace, "synced").Code).To(Equal(http.StatusForbidden))
+	})
+})
@@ -0,0 +1,109 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package v1
+
+import (
+	"context"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+var bitwardengeneratedsecretlog = logf.Log.WithName("bitwardengeneratedsecret-resource")
+
+// SetupBitwardenGeneratedSecretWebhookWithManager registers the webhook for BitwardenGeneratedSecret in the
+// manager.
+func SetupBitwardenGeneratedSecretWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &operatorsv1.BitwardenGeneratedSecret{}).
+		WithValidator(&BitwardenGeneratedSecretCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-k8s-bitwarden-com-v1-bitwardengeneratedsecret,mutating=false,failurePolicy=fail,sideEffects=None,groups=k8s.bitwarden.com,resources=bitwardengeneratedsecrets,verbs=create;update,versions=v1,name=vbitwardengeneratedsecret-v1.kb.io,admissionReviewVersions=v1
+
+// BitwardenGeneratedSecretCustomValidator validates BitwardenGeneratedSecret resources when they are created or
+// updated.
+//
+// The operator reads the auth token secret and writes the password secret with its own permissions, so the
+// validator checks that the requesting user is allowed to get both. Otherwise a user could sync an existing
+// Secrets Manager secret with a machine account token they are not allowed to read, or have the operator write to
+// a Kubernetes secret they are not allowed to read.
+//
+// The validator also rejects BitwardenGeneratedSecrets that violate a BitwardenSecretPolicy selecting their
+// namespace, by their organization or project, or the name of the Kubernetes secret the password is synced to.
+type BitwardenGeneratedSecretCustomValidator struct {
+	Client client.Client
+}
+
+// ValidateCreate checks that the user creating the BitwardenGeneratedSecret can read the referenced secrets and
+// that the BitwardenGeneratedSecret complies with the namespace policies.
+func (v *BitwardenGeneratedSecretCustomValidator) ValidateCreate(ctx context.Context, generated *operatorsv1.BitwardenGeneratedSecret) (admission.Warnings, error) {
+	bitwardengeneratedsecretlog.Info("Validation for BitwardenGeneratedSecret upon creation", "name", generated.GetName(), "namespace", generated.GetNamespace())
+
+	if err := v.validateSecretAccess(ctx, generated, nil); err != nil {
+		return nil, err
+	}
+
+	return nil, v.validatePolicies(ctx, generated)
+}
+
+// ValidateUpdate checks that the user updating the BitwardenGeneratedSecret can read the secrets it references
+// when they change, and that the BitwardenGeneratedSecret complies with the namespace policies.
+func (v *BitwardenGeneratedSecretCustomValidator) ValidateUpdate(ctx context.Context, oldGenerated, newGenerated *operatorsv1.BitwardenGeneratedSecret) (admission.Warnings, error) {
+	bitwardengeneratedsecretlog.Info("Validation for BitwardenGeneratedSecret upon update", "name", newGenerated.GetName(), "namespace", newGenerated.GetNamespace())
+
+	if err := v.validateSecretAccess(ctx, newGenerated, oldGenerated); err != nil {
+		return nil, err
+	}
+
+	return nil, v.validatePolicies(ctx, newGenerated)
+}
+
+// ValidateDelete does nothing; removing a BitwardenGeneratedSecret never grants access to anything.
+func (v *BitwardenGeneratedSecretCustomValidator) ValidateDelete(ctx context.Context, generated *operatorsv1.BitwardenGeneratedSecret) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateSecretAccess checks the access to the referenced secrets that are new, or to all of them when old is nil.
+func (v *BitwardenGeneratedSecretCustomValidator) validateSecretAccess(ctx context.Context, generated *operatorsv1.BitwardenGeneratedSecret, old *operatorsv1.BitwardenGeneratedSecret) error {
+	logger := bitwardengeneratedsecretlog.WithValues("name", generated.GetName(), "namespace", generated.GetNamespace())
+
+	if old == nil || old.Spec.SecretName != generated.Spec.SecretName {
+		if err := validateSecretAccess(ctx, v.Client, logger, generated.Namespace, generated.Spec.SecretName, "spec.secretName"); err != nil {
+			return err
+		}
+	}
+	if old == nil || old.Spec.AuthToken != generated.Spec.AuthToken {
+		return validateSecretAccess(ctx, v.Client, logger, generated.Namespace, generated.Spec.AuthToken.SecretName, "spec.authToken")
+	}
+	return nil
+}
+
+func (v *BitwardenGeneratedSecretCustomValidator) validatePolicies(ctx context.Context, generated *operatorsv1.BitwardenGeneratedSecret) error {
+	return validatePolicies(ctx, v.Client, generated.Namespace, func(policies []operatorsv1.BitwardenSecretPolicy) []string {
+		return controller.CheckGeneratedSecretPolicies(policies, generated)
+	})
+}
@@ -0,0 +1,106 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package v1
+
+import (
+	"context"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+var bitwardenpushsecretlog = logf.Log.WithName("bitwardenpushsecret-resource")
+
+// SetupBitwardenPushSecretWebhookWithManager registers the webhook for BitwardenPushSecret in the manager.
+func SetupBitwardenPushSecretWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &operatorsv1.BitwardenPushSecret{}).
+		WithValidator(&BitwardenPushSecretCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-k8s-bitwarden-com-v1-bitwardenpushsecret,mutating=false,failurePolicy=fail,sideEffects=None,groups=k8s.bitwarden.com,resources=bitwardenpushsecrets,verbs=create;update,versions=v1,name=vbitwardenpushsecret-v1.kb.io,admissionReviewVersions=v1
+
+// BitwardenPushSecretCustomValidator validates BitwardenPushSecret resources when they are created or updated.
+//
+// The operator reads the pushed secret and the auth token secret with its own permissions, so the validator
+// checks that the requesting user is allowed to get both. Otherwise a user could copy a secret they are not
+// allowed to read to a Secrets Manager project of their choosing.
+//
+// The validator also rejects BitwardenPushSecrets whose organization or project is not allowed by a
+// BitwardenSecretPolicy selecting their namespace.
+type BitwardenPushSecretCustomValidator struct {
+	Client client.Client
+}
+
+// ValidateCreate checks that the user creating the BitwardenPushSecret can read the referenced secrets and that
+// the BitwardenPushSecret complies with the namespace policies.
+func (v *BitwardenPushSecretCustomValidator) ValidateCreate(ctx context.Context, pushSecret *operatorsv1.BitwardenPushSecret) (admission.Warnings, error) {
+	bitwardenpushsecretlog.Info("Validation for BitwardenPushSecret upon creation", "name", pushSecret.GetName(), "namespace", pushSecret.GetNamespace())
+
+	if err := v.validateSecretAccess(ctx, pushSecret, nil); err != nil {
+		return nil, err
+	}
+
+	return nil, v.validatePolicies(ctx, pushSecret)
+}
+
+// ValidateUpdate checks that the user updating the BitwardenPushSecret can read the secrets it references when
+// they change, and that the BitwardenPushSecret complies with the namespace policies.
+func (v *BitwardenPushSecretCustomValidator) ValidateUpdate(ctx context.Context, oldPushSecret, newPushSecret *operatorsv1.BitwardenPushSecret) (admission.Warnings, error) {
+	bitwardenpushsecretlog.Info("Validation for BitwardenPushSecret upon update", "name", newPushSecret.GetName(), "namespace", newPushSecret.GetNamespace())
+
+	if err := v.validateSecretAccess(ctx, newPushSecret, oldPushSecret); err != nil {
+		return nil, err
+	}
+
+	return nil, v.validatePolicies(ctx, newPushSecret)
+}
+
+// ValidateDelete does nothing; removing a BitwardenPushSecret never grants access to anything.
+func (v *BitwardenPushSecretCustomValidator) ValidateDelete(ctx context.Context, pushSecret *operatorsv1.BitwardenPushSecret) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateSecretAccess checks the access to the referenced secrets that are new, or to all of them when old is nil.
+func (v *BitwardenPushSecretCustomValidator) validateSecretAccess(ctx context.Context, pushSecret *operatorsv1.BitwardenPushSecret, old *operatorsv1.BitwardenPushSecret) error {
+	logger := bitwardenpushsecretlog.WithValues("name", pushSecret.GetName(), "namespace", pushSecret.GetNamespace())
+
+	if old == nil || old.Spec.SecretName != pushSecret.Spec.SecretName {
+		if err := validateSecretAccess(ctx, v.Client, logger, pushSecret.Namespace, pushSecret.Spec.SecretName, "spec.secretName"); err != nil {
+			return err
+		}
+	}
+	if old == nil || old.Spec.AuthToken != pushSecret.Spec.AuthToken {
+		return validateSecretAccess(ctx, v.Client, logger, pushSecret.Namespace, pushSecret.Spec.AuthToken.SecretName, "spec.authToken")
+	}
+	return nil
+}
+
+func (v *BitwardenPushSecretCustomValidator) validatePolicies(ctx context.Context, pushSecret *operatorsv1.BitwardenPushSecret) error {
+	return validatePolicies(ctx, v.Client, pushSecret.Namespace, func(policies []operatorsv1.BitwardenSecretPolicy) []string {
+		return controller.CheckPushSecretPolicies(policies, pushSecret)
+	})
+}
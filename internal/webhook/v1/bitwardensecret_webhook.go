@@ -0,0 +1,100 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package v1
+
+import (
+	"context"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+var bitwardensecretlog = logf.Log.WithName("bitwardensecret-resource")
+
+// SetupBitwardenSecretWebhookWithManager registers the webhook for BitwardenSecret in the manager.
+func SetupBitwardenSecretWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &operatorsv1.BitwardenSecret{}).
+		WithValidator(&BitwardenSecretCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-k8s-bitwarden-com-v1-bitwardensecret,mutating=false,failurePolicy=fail,sideEffects=None,groups=k8s.bitwarden.com,resources=bitwardensecrets,verbs=create;update,versions=v1,name=vbitwardensecret-v1.kb.io,admissionReviewVersions=v1
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// BitwardenSecretCustomValidator validates BitwardenSecret resources when they are created or updated.
+//
+// The API server only checks that the requesting user may write BitwardenSecrets. Because the operator
+// reads the referenced auth token secret with its own permissions, the validator also checks that the
+// requesting user is allowed to get that secret. Otherwise a user could sync secrets using a machine
+// account token they are not allowed to read.
+//
+// The validator also rejects BitwardenSecrets that violate a BitwardenSecretPolicy selecting their namespace.
+// Restrictions that depend on the secrets returned by Secrets Manager are enforced by the reconciler.
+type BitwardenSecretCustomValidator struct {
+	Client client.Client
+}
+
+// ValidateCreate checks that the user creating the BitwardenSecret can read the referenced auth token secret
+// and that the BitwardenSecret complies with the namespace policies.
+func (v *BitwardenSecretCustomValidator) ValidateCreate(ctx context.Context, bwSecret *operatorsv1.BitwardenSecret) (admission.Warnings, error) {
+	bitwardensecretlog.Info("Validation for BitwardenSecret upon creation", "name", bwSecret.GetName(), "namespace", bwSecret.GetNamespace())
+
+	if err := v.validateAuthTokenAccess(ctx, bwSecret); err != nil {
+		return nil, err
+	}
+
+	return nil, v.validatePolicies(ctx, bwSecret)
+}
+
+// ValidateUpdate checks that the user updating the BitwardenSecret can read the referenced auth token secret
+// when the reference changes, and that the BitwardenSecret complies with the namespace policies. Updates that
+// keep the auth token, such as those of controllers that never read secrets, do not need access to it.
+func (v *BitwardenSecretCustomValidator) ValidateUpdate(ctx context.Context, oldBwSecret, newBwSecret *operatorsv1.BitwardenSecret) (admission.Warnings, error) {
+	bitwardensecretlog.Info("Validation for BitwardenSecret upon update", "name", newBwSecret.GetName(), "namespace", newBwSecret.GetNamespace())
+
+	if oldBwSecret.Spec.AuthToken != newBwSecret.Spec.AuthToken {
+		if err := v.validateAuthTokenAccess(ctx, newBwSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, v.validatePolicies(ctx, newBwSecret)
+}
+
+// ValidateDelete does nothing; removing a BitwardenSecret never grants access to anything.
+func (v *BitwardenSecretCustomValidator) ValidateDelete(ctx context.Context, bwSecret *operatorsv1.BitwardenSecret) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *BitwardenSecretCustomValidator) validateAuthTokenAccess(ctx context.Context, bwSecret *operatorsv1.BitwardenSecret) error {
+	logger := bitwardensecretlog.WithValues("name", bwSecret.GetName(), "namespace", bwSecret.GetNamespace())
+	return validateSecretAccess(ctx, v.Client, logger, bwSecret.Namespace, bwSecret.Spec.AuthToken.SecretName, "spec.authToken")
+}
+
+func (v *BitwardenSecretCustomValidator) validatePolicies(ctx context.Context, bwSecret *operatorsv1.BitwardenSecret) error {
+	return validatePolicies(ctx, v.Client, bwSecret.Namespace, func(policies []operatorsv1.BitwardenSecretPolicy) []string {
+		return controller.CheckSpecPolicies(policies, bwSecret)
+	})
+}
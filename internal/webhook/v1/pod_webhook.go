@@ -0,0 +1,256 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	"github.com/bitwarden/sm-kubernetes/internal/delivery"
+)
+
+const (
+	// Name of the init container fetching injected data, and of the volumes it uses
+	InjectContainerName = "bitwarden-inject"
+	injectDataVolume    = "bitwarden-inject-data"
+	injectTokenVolume   = "bitwarden-inject-token"
+
+	// Where injected data is mounted when the pod does not set AnnotationInjectPath
+	DefaultInjectPath = "/bitwarden/secrets"
+	injectTokenPath   = "/var/run/secrets/k8s.bitwarden.com"
+	// Lifetime of the token the init container authenticates with
+	injectTokenExpirationSeconds = 600
+)
+
+var podlog = logf.Log.WithName("pod-resource")
+
+// InjectionConfig configures the init containers injecting the data of BitwardenSecrets into pods.
+type InjectionConfig struct {
+	// Image of the init container, normally the image of the operator
+	Image string
+	// DeliveryURL is the base URL of the delivery API, served by the webhook service of the operator
+	DeliveryURL string
+	// CAFile holds the CA certificate the init containers verify the delivery API with. The system
+	// certificates are used when it does not exist.
+	CAFile string
+}
+
+// Paths of the pod webhooks, which are registered separately so that each has its own failure policy
+const (
+	InjectWebhookPath        = "/mutate--v1-pod-inject"
+	ReadinessGateWebhookPath = "/mutate--v1-pod-readiness-gate"
+)
+
+// SetupPodWebhookWithManager registers the webhooks for Pods in the manager. The readiness gate webhook is only
+// served when addReadinessGates is set, and the injection webhook only when injection is configured.
+func SetupPodWebhookWithManager(mgr ctrl.Manager, addReadinessGates bool, injection *InjectionConfig) error {
+	if injection != nil {
+		if err := ctrl.NewWebhookManagedBy(mgr, &corev1.Pod{}).
+			WithDefaulter(&PodDefaulter{Injection: injection}).
+			WithDefaulterCustomPath(InjectWebhookPath).
+			Complete(); err != nil {
+			return err
+		}
+	}
+	if addReadinessGates {
+		if err := ctrl.NewWebhookManagedBy(mgr, &corev1.Pod{}).
+			WithDefaulter(&PodDefaulter{Client: mgr.GetClient(), ReadinessGates: true}).
+			WithDefaulterCustomPath(ReadinessGateWebhookPath).
+			Complete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The webhooks only receive the pods labelled for them, through the object selectors added by
+// config/webhook/pod_webhook_patch.yaml. The injection webhook fails closed, so that pods asking for
+// injection are rejected rather than started without their data while the operator is unavailable or
+// injection is disabled. The readiness gate webhook fails open, so that pods are never blocked by the
+// operator itself.
+//+kubebuilder:webhook:path=/mutate--v1-pod-inject,mutating=true,failurePolicy=fail,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=mpod-inject-v1.kb.io,admissionReviewVersions=v1,timeoutSeconds=5
+//+kubebuilder:webhook:path=/mutate--v1-pod-readiness-gate,mutating=true,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=mpod-readiness-gate-v1.kb.io,admissionReviewVersions=v1,timeoutSeconds=5
+
+// PodDefaulter prepares new pods for the BitwardenSecrets they use.
+//
+// With ReadinessGates, it adds the k8s.bitwarden.com/secrets-synced readiness gate to pods labelled with
+// k8s.bitwarden.com/readiness-gate that reference the Kubernetes secret of a BitwardenSecret in their
+// namespace. The controller.PodReadinessReconciler then keeps those pods from becoming ready until the
+// BitwardenSecrets have been synced. Failing to look up the BitwardenSecrets admits the pod without a gate.
+//
+// With Injection, it adds an init container to pods labelled with k8s.bitwarden.com/inject, which fetches
+// the data of the BitwardenSecret named by their k8s.bitwarden.com/inject annotation from the delivery API
+// and writes it to an in-memory volume mounted into every container of the pod.
+type PodDefaulter struct {
+	Client         client.Client
+	ReadinessGates bool
+	Injection      *InjectionConfig
+}
+
+// Default prepares a pod being created.
+func (d *PodDefaulter) Default(ctx context.Context, pod *corev1.Pod) error {
+	// Pods created from manifests without a namespace only carry it in the admission request
+	namespace := pod.Namespace
+	if namespace == "" {
+		req, err := admission.RequestFromContext(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to determine the namespace of the pod: %w", err)
+		}
+		namespace = req.Namespace
+	}
+
+	if d.Injection != nil && pod.Labels[controller.LabelInject] == "true" {
+		if err := d.inject(namespace, pod); err != nil {
+			return err
+		}
+	}
+	if d.ReadinessGates && pod.Labels[controller.LabelReadinessGate] == "true" {
+		d.addReadinessGate(ctx, namespace, pod)
+	}
+	return nil
+}
+
+func (d *PodDefaulter) addReadinessGate(ctx context.Context, namespace string, pod *corev1.Pod) {
+	if controller.HasSecretsSyncedGate(pod) {
+		return
+	}
+
+	bwSecrets := &operatorsv1.BitwardenSecretList{}
+	if err := d.Client.List(ctx, bwSecrets, client.InNamespace(namespace)); err != nil {
+		podlog.Error(err, "Failed to list BitwardenSecrets; admitting pod without readiness gate", "namespace", namespace)
+		return
+	}
+
+	if len(controller.ReferencedBitwardenSecrets(&pod.Spec, bwSecrets.Items)) == 0 {
+		return
+	}
+
+	pod.Spec.ReadinessGates = append(pod.Spec.ReadinessGates, corev1.PodReadinessGate{ConditionType: controller.PodConditionSecretsSynced})
+}
+
+// inject adds the init container fetching the data of the BitwardenSecret named by the inject annotation.
+// Missing or invalid annotations reject the pod, since it would otherwise start without its data.
+func (d *PodDefaulter) inject(namespace string, pod *corev1.Pod) error {
+	if slices.ContainsFunc(pod.Spec.InitContainers, func(c corev1.Container) bool { return c.Name == InjectContainerName }) {
+		return nil
+	}
+	name := strings.TrimSpace(pod.Annotations[controller.AnnotationInject])
+	if name == "" {
+		return fmt.Errorf("pods labelled with %s must name the BitwardenSecret to inject in the %s annotation", controller.LabelInject, controller.AnnotationInject)
+	}
+
+	format := pod.Annotations[controller.AnnotationInjectFormat]
+	if format == "" {
+		format = delivery.FormatFiles
+	}
+	if format != delivery.FormatFiles && format != delivery.FormatEnv {
+		return fmt.Errorf("annotation %s must be %s or %s, got %q", controller.AnnotationInjectFormat, delivery.FormatFiles, delivery.FormatEnv, format)
+	}
+
+	mountPath := pod.Annotations[controller.AnnotationInjectPath]
+	if mountPath == "" {
+		mountPath = DefaultInjectPath
+	}
+	if !path.IsAbs(mountPath) {
+		return fmt.Errorf("annotation %s must be an absolute path, got %q", controller.AnnotationInjectPath, mountPath)
+	}
+
+	var env []corev1.EnvVar
+	if caBundle, err := os.ReadFile(d.Injection.CAFile); err == nil {
+		env = append(env, corev1.EnvVar{Name: delivery.EnvCABundle, Value: string(caBundle)})
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to read the CA certificate of the delivery API: %w", err)
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes,
+		corev1.Volume{Name: injectDataVolume, VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory, SizeLimit: ptr.To(resource.MustParse("1Mi"))},
+		}},
+		corev1.Volume{Name: injectTokenVolume, VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{{
+				ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+					Audience:          delivery.Audience,
+					ExpirationSeconds: ptr.To[int64](injectTokenExpirationSeconds),
+					Path:              "token",
+				},
+			}}},
+		}},
+	)
+
+	// The data is mounted before the init container is added, which writes to it
+	mount := corev1.VolumeMount{Name: injectDataVolume, MountPath: mountPath, ReadOnly: true}
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			if !slices.ContainsFunc(containers[i].VolumeMounts, func(m corev1.VolumeMount) bool { return m.MountPath == mountPath }) {
+				containers[i].VolumeMounts = append(containers[i].VolumeMounts, mount)
+			}
+		}
+	}
+
+	initContainer := corev1.Container{
+		Name:            InjectContainerName,
+		Image:           d.Injection.Image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args: []string{
+			"fetch",
+			"--url", strings.TrimSuffix(d.Injection.DeliveryURL, "/") + delivery.Path(namespace, name),
+			"--token-file", injectTokenPath + "/token",
+			"--dir", mountPath,
+			"--format", format,
+		},
+		Env: env,
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: injectDataVolume, MountPath: mountPath},
+			{Name: injectTokenVolume, MountPath: injectTokenPath, ReadOnly: true},
+		},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m"), corev1.ResourceMemory: resource.MustParse("32Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			RunAsNonRoot:             ptr.To(true),
+			AllowPrivilegeEscalation: ptr.To(false),
+			ReadOnlyRootFilesystem:   ptr.To(true),
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		},
+	}
+	// Other init containers may need the data too, so the injection runs first
+	pod.Spec.InitContainers = append([]corev1.Container{initContainer}, pod.Spec.InitContainers...)
+
+	podlog.Info("Injecting BitwardenSecret into pod", "namespace", namespace, "pod", pod.GenerateName+pod.Name, "bitwardenSecret", name)
+	return nil
+}
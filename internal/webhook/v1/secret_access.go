@@ -0,0 +1,91 @@
+/*
+Source code in this repository is covered by one of two licenses: (i) the
+GNU General Public License (GPL) v3.0 (ii) the Bitwarden License v1.0. The
+default license throughout the repository is GPL v3.0 unless the header
+specifies another license. Bitwarden Licensed code is found only in the
+/bitwarden_license directory.
+
+GPL v3.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_GPL.txt
+
+Bitwarden License v1.0:
+https://github.com/bitwarden/server/blob/main/LICENSE_BITWARDEN.txt
+
+No grant of any rights in the trademarks, service marks, or logos of Bitwarden is
+made (except as may be necessary to comply with the notice requirements as
+applicable), and use of any Bitwarden trademarks must comply with Bitwarden
+Trademark Guidelines
+<https://github.com/bitwarden/server/blob/main/TRADEMARK_GUIDELINES.md>.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+)
+
+// validateSecretAccess checks that the requesting user is allowed to get a secret the operator reads or writes
+// with its own permissions on their behalf. field is the reference to the secret, reported in the error.
+func validateSecretAccess(ctx context.Context, c client.Client, logger logr.Logger, namespace string, secretName string, field string) error {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to determine the requesting user: %w", err)
+	}
+
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, value := range req.UserInfo.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   req.UserInfo.Username,
+			Groups: req.UserInfo.Groups,
+			UID:    req.UserInfo.UID,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "get",
+				Group:     "",
+				Resource:  "secrets",
+				Name:      secretName,
+			},
+		},
+	}
+
+	if err := c.Create(ctx, review); err != nil {
+		return fmt.Errorf("unable to verify access to secret %s/%s referenced by %s: %w", namespace, secretName, field, err)
+	}
+
+	if !review.Status.Allowed {
+		logger.Info("Denied a reference to an unreadable secret", "user", req.UserInfo.Username, "field", field, "secret", secretName)
+		return fmt.Errorf("user %q is not allowed to get secret %s/%s referenced by %s", req.UserInfo.Username, namespace, secretName, field)
+	}
+
+	return nil
+}
+
+// validatePolicies rejects the resource when check finds violations of the BitwardenSecretPolicies selecting
+// its namespace.
+func validatePolicies(ctx context.Context, c client.Client, namespace string, check func([]operatorsv1.BitwardenSecretPolicy) []string) error {
+	policies, err := controller.GetApplicablePolicies(ctx, c, namespace)
+	if err != nil {
+		return fmt.Errorf("unable to look up BitwardenSecretPolicies for namespace %s: %w", namespace, err)
+	}
+
+	if violations := check(policies); len(violations) > 0 {
+		return fmt.Errorf("BitwardenSecretPolicy violations: %s", strings.Join(violations, "; "))
+	}
+
+	return nil
+}
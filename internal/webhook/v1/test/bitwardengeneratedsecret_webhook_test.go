@@ -0,0 +1,135 @@
+package v1_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	webhookv1 "github.com/bitwarden/sm-kubernetes/internal/webhook/v1"
+)
+
+var _ = Describe("BitwardenGeneratedSecret Webhook", func() {
+	const (
+		namespace = "team-a"
+		orgId     = "a08a8157-129e-4002-bab4-b118014ca9c7"
+		projectId = "8f0e3b5a-6f4e-4c2b-9a4e-b15501234567"
+	)
+
+	var (
+		reviews   []authorizationv1.SubjectAccessReview
+		readable  map[string]bool
+		policies  []client.Object
+		ctx       context.Context
+		generated *operatorsv1.BitwardenGeneratedSecret
+	)
+
+	newValidator := func() *webhookv1.BitwardenGeneratedSecretCustomValidator {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(operatorsv1.AddToScheme(scheme)).To(Succeed())
+
+		objects := append([]client.Object{
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: map[string]string{"tenant": "a"}}},
+		}, policies...)
+
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(objects...).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					review, ok := obj.(*authorizationv1.SubjectAccessReview)
+					if !ok {
+						return c.Create(ctx, obj, opts...)
+					}
+					reviews = append(reviews, *review)
+					review.Status.Allowed = readable[review.Spec.ResourceAttributes.Name]
+					return nil
+				},
+			}).
+			Build()
+
+		return &webhookv1.BitwardenGeneratedSecretCustomValidator{Client: fakeClient}
+	}
+
+	BeforeEach(func() {
+		reviews = nil
+		readable = map[string]bool{"db-password": true, "bw-auth-token": true}
+		policies = nil
+		ctx = admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				UserInfo: authenticationv1.UserInfo{Username: "alice"},
+			},
+		})
+
+		generated = &operatorsv1.BitwardenGeneratedSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "generated-secret", Namespace: namespace},
+			Spec: operatorsv1.BitwardenGeneratedSecretSpec{
+				SecretName:     "db-password",
+				OrganizationId: orgId,
+				ProjectId:      projectId,
+				BwSecretName:   "db-password",
+				AuthToken:      operatorsv1.AuthToken{SecretName: "bw-auth-token", SecretKey: "token"},
+			},
+		}
+	})
+
+	It("should check that the user can get the password and the auth token secrets", func() {
+		_, err := newValidator().ValidateCreate(ctx, generated)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(reviews).To(HaveLen(2))
+		Expect(reviews[0].Spec.ResourceAttributes.Name).To(Equal("db-password"))
+		Expect(reviews[1].Spec.ResourceAttributes.Name).To(Equal("bw-auth-token"))
+	})
+
+	It("should reject an auth token secret the user cannot get", func() {
+		readable = map[string]bool{"db-password": true}
+
+		_, err := newValidator().ValidateCreate(ctx, generated)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("not allowed to get secret team-a/bw-auth-token referenced by spec.authToken"))
+	})
+
+	It("should not review access on updates that keep the referenced secrets", func() {
+		readable = map[string]bool{}
+		updated := generated.DeepCopy()
+		updated.Spec.Password.Length = 64
+
+		_, err := newValidator().ValidateUpdate(ctx, generated, updated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews).To(BeEmpty())
+	})
+
+	It("should reject a project or secret name the policies do not allow", func() {
+		policies = []client.Object{
+			&operatorsv1.BitwardenSecretPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "tenant-a"},
+				Spec: operatorsv1.BitwardenSecretPolicySpec{
+					NamespaceSelector:         metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+					AllowedOrganizationIds:    []string{orgId},
+					AllowedProjectIds:         []string{"some-other-project"},
+					AllowedSecretNamePatterns: []string{"app-*"},
+				},
+			},
+		}
+
+		_, err := newValidator().ValidateCreate(ctx, generated)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("policy tenant-a does not allow project " + projectId))
+		Expect(err.Error()).To(ContainSubstring("policy tenant-a does not allow secret name db-password"))
+		Expect(err.Error()).NotTo(ContainSubstring("organization"))
+	})
+})
@@ -0,0 +1,286 @@
+package v1_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	webhookv1 "github.com/bitwarden/sm-kubernetes/internal/webhook/v1"
+)
+
+var _ = Describe("BitwardenSecret Webhook - Auth Token Access", func() {
+	const (
+		namespace      = "team-a"
+		authSecretName = "bw-auth-token"
+		allowedUser    = "alice"
+	)
+
+	var (
+		reviews   []authorizationv1.SubjectAccessReview
+		validator *webhookv1.BitwardenSecretCustomValidator
+		bwSecret  *operatorsv1.BitwardenSecret
+	)
+
+	contextFor := func(username string) context.Context {
+		return admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				UserInfo: authenticationv1.UserInfo{
+					Username: username,
+					Groups:   []string{"system:authenticated"},
+				},
+			},
+		})
+	}
+
+	BeforeEach(func() {
+		reviews = nil
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(operatorsv1.AddToScheme(scheme)).To(Succeed())
+
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: map[string]string{"tenant": "a"}}}).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					review, ok := obj.(*authorizationv1.SubjectAccessReview)
+					if !ok {
+						return c.Create(ctx, obj, opts...)
+					}
+					reviews = append(reviews, *review)
+					review.Status.Allowed = review.Spec.User == allowedUser
+					return nil
+				},
+			}).
+			Build()
+
+		validator = &webhookv1.BitwardenSecretCustomValidator{Client: fakeClient}
+
+		bwSecret = &operatorsv1.BitwardenSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bw-secret", Namespace: namespace},
+			Spec: operatorsv1.BitwardenSecretSpec{
+				SecretName: "synced-secret",
+				AuthToken: operatorsv1.AuthToken{
+					SecretName: authSecretName,
+					SecretKey:  "token",
+				},
+			},
+		}
+	})
+
+	It("should allow creation when the user can get the auth token secret", func() {
+		_, err := validator.ValidateCreate(contextFor(allowedUser), bwSecret)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(reviews).To(HaveLen(1))
+		Expect(reviews[0].Spec.User).To(Equal(allowedUser))
+		Expect(reviews[0].Spec.Groups).To(ConsistOf("system:authenticated"))
+		Expect(reviews[0].Spec.ResourceAttributes).NotTo(BeNil())
+		Expect(*reviews[0].Spec.ResourceAttributes).To(Equal(authorizationv1.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      "get",
+			Resource:  "secrets",
+			Name:      authSecretName,
+		}))
+	})
+
+	It("should reject creation when the user cannot get the auth token secret", func() {
+		_, err := validator.ValidateCreate(contextFor("mallory"), bwSecret)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("not allowed to get secret %s/%s", namespace, authSecretName)))
+	})
+
+	It("should reject updates that point at an auth token secret the user cannot get", func() {
+		updated := bwSecret.DeepCopy()
+		updated.Spec.AuthToken.SecretName = "someone-elses-token"
+
+		_, err := validator.ValidateUpdate(contextFor("mallory"), bwSecret, updated)
+		Expect(err).To(HaveOccurred())
+		Expect(reviews).To(HaveLen(1))
+		Expect(reviews[0].Spec.ResourceAttributes.Name).To(Equal("someone-elses-token"))
+	})
+
+	It("should allow updates that keep the auth token without an access review", func() {
+		updated := bwSecret.DeepCopy()
+		updated.Spec.SecretName = "renamed-secret"
+
+		_, err := validator.ValidateUpdate(contextFor("mallory"), bwSecret, updated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews).To(BeEmpty())
+	})
+
+	It("should allow deletion without an access review", func() {
+		_, err := validator.ValidateDelete(contextFor("mallory"), bwSecret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reviews).To(BeEmpty())
+	})
+
+	It("should reject the request when the requesting user is unknown", func() {
+		_, err := validator.ValidateCreate(context.Background(), bwSecret)
+		Expect(err).To(HaveOccurred())
+		Expect(reviews).To(BeEmpty())
+	})
+})
+
+var _ = Describe("BitwardenSecret Webhook - Namespace Policies", func() {
+	const (
+		namespace = "team-a"
+		orgId     = "a08a8157-129e-4002-bab4-b118014ca9c7"
+	)
+
+	var (
+		validator *webhookv1.BitwardenSecretCustomValidator
+		bwSecret  *operatorsv1.BitwardenSecret
+		ctx       context.Context
+	)
+
+	newValidator := func(policies ...client.Object) *webhookv1.BitwardenSecretCustomValidator {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(operatorsv1.AddToScheme(scheme)).To(Succeed())
+
+		objects := append([]client.Object{
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: map[string]string{"tenant": "a"}}},
+		}, policies...)
+
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(objects...).
+			WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					if review, ok := obj.(*authorizationv1.SubjectAccessReview); ok {
+						review.Status.Allowed = true
+						return nil
+					}
+					return c.Create(ctx, obj, opts...)
+				},
+			}).
+			Build()
+
+		return &webhookv1.BitwardenSecretCustomValidator{Client: fakeClient}
+	}
+
+	newPolicy := func(name string, selector map[string]string, spec operatorsv1.BitwardenSecretPolicySpec) *operatorsv1.BitwardenSecretPolicy {
+		spec.NamespaceSelector = metav1.LabelSelector{MatchLabels: selector}
+		return &operatorsv1.BitwardenSecretPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       spec,
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				UserInfo: authenticationv1.UserInfo{Username: "alice"},
+			},
+		})
+
+		bwSecret = &operatorsv1.BitwardenSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "bw-secret", Namespace: namespace},
+			Spec: operatorsv1.BitwardenSecretSpec{
+				OrganizationId:    orgId,
+				SecretName:        "app-credentials",
+				OnlyMappedSecrets: true,
+				SecretMap: []operatorsv1.SecretMap{
+					{BwSecretId: "e30f88bd-9e9c-42ae-83b7-b155012da672", SecretKeyName: "DB_PASSWORD"},
+					{BwSecretId: "9f66ccaf-998e-4e5d-9294-b155012db579", SecretKeyName: "API_KEY"},
+				},
+				AuthToken: operatorsv1.AuthToken{SecretName: "bw-auth-token", SecretKey: "token"},
+			},
+		}
+	})
+
+	It("should allow BitwardenSecrets that satisfy every matching policy", func() {
+		validator = newValidator(newPolicy("tenant-a", map[string]string{"tenant": "a"}, operatorsv1.BitwardenSecretPolicySpec{
+			AllowedOrganizationIds:    []string{orgId},
+			AllowedSecretNamePatterns: []string{"app-*"},
+			AllowedSecretTypes:        []corev1.SecretType{corev1.SecretTypeOpaque},
+			MaxKeys:                   ptr.To[int32](2),
+		}))
+
+		_, err := validator.ValidateCreate(ctx, bwSecret)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should ignore policies that do not select the namespace", func() {
+		validator = newValidator(newPolicy("tenant-b", map[string]string{"tenant": "b"}, operatorsv1.BitwardenSecretPolicySpec{
+			AllowedOrganizationIds: []string{"some-other-org"},
+		}))
+
+		_, err := validator.ValidateCreate(ctx, bwSecret)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject a disallowed organization", func() {
+		validator = newValidator(newPolicy("tenant-a", map[string]string{"tenant": "a"}, operatorsv1.BitwardenSecretPolicySpec{
+			AllowedOrganizationIds: []string{"some-other-org"},
+		}))
+
+		_, err := validator.ValidateCreate(ctx, bwSecret)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("does not allow organization " + orgId))
+	})
+
+	It("should reject a target secret name that matches no pattern", func() {
+		validator = newValidator(newPolicy("tenant-a", map[string]string{}, operatorsv1.BitwardenSecretPolicySpec{
+			AllowedSecretNamePatterns: []string{"team-a-*"},
+		}))
+
+		_, err := validator.ValidateUpdate(ctx, bwSecret, bwSecret)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("does not allow secret name app-credentials"))
+	})
+
+	It("should reject a disallowed secret type", func() {
+		validator = newValidator(newPolicy("tenant-a", map[string]string{"tenant": "a"}, operatorsv1.BitwardenSecretPolicySpec{
+			AllowedSecretTypes: []corev1.SecretType{corev1.SecretTypeOpaque},
+		}))
+		bwSecret.Spec.SecretType = corev1.SecretTypeDockerConfigJson
+
+		_, err := validator.ValidateCreate(ctx, bwSecret)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("does not allow secret type kubernetes.io/dockerconfigjson"))
+	})
+
+	It("should reject more mapped secrets than the policy allows", func() {
+		validator = newValidator(newPolicy("tenant-a", map[string]string{"tenant": "a"}, operatorsv1.BitwardenSecretPolicySpec{
+			MaxKeys: ptr.To[int32](1),
+		}))
+
+		_, err := validator.ValidateCreate(ctx, bwSecret)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("allows at most 1 keys"))
+	})
+
+	It("should require every matching policy to be satisfied", func() {
+		validator = newValidator(
+			newPolicy("allow-org", map[string]string{"tenant": "a"}, operatorsv1.BitwardenSecretPolicySpec{
+				AllowedOrganizationIds: []string{orgId},
+			}),
+			newPolicy("restrict-names", map[string]string{}, operatorsv1.BitwardenSecretPolicySpec{
+				AllowedSecretNamePatterns: []string{"db-*"},
+			}),
+		)
+
+		_, err := validator.ValidateCreate(ctx, bwSecret)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("restrict-names"))
+		Expect(err.Error()).NotTo(ContainSubstring("allow-org"))
+	})
+})
@@ -0,0 +1,110 @@
+package v1_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	"github.com/bitwarden/sm-kubernetes/internal/delivery"
+	webhookv1 "github.com/bitwarden/sm-kubernetes/internal/webhook/v1"
+)
+
+var _ = Describe("Pod Webhook - Injection", func() {
+	const namespace = "team-a"
+
+	var (
+		ctx       context.Context
+		defaulter *webhookv1.PodDefaulter
+		pod       *corev1.Pod
+	)
+
+	BeforeEach(func() {
+		ctx = admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{Namespace: namespace},
+		})
+
+		caFile := filepath.Join(GinkgoT().TempDir(), "ca.crt")
+		Expect(os.WriteFile(caFile, []byte("CA CERTIFICATE"), 0o600)).To(Succeed())
+		defaulter = &webhookv1.PodDefaulter{Injection: &webhookv1.InjectionConfig{
+			Image:       "bitwarden/sm-operator:test",
+			DeliveryURL: "https://sm-operator-webhook-service.sm-operator-system.svc/",
+			CAFile:      caFile,
+		}}
+
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "app",
+				Labels:      map[string]string{controller.LabelInject: "true"},
+				Annotations: map[string]string{controller.AnnotationInject: "bw-secret"},
+			},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "migrate", Image: "app"}},
+				Containers:     []corev1.Container{{Name: "app", Image: "app"}},
+			},
+		}
+	})
+
+	It("should add an init container fetching the BitwardenSecret into an in-memory volume", func() {
+		Expect(defaulter.Default(ctx, pod)).To(Succeed())
+
+		Expect(pod.Spec.InitContainers).To(HaveLen(2))
+		inject := pod.Spec.InitContainers[0]
+		Expect(inject.Name).To(Equal(webhookv1.InjectContainerName))
+		Expect(inject.Image).To(Equal("bitwarden/sm-operator:test"))
+		Expect(inject.Args).To(Equal([]string{
+			"fetch",
+			"--url", "https://sm-operator-webhook-service.sm-operator-system.svc" + delivery.Path(namespace, "bw-secret"),
+			"--token-file", "/var/run/secrets/k8s.bitwarden.com/token",
+			"--dir", webhookv1.DefaultInjectPath,
+			"--format", delivery.FormatFiles,
+		}))
+		Expect(inject.Env).To(ConsistOf(corev1.EnvVar{Name: delivery.EnvCABundle, Value: "CA CERTIFICATE"}))
+
+		Expect(pod.Spec.Volumes).To(HaveLen(2))
+		Expect(pod.Spec.Volumes[0].EmptyDir).NotTo(BeNil())
+		Expect(pod.Spec.Volumes[0].EmptyDir.Medium).To(Equal(corev1.StorageMediumMemory))
+		Expect(pod.Spec.Volumes[1].Projected.Sources[0].ServiceAccountToken.Audience).To(Equal(delivery.Audience))
+
+		for _, container := range []corev1.Container{pod.Spec.InitContainers[1], pod.Spec.Containers[0]} {
+			Expect(container.VolumeMounts).To(ConsistOf(corev1.VolumeMount{Name: pod.Spec.Volumes[0].Name, MountPath: webhookv1.DefaultInjectPath, ReadOnly: true}))
+		}
+
+		// Reinvocations do not inject twice
+		Expect(defaulter.Default(ctx, pod)).To(Succeed())
+		Expect(pod.Spec.InitContainers).To(HaveLen(2))
+	})
+
+	It("should honor the format and path annotations", func() {
+		pod.Annotations[controller.AnnotationInjectFormat] = delivery.FormatEnv
+		pod.Annotations[controller.AnnotationInjectPath] = "/etc/app"
+		Expect(defaulter.Default(ctx, pod)).To(Succeed())
+		Expect(pod.Spec.InitContainers[0].Args).To(ContainElements("/etc/app", delivery.FormatEnv))
+		Expect(pod.Spec.Containers[0].VolumeMounts[0].MountPath).To(Equal("/etc/app"))
+
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{controller.LabelInject: "true"}, Annotations: map[string]string{
+			controller.AnnotationInject:       "bw-secret",
+			controller.AnnotationInjectFormat: "yaml",
+		}}}
+		Expect(defaulter.Default(ctx, pod)).To(MatchError(ContainSubstring(controller.AnnotationInjectFormat)))
+	})
+
+	It("should reject labelled pods that do not name a BitwardenSecret", func() {
+		delete(pod.Annotations, controller.AnnotationInject)
+		Expect(defaulter.Default(ctx, pod)).To(MatchError(ContainSubstring(controller.AnnotationInject)))
+	})
+
+	It("should leave pods without the label alone", func() {
+		delete(pod.Labels, controller.LabelInject)
+		Expect(defaulter.Default(ctx, pod)).To(Succeed())
+		Expect(pod.Spec.InitContainers).To(HaveLen(1))
+		Expect(pod.Spec.Volumes).To(BeEmpty())
+	})
+})
@@ -0,0 +1,96 @@
+package v1_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	operatorsv1 "github.com/bitwarden/sm-kubernetes/api/v1"
+	"github.com/bitwarden/sm-kubernetes/internal/controller"
+	webhookv1 "github.com/bitwarden/sm-kubernetes/internal/webhook/v1"
+)
+
+var _ = Describe("Pod Webhook - Readiness Gate", func() {
+	const namespace = "team-a"
+
+	var (
+		ctx       context.Context
+		defaulter *webhookv1.PodDefaulter
+	)
+
+	podReferencing := func(secretName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{controller.LabelReadinessGate: "true"}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:    "app",
+				Image:   "app",
+				EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}}}},
+			}}},
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{Namespace: namespace},
+		})
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(operatorsv1.AddToScheme(scheme)).To(Succeed())
+
+		fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&operatorsv1.BitwardenSecret{
+				ObjectMeta: metav1.ObjectMeta{Name: "bw-secret", Namespace: namespace},
+				Spec:       operatorsv1.BitwardenSecretSpec{SecretName: "synced-secret"},
+			},
+			&operatorsv1.BitwardenSecret{
+				ObjectMeta: metav1.ObjectMeta{Name: "other-namespace", Namespace: "team-b"},
+				Spec:       operatorsv1.BitwardenSecretSpec{SecretName: "team-b-secret"},
+			},
+		).Build()
+
+		defaulter = &webhookv1.PodDefaulter{Client: fakeClient, ReadinessGates: true}
+	})
+
+	It("should gate pods referencing the secret of a BitwardenSecret", func() {
+		pod := podReferencing("synced-secret")
+		Expect(defaulter.Default(ctx, pod)).To(Succeed())
+		Expect(pod.Spec.ReadinessGates).To(ConsistOf(corev1.PodReadinessGate{ConditionType: controller.PodConditionSecretsSynced}))
+
+		// Pods that are already gated keep a single gate
+		Expect(defaulter.Default(ctx, pod)).To(Succeed())
+		Expect(pod.Spec.ReadinessGates).To(HaveLen(1))
+	})
+
+	It("should leave other pods alone", func() {
+		pod := podReferencing("unmanaged-secret")
+		Expect(defaulter.Default(ctx, pod)).To(Succeed())
+		Expect(pod.Spec.ReadinessGates).To(BeEmpty())
+
+		pod = podReferencing("team-b-secret")
+		Expect(defaulter.Default(ctx, pod)).To(Succeed())
+		Expect(pod.Spec.ReadinessGates).To(BeEmpty())
+
+		// Only labelled pods are gated
+		pod = podReferencing("synced-secret")
+		pod.Labels = nil
+		Expect(defaulter.Default(ctx, pod)).To(Succeed())
+		Expect(pod.Spec.ReadinessGates).To(BeEmpty())
+	})
+
+	It("should not gate pods when readiness gates are disabled", func() {
+		defaulter.ReadinessGates = false
+
+		pod := podReferencing("synced-secret")
+		Expect(defaulter.Default(ctx, pod)).To(Succeed())
+		Expect(pod.Spec.ReadinessGates).To(BeEmpty())
+	})
+})